@@ -2,11 +2,19 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/aliphe/skipery/agent/audit"
 	"github.com/aliphe/skipery/agent/chat"
+	"github.com/aliphe/skipery/agent/jobs"
 	"github.com/aliphe/skipery/tool"
+	"github.com/google/uuid"
 )
 
 type Model interface {
@@ -15,41 +23,90 @@ type Model interface {
 
 type Agent struct {
 	config    *Config
-	toolBelt  tool.ToolBelt
 	chatStore chat.Store
+	auditLog  audit.Store
+	cache     *tool.Cache
+	validator *tool.Validator
+	retriever *tool.Retriever
+	jobs      *jobs.Runner
 	model     Model
+
+	mu       sync.Mutex
+	toolBelt tool.ToolBelt
 }
 
-func NewAgent(config *Config, tools tool.ToolBelt, chatStore chat.Store, model Model) *Agent {
+// NewAgent creates an agent calling tools through cache and checking their results with
+// validator. The retriever selects the functions sent to the model, and the job runner
+// runs async functions in the background. All four can be nil to disable caching,
+// validation, selection and jobs.
+func NewAgent(config *Config, tools tool.ToolBelt, chatStore chat.Store, auditLog audit.Store, cache *tool.Cache, validator *tool.Validator, retriever *tool.Retriever, jobRunner *jobs.Runner, model Model) *Agent {
 	return &Agent{
 		config:    config,
 		toolBelt:  tools,
 		chatStore: chatStore,
+		auditLog:  auditLog,
+		cache:     cache,
+		validator: validator,
+		retriever: retriever,
+		jobs:      jobRunner,
 		model:     model,
 	}
 }
 
+// SetToolBelt replaces the functions the agent can call, such as when the functions of
+// an MCP server change after it reconnects.
+func (a *Agent) SetToolBelt(tools tool.ToolBelt) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.toolBelt = tools
+}
+
+func (a *Agent) belt() tool.ToolBelt {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.toolBelt
+}
+
 // SendMessage is a basic function to send a message to the agent and receive a response.
 func (a *Agent) SendMessage(ctx context.Context, chatID string, msg string) ([]*chat.Message, error) {
+	return a.SendMessages(ctx, chatID, []*chat.Message{{Author: chat.AuthorUser, Text: msg}})
+}
+
+// SendMessages adds messages to the chat, such as the ones of a prompt template, and
+// returns the new messages. The model only responds when the last message is from the
+// user.
+func (a *Agent) SendMessages(ctx context.Context, chatID string, messages []*chat.Message) ([]*chat.Message, error) {
 	chatSession, err := chat.LoadChat(ctx, chatID, a.chatStore)
 	if err != nil {
 		return nil, err
 	}
 
-	chatSession.AddUserMessage(msg)
-
-	msgs, err := a.sendMessage(ctx, chatSession.Messages())
-	if err != nil {
-		return nil, err
+	if a.jobs != nil {
+		for _, job := range a.jobs.Finished(chatID) {
+			chatSession.AddMessage(&chat.Message{
+				Author: chat.AuthorSystem,
+				Text:   fmt.Sprintf("The background job %s running %s %s. Use job_result to read its result if the user needs it.", job.ID, job.Function, job.Status),
+			})
+		}
+	}
+	for _, msg := range messages {
+		chatSession.AddMessage(msg)
 	}
 
-	// Update the chat with new messages
-	for _, newMsg := range msgs[len(chatSession.Messages()):] {
-		chatSession.AddMessage(newMsg)
+	if len(messages) > 0 && messages[len(messages)-1].Author == chat.AuthorUser {
+		msgs, err := a.sendMessage(ctx, chatID, chatSession.Messages())
+		if err != nil {
+			return nil, err
+		}
+
+		// Update the chat with new messages
+		for _, newMsg := range msgs[len(chatSession.Messages()):] {
+			chatSession.AddMessage(newMsg)
+		}
 	}
 
 	if chatSession.IsNew() {
-		name, err := a.chatName(ctx, msgs)
+		name, err := a.chatName(ctx, chatSession.Messages())
 		if err != nil {
 			return nil, err
 		}
@@ -83,11 +140,13 @@ func (a *Agent) chatName(ctx context.Context, messages []*chat.Message) (string,
 	return res.Text, nil
 }
 
-func (a *Agent) sendMessage(ctx context.Context, messages []*chat.Message) ([]*chat.Message, error) {
-	rsp, err := a.model.SendMessage(ctx, a.toolBelt, messages)
+func (a *Agent) sendMessage(ctx context.Context, chatID string, messages []*chat.Message) ([]*chat.Message, error) {
+	prompt := append([]*chat.Message{chat.SystemPrompt(time.Now())}, messages...)
+	rsp, err := a.model.SendMessage(ctx, a.tools(ctx, chatID, messages), prompt)
 	if err != nil {
 		return nil, err
 	}
+	rsp.ID = uuid.New().String()
 	msgs := slices.Clone(messages)
 	msgs = append(msgs, rsp)
 
@@ -97,7 +156,18 @@ func (a *Agent) sendMessage(ctx context.Context, messages []*chat.Message) ([]*c
 			FunctionResponses: make(chat.FunctionResponse),
 		}
 		for _, c := range rsp.FunctionCalls {
-			toolRes, err := a.toolBelt.Call(ctx, c.Name, c.Args)
+			start := time.Now()
+			toolRes, cached, err := a.callTool(tool.WithChatID(ctx, chatID), c.Name, c.Args)
+			a.logToolCall(ctx, &audit.ToolCall{
+				ChatID:    chatID,
+				MessageID: rsp.ID,
+				Function:  c.Name,
+				Source:    a.belt().Source(c.Name),
+				Args:      c.Args,
+				Duration:  time.Since(start),
+				Approval:  audit.ApprovalAuto,
+				Cached:    cached,
+			}, toolRes, err)
 			if err != nil {
 				message.FunctionResponses[c.Name] = map[string]any{
 					"error": err.Error(),
@@ -108,8 +178,81 @@ func (a *Agent) sendMessage(ctx context.Context, messages []*chat.Message) ([]*c
 		}
 		msgs = append(msgs, message)
 
-		return a.sendMessage(ctx, msgs)
+		return a.sendMessage(ctx, chatID, msgs)
 	}
 
 	return msgs, nil
 }
+
+// tools returns the functions sent to the model for a conversation: the ones relevant
+// to the last user messages, the latest weighing more, and the ones called since.
+func (a *Agent) tools(ctx context.Context, chatID string, messages []*chat.Message) tool.ToolBelt {
+	if a.retriever == nil {
+		return a.belt()
+	}
+	const turns = 3
+	var (
+		query  strings.Builder
+		recent []string
+		users  int
+	)
+	for i := len(messages) - 1; i >= 0 && users < turns; i-- {
+		m := messages[i]
+		for _, c := range m.FunctionCalls {
+			recent = append(recent, c.Name)
+		}
+		if m.Author == chat.AuthorUser && m.Text != "" {
+			query.WriteString(strings.Repeat(m.Text+"\n", turns-users))
+			users++
+		}
+	}
+	return a.retriever.Select(tool.WithChatID(ctx, chatID), a.belt(), query.String(), recent)
+}
+
+// callTool calls a function through the cache when there is one, reporting whether
+// the result was cached, and validates its result. Async functions run as jobs.
+func (a *Agent) callTool(ctx context.Context, function string, args map[string]any) (map[string]any, bool, error) {
+	if a.jobs != nil && a.jobs.Async(function) {
+		res, err := a.jobs.Run(ctx, function, args, func(ctx context.Context) (map[string]any, error) {
+			res, _, err := a.callFunction(ctx, function, args)
+			return res, err
+		})
+		return res, false, err
+	}
+	return a.callFunction(ctx, function, args)
+}
+
+func (a *Agent) callFunction(ctx context.Context, function string, args map[string]any) (map[string]any, bool, error) {
+	var (
+		res    map[string]any
+		cached bool
+		err    error
+	)
+	if a.cache == nil {
+		belt := a.belt()
+		res, err = belt.Call(ctx, function, args)
+	} else {
+		res, cached, err = a.cache.Call(ctx, a.belt(), function, args)
+	}
+	if err != nil || a.validator == nil {
+		return res, cached, err
+	}
+	res, err = a.validator.Validate(function, res)
+	return res, cached, err
+}
+
+// logToolCall records the outcome of a tool call in the audit log. Failing to do so is
+// logged but does not interrupt the conversation.
+func (a *Agent) logToolCall(ctx context.Context, call *audit.ToolCall, res map[string]any, err error) {
+	if a.auditLog == nil {
+		return
+	}
+	if err != nil {
+		call.Error = err.Error()
+	} else if b, err := json.Marshal(res); err == nil {
+		call.ResultSize = len(b)
+	}
+	if err := a.auditLog.SaveToolCall(ctx, call); err != nil {
+		slog.Error("save tool call", "function", call.Function, "error", err)
+	}
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+type Approval string
+
+const (
+	// ApprovalAuto is recorded when a tool call ran without asking the user.
+	ApprovalAuto Approval = "auto"
+)
+
+type Store interface {
+	SaveToolCall(ctx context.Context, call *ToolCall) error
+	ListToolCalls(ctx context.Context, filter Filter) ([]*ToolCall, error)
+}
+
+// ToolCall is a single function execution requested by the model.
+type ToolCall struct {
+	ID        string
+	ChatID    string
+	MessageID string
+	Function  string
+	// Source identifies the tool or MCP server implementing the function
+	Source     string
+	Args       map[string]any
+	ResultSize int
+	Error      string
+	Duration   time.Duration
+	Approval   Approval
+	// Cached is set when the result was reused from an identical earlier call
+	Cached    bool
+	CreatedAt time.Time
+}
+
+// Filter restricts the tool calls returned by a Store. Zero fields are ignored.
+type Filter struct {
+	ChatID   string
+	Function string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
@@ -2,6 +2,10 @@ package chat
 
 import (
 	"context"
+	"fmt"
+	"time"
+
+	"github.com/aliphe/skipery/pkg/dates"
 )
 
 type Author string
@@ -29,11 +33,15 @@ type Chat struct {
 }
 
 type Message struct {
+	ID            string `json:"id"`
 	Author        Author
 	Text          string         `json:"text"`
 	FunctionCalls []FunctionCall `json:"function_calls"`
 	// Responses objects by function name
 	FunctionResponses FunctionResponse `json:"function_responses"`
+	// Tokens is the number of tokens generated for a model message, when the model
+	// reports it.
+	Tokens int `json:"tokens,omitempty"`
 }
 
 func (m *Message) String() string {
@@ -48,35 +56,47 @@ type FunctionResponse map[string]map[string]any
 
 // NewChat creates a new chat instance
 func NewChat(id string, store Store) *Chat {
-	systemPrompt := &Message{
-		Author: AuthorSystem,
-		Text:   "You are a helpful AI assistant with access to various tools. You should actively use the available tools to help users accomplish their tasks. When a user asks for something that could benefit from using a tool, always prefer using the appropriate tool rather than just providing a text response. Be proactive in suggesting and using tools that can provide more accurate, up-to-date, or comprehensive information. Your goal is to leverage your tools effectively to give users the best possible assistance.\n\nWhen using tools:\n- Pay careful attention to the parameter descriptions and examples provided\n- Use the exact parameter names and types specified in the tool definitions\n- When a tool requires numerical inputs, ensure you provide proper numbers (not strings)\n- Read the tool descriptions carefully to understand what each tool does and when to use it\n- If a tool call fails, examine the error message and try again with corrected parameters",
-	}
 	return &Chat{
-		ID:       id,
-		messages: []*Message{systemPrompt},
-		isNew:    true,
-		store:    store,
+		ID:    id,
+		isNew: true,
+		store: store,
 	}
 }
 
-// LoadChat creates a chat instance and loads existing messages from store
+// LoadChat creates a chat instance and loads existing messages from store. A chat
+// without messages is new.
 func LoadChat(ctx context.Context, id string, store Store) (*Chat, error) {
 	messages, err := store.GetMessages(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	isNew := len(messages) == 0
+	if len(messages) == 0 {
+		return NewChat(id, store), nil
+	}
 	return &Chat{
 		ID:         id,
 		messages:   messages,
-		isNew:      isNew,
 		savedIndex: len(messages),
 		store:      store,
 	}, nil
 }
 
+// SystemPrompt returns the instructions sent to the model ahead of the chat messages.
+// It isn't saved with them, so that the date it gives is the one of each request.
+func SystemPrompt(now time.Time) *Message {
+	return &Message{
+		Author: AuthorSystem,
+		Text:   "You are a helpful AI assistant with access to various tools. You should actively use the available tools to help users accomplish their tasks. When a user asks for something that could benefit from using a tool, always prefer using the appropriate tool rather than just providing a text response. Be proactive in suggesting and using tools that can provide more accurate, up-to-date, or comprehensive information. Your goal is to leverage your tools effectively to give users the best possible assistance.\n\nWhen using tools:\n- Pay careful attention to the parameter descriptions and examples provided\n- Use the exact parameter names and types specified in the tool definitions\n- When a tool requires numerical inputs, ensure you provide proper numbers (not strings)\n- Read the tool descriptions carefully to understand what each tool does and when to use it\n- If a tool call fails, examine the error message and try again with corrected parameters\n\n" + currentTime(now),
+	}
+}
+
+// currentTime tells the model the date it can't know, in the user's timezone.
+func currentTime(now time.Time) string {
+	return fmt.Sprintf("The current date is %s and the time is %s. The user's timezone is %s (UTC%s).",
+		now.Format("Monday, January 2, 2006"), now.Format("15:04"), dates.LocalZone(), now.Format("-07:00"))
+}
+
 // AddMessage adds a message to the chat
 func (c *Chat) AddMessage(msg *Message) {
 	c.messages = append(c.messages, msg)
@@ -135,3 +155,16 @@ func (c *Chat) SaveWithTitle(ctx context.Context, title string) error {
 	}
 	return nil
 }
+
+type maxTokensKey struct{}
+
+// WithMaxTokens returns a context limiting the tokens generated by the model to n.
+func WithMaxTokens(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, maxTokensKey{}, n)
+}
+
+// MaxTokens returns the limit of generated tokens set with WithMaxTokens, 0 when unset.
+func MaxTokens(ctx context.Context) int {
+	n, _ := ctx.Value(maxTokensKey{}).(int)
+	return n
+}
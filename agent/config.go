@@ -3,14 +3,36 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"log/slog"
+	"maps"
 	"os"
+	"slices"
 
+	"github.com/aliphe/skipery/agent/jobs"
 	"github.com/aliphe/skipery/mcp"
+	"github.com/aliphe/skipery/plugin"
 	"github.com/aliphe/skipery/tool"
 )
 
 type Config struct {
-	MCP *mcp.Client
+	MCP        *mcp.Client
+	SQL        *tool.SQLConfig
+	FileSystem *tool.FileSystemConfig
+	Shell      *tool.ShellConfig
+	HTTP       *tool.HTTPConfig
+	Starlark   *tool.StarlarkConfig
+	Git        *tool.GitConfig
+	Data       *tool.DataConfig
+	Cache      *tool.CacheConfig
+	Validation *tool.ValidationConfig
+	// ToolSelection limits the functions sent to the model with every message
+	ToolSelection *tool.ToolSelectionConfig
+	Jobs          *jobs.Config
+	Plugins       map[string]*plugin.Config
+	// WasmPlugins lists the WebAssembly plugins, run in a sandbox
+	WasmPlugins map[string]*plugin.WasmConfig
+	// Declared lists the tools defined in the tools section
+	Declared map[string]*tool.DeclaredConfig
 }
 
 func (c *Config) Tools() []tool.Tool {
@@ -27,7 +49,22 @@ func ParseConfig(ctx context.Context, path string) (*Config, error) {
 	}
 
 	var fileConfig struct {
-		MCPServers map[string]*mcp.Config `json:"mcpServers"`
+		MCPServers    map[string]*mcp.Config          `json:"mcpServers"`
+		SQL           *tool.SQLConfig                 `json:"sql"`
+		FileSystem    *tool.FileSystemConfig          `json:"filesystem"`
+		Shell         *tool.ShellConfig               `json:"shell"`
+		HTTP          *tool.HTTPConfig                `json:"http"`
+		Starlark      *tool.StarlarkConfig            `json:"starlark"`
+		Git           *tool.GitConfig                 `json:"git"`
+		Data          *tool.DataConfig                `json:"data"`
+		Cache         *tool.CacheConfig               `json:"cache"`
+		Validation    *tool.ValidationConfig          `json:"validation"`
+		ToolSelection *tool.ToolSelectionConfig       `json:"toolSelection"`
+		Jobs          *jobs.Config                    `json:"jobs"`
+		Artifacts     *tool.ArtifactConfig            `json:"artifacts"`
+		Plugins       map[string]*plugin.Config       `json:"plugins"`
+		WasmPlugins   map[string]*plugin.WasmConfig   `json:"wasmPlugins"`
+		Tools         map[string]*tool.DeclaredConfig `json:"tools"`
 	}
 
 	err = json.Unmarshal(data, &fileConfig)
@@ -35,15 +72,48 @@ func ParseConfig(ctx context.Context, path string) (*Config, error) {
 		return nil, err
 	}
 
-	cli := mcp.NewClient()
-
-	for name, cfg := range fileConfig.MCPServers {
+	for name, cfg := range fileConfig.Plugins {
+		cfg.Name = name
+	}
+	for name, cfg := range fileConfig.WasmPlugins {
+		cfg.Name = name
+	}
+	for name, cfg := range fileConfig.Tools {
 		cfg.Name = name
-		cli.Connect(ctx, cfg)
+	}
 
+	cli := mcp.NewClient(tool.NewArtifactDir(fileConfig.Artifacts))
+
+	for _, name := range slices.Sorted(maps.Keys(fileConfig.MCPServers)) {
+		cfg := fileConfig.MCPServers[name]
+		cfg.Name = name
+		if !cfg.Disabled {
+			if err := cfg.Resolve(); err != nil {
+				return nil, err
+			}
+		}
+		// Servers failing to connect are retried in the background and reported in their
+		// status.
+		if err := cli.Connect(ctx, cfg); err != nil {
+			slog.Error("connect to MCP server", "server", name, "error", err)
+		}
 	}
 
 	return &Config{
-		MCP: cli,
+		MCP:           cli,
+		SQL:           fileConfig.SQL,
+		FileSystem:    fileConfig.FileSystem,
+		Shell:         fileConfig.Shell,
+		HTTP:          fileConfig.HTTP,
+		Starlark:      fileConfig.Starlark,
+		Git:           fileConfig.Git,
+		Data:          fileConfig.Data,
+		Cache:         fileConfig.Cache,
+		Validation:    fileConfig.Validation,
+		ToolSelection: fileConfig.ToolSelection,
+		Jobs:          fileConfig.Jobs,
+		Plugins:       fileConfig.Plugins,
+		WasmPlugins:   fileConfig.WasmPlugins,
+		Declared:      fileConfig.Tools,
 	}, nil
 }
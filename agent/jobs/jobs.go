@@ -0,0 +1,42 @@
+// Package jobs runs long function calls in the background, so that the conversation
+// goes on while they complete.
+package jobs
+
+import (
+	"context"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+type Store interface {
+	SaveJob(ctx context.Context, job *Job) error
+	GetJob(ctx context.Context, id string) (*Job, error)
+	ListJobs(ctx context.Context, filter Filter) ([]*Job, error)
+}
+
+// Job is a function call running, or that ran, in the background.
+type Job struct {
+	ID       string
+	ChatID   string
+	Function string
+	Args     map[string]any
+	Status   Status
+	// Result is set when the job succeeded, Error when it failed
+	Result     map[string]any
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Filter restricts the jobs returned by a Store. Zero fields are ignored.
+type Filter struct {
+	ChatID string
+	Status Status
+}
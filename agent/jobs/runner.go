@@ -0,0 +1,307 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+	"github.com/aliphe/skipery/tool"
+	"github.com/google/uuid"
+)
+
+const defaultWait = 10 * time.Second
+
+// Config selects the functions run as jobs.
+type Config struct {
+	// Wait is how long a call waits for an async function before handing a job to the
+	// model.
+	Wait tool.Duration `json:"wait"`
+	// Functions lists functions to run as jobs, by ID or pattern such as "linear_export_*",
+	// on top of the ones declared async.
+	Functions []string `json:"functions"`
+}
+
+var _ tool.Tool = (*Runner)(nil)
+
+// Runner runs the calls of async functions as jobs. It is also the tool of the
+// job_status and job_result functions.
+type Runner struct {
+	store Store
+	wait  time.Duration
+	// patterns select the functions run as jobs on top of the async ones.
+	patterns []string
+	notify   func(*Job)
+
+	mu    sync.Mutex
+	async map[string]bool
+	// detached holds the IDs of the running jobs handed to the model.
+	detached map[string]bool
+	// finished holds the detached jobs finished since the last message of their chat.
+	finished map[string][]*Job
+}
+
+// NewRunner creates a runner of the async functions of tb, saving jobs in store. notify,
+// when not nil, is called when a job finishes.
+func NewRunner(store Store, cfg *Config, tb tool.ToolBelt, notify func(*Job)) *Runner {
+	var c Config
+	if cfg != nil {
+		c = *cfg
+	}
+	r := &Runner{
+		store:    store,
+		wait:     time.Duration(c.Wait),
+		patterns: c.Functions,
+		notify:   notify,
+		detached: map[string]bool{},
+		finished: map[string][]*Job{},
+	}
+	if r.wait <= 0 {
+		r.wait = defaultWait
+	}
+	r.Reload(tb)
+	return r
+}
+
+// Reload selects the functions of tb run as jobs again, such as when the functions of
+// an MCP server change after it reconnects.
+func (r *Runner) Reload(tb tool.ToolBelt) {
+	async := map[string]bool{}
+	seen := map[tool.Tool]bool{}
+	for _, t := range tb {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		for _, fn := range t.Functions(context.Background()) {
+			if fn.Async {
+				async[fn.ID] = true
+			}
+		}
+	}
+	for id := range tb {
+		if slices.ContainsFunc(r.patterns, func(pattern string) bool { return tool.MatchWildcard(pattern, id) }) {
+			async[id] = true
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.async = async
+}
+
+// Recover fails the jobs left running by a previous run of the agent.
+func (r *Runner) Recover(ctx context.Context) error {
+	running, err := r.store.ListJobs(ctx, Filter{Status: StatusRunning})
+	if err != nil {
+		return err
+	}
+	for _, job := range running {
+		job.Status = StatusFailed
+		job.Error = "the agent stopped before the job finished"
+		job.FinishedAt = time.Now()
+		if err := r.store.SaveJob(ctx, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Async reports whether function runs as a job.
+func (r *Runner) Async(function string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.async[function]
+}
+
+// Run starts call as a job and waits for it for a while. The result of the call is
+// returned when it finishes in time, a job handle otherwise.
+func (r *Runner) Run(ctx context.Context, function string, args map[string]any, call func(context.Context) (map[string]any, error)) (map[string]any, error) {
+	job := &Job{
+		ID:        uuid.New().String(),
+		ChatID:    tool.ChatID(ctx),
+		Function:  function,
+		Args:      args,
+		Status:    StatusRunning,
+		CreatedAt: time.Now(),
+	}
+	if err := r.store.SaveJob(ctx, job); err != nil {
+		return nil, fmt.Errorf("save job: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		// The job outlives the message that started it.
+		res, err := call(context.WithoutCancel(ctx))
+		r.finish(job, res, err, done)
+	}()
+
+	result := func() (map[string]any, error) {
+		if job.Status == StatusFailed {
+			return nil, fmt.Errorf("%s", job.Error)
+		}
+		return job.Result, nil
+	}
+	select {
+	case <-done:
+		return result()
+	case <-time.After(r.wait):
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-done:
+		// The job finished while the wait expired.
+		return result()
+	default:
+	}
+	r.detached[job.ID] = true
+	return map[string]any{
+		"job_id":  job.ID,
+		"status":  string(StatusRunning),
+		"message": fmt.Sprintf("%s is still running as a background job. Tell the user it is in progress, and use job_status or job_result with this job_id to check on it later. The user is notified when it finishes.", function),
+	}, nil
+}
+
+// finish records the outcome of job and closes done. Detached jobs are announced.
+func (r *Runner) finish(job *Job, res map[string]any, err error, done chan struct{}) {
+	job.FinishedAt = time.Now()
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = StatusSucceeded
+		job.Result = res
+	}
+	if err := r.store.SaveJob(context.Background(), job); err != nil {
+		slog.Error("save job", "job", job.ID, "error", err)
+	}
+
+	r.mu.Lock()
+	close(done)
+	detached := r.detached[job.ID]
+	if detached {
+		delete(r.detached, job.ID)
+		r.finished[job.ChatID] = append(r.finished[job.ChatID], job)
+	}
+	r.mu.Unlock()
+	if detached && r.notify != nil {
+		r.notify(job)
+	}
+}
+
+// Finished returns the jobs of a chat finished since the last call, once.
+func (r *Runner) Finished(chatID string) []*Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := r.finished[chatID]
+	delete(r.finished, chatID)
+	return jobs
+}
+
+func (r *Runner) Functions(ctx context.Context) []tool.Function {
+	jobID := jsonschema.JSONSchema{
+		Type:        "string",
+		Description: "The job_id returned when the job started",
+	}
+	return []tool.Function{
+		{
+			ID:          "job_status",
+			DisplayName: "Job Status",
+			Description: "Tells whether a background job is still running, succeeded or failed. Use this function when the user asks about a job started earlier in the conversation.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for checking a job",
+				Properties: map[string]jsonschema.JSONSchema{
+					"job_id": jobID,
+				},
+				Required:         []string{"job_id"},
+				PropertyOrdering: []string{"job_id"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The status of the job",
+				Properties: map[string]jsonschema.JSONSchema{
+					"job_id":      {Type: "string", Description: "The job ID"},
+					"function":    {Type: "string", Description: "The function the job runs"},
+					"status":      {Type: "string", Description: "running, succeeded or failed"},
+					"started_at":  {Type: "string", Description: "When the job started, in RFC3339 format"},
+					"finished_at": {Type: "string", Description: "When the job finished, in RFC3339 format"},
+					"duration":    {Type: "string", Description: "How long the job ran, or has been running, such as 2m30s"},
+					"error":       {Type: "string", Description: "Why the job failed"},
+				},
+			},
+		},
+		{
+			ID:          "job_result",
+			DisplayName: "Job Result",
+			Description: "Returns the result of a background job once it succeeded, as the function it runs would have. Use this function when a job finished to continue the task that started it.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for reading the result of a job",
+				Properties: map[string]jsonschema.JSONSchema{
+					"job_id": jobID,
+				},
+				Required:         []string{"job_id"},
+				PropertyOrdering: []string{"job_id"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The result of the function run by the job, or its status while it is running",
+			},
+		},
+	}
+}
+
+func (r *Runner) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	id, ok := params["job_id"].(string)
+	if !ok || id == "" {
+		return nil, fmt.Errorf("job_id parameter must be a non-empty string")
+	}
+	job, err := r.store.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Jobs are only visible from the chat that started them.
+	if job == nil || job.ChatID != tool.ChatID(ctx) {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+
+	switch fn {
+	case "job_status":
+		return status(job), nil
+	case "job_result":
+		switch job.Status {
+		case StatusSucceeded:
+			return job.Result, nil
+		case StatusFailed:
+			return nil, fmt.Errorf("job %s failed: %s", job.ID, job.Error)
+		default:
+			return status(job), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+}
+
+func status(job *Job) map[string]any {
+	res := map[string]any{
+		"job_id":     job.ID,
+		"function":   job.Function,
+		"status":     string(job.Status),
+		"started_at": job.CreatedAt.Format(time.RFC3339),
+	}
+	end := time.Now()
+	if !job.FinishedAt.IsZero() {
+		end = job.FinishedAt
+		res["finished_at"] = job.FinishedAt.Format(time.RFC3339)
+	}
+	res["duration"] = end.Sub(job.CreatedAt).Round(time.Second).String()
+	if job.Error != "" {
+		res["error"] = job.Error
+	}
+	return res
+}
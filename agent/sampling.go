@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/aliphe/skipery/agent/chat"
+	"github.com/aliphe/skipery/mcp"
+)
+
+var _ mcp.Sampler = (*Sampler)(nil)
+
+// Sampler runs the completions requested by MCP servers with the model of the agent,
+// without tools.
+type Sampler struct {
+	model Model
+}
+
+// NewSampler creates a sampler running completions with model.
+func NewSampler(model Model) *Sampler {
+	return &Sampler{model: model}
+}
+
+func (s *Sampler) Sample(ctx context.Context, req *mcp.SamplingRequest) (*mcp.SamplingResult, error) {
+	var messages []*chat.Message
+	if req.SystemPrompt != "" {
+		messages = append(messages, &chat.Message{Author: chat.AuthorSystem, Text: req.SystemPrompt})
+	}
+	for _, m := range req.Messages {
+		author := chat.AuthorUser
+		if m.Role == "assistant" {
+			author = chat.AuthorModel
+		}
+		messages = append(messages, &chat.Message{Author: author, Text: m.Text})
+	}
+	if req.MaxTokens > 0 {
+		ctx = chat.WithMaxTokens(ctx, req.MaxTokens)
+	}
+	res, err := s.model.SendMessage(ctx, nil, messages)
+	if err != nil {
+		return nil, err
+	}
+	out := &mcp.SamplingResult{Text: res.Text, Tokens: res.Tokens}
+	if named, ok := s.model.(interface{ Name() string }); ok {
+		out.Model = named.Name()
+	}
+	return out, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aliphe/skipery/agent/audit"
+)
+
+// runAudit prints the tool call audit log, filtered by the given command line flags.
+func runAudit(ctx context.Context, store audit.Store, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	chatID := fs.String("chat", "", "only show calls made in this chat")
+	function := fs.String("tool", "", "only show calls to this function")
+	since := fs.String("since", "", "only show calls made after this time (RFC3339, or a duration such as 24h)")
+	until := fs.String("until", "", "only show calls made before this time (RFC3339, or a duration such as 1h)")
+	limit := fs.Int("limit", 50, "maximum number of calls to show, 0 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := audit.Filter{
+		ChatID:   *chatID,
+		Function: *function,
+		Limit:    *limit,
+	}
+	var err error
+	if filter.Since, err = parseTime(*since); err != nil {
+		return fmt.Errorf("parse since: %w", err)
+	}
+	if filter.Until, err = parseTime(*until); err != nil {
+		return fmt.Errorf("parse until: %w", err)
+	}
+
+	calls, err := store.ListToolCalls(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tCHAT\tSOURCE\tFUNCTION\tDURATION\tSIZE\tAPPROVAL\tCACHED\tARGS\tERROR")
+	for _, c := range calls {
+		args, _ := json.Marshal(c.Args)
+		cached := "no"
+		if c.Cached {
+			cached = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			c.CreatedAt.Local().Format(time.DateTime), c.ChatID, c.Source, c.Function, c.Duration, c.ResultSize, c.Approval, cached, args, c.Error)
+	}
+	return w.Flush()
+}
+
+// parseTime accepts either an absolute RFC3339 time or a duration relative to now.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
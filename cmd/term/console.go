@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// console reads the lines typed in the terminal. Questions, asked while the agent works
+// or waits for input, get the first line typed after them rather than input.
+type console struct {
+	out io.Writer
+	// ask makes questions wait for the previous one to be answered.
+	ask sync.Mutex
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// lines are the lines typed and not read yet.
+	lines  []string
+	asking bool
+	eof    bool
+}
+
+// newConsole reads the lines of in in the background.
+func newConsole(in io.Reader, out io.Writer) *console {
+	c := &console{out: out}
+	c.cond = sync.NewCond(&c.mu)
+	go c.read(in)
+	return c
+}
+
+func (c *console) read(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		c.mu.Lock()
+		c.lines = append(c.lines, scanner.Text())
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	c.eof = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// Line returns the next line of input once no question is pending, reporting false at
+// the end of input.
+func (c *console) Line() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for (len(c.lines) == 0 || c.asking) && !c.eof {
+		c.cond.Wait()
+	}
+	return c.next()
+}
+
+// Ask writes question and returns the line answering it, reporting false at the end of
+// input. Lines typed before the question are dropped, since they don't answer it.
+func (c *console) Ask(question string) (string, bool) {
+	c.ask.Lock()
+	defer c.ask.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.asking = true
+	defer func() {
+		c.asking = false
+		c.cond.Broadcast()
+	}()
+	c.lines = nil
+	fmt.Fprint(c.out, question)
+	for len(c.lines) == 0 && !c.eof {
+		c.cond.Wait()
+	}
+	return c.next()
+}
+
+// next pops the oldest line, with c.mu held.
+func (c *console) next() (string, bool) {
+	if len(c.lines) == 0 {
+		return "", false
+	}
+	line := c.lines[0]
+	c.lines = c.lines[1:]
+	return line, true
+}
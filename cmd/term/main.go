@@ -1,17 +1,22 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"log"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/aliphe/skipery/agent"
+	"github.com/aliphe/skipery/agent/chat"
+	"github.com/aliphe/skipery/agent/jobs"
 	store "github.com/aliphe/skipery/db"
 	"github.com/aliphe/skipery/llm"
+	"github.com/aliphe/skipery/plugin"
 	"github.com/aliphe/skipery/tool"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -21,6 +26,24 @@ import (
 
 func main() {
 	ctx := context.Background()
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./agent.db"
+	}
+	db, err := sqlx.Open("sqlite3", dbPath)
+	if err != nil {
+		log.Panicf("load database: %v", err)
+	}
+	defer db.Close()
+	auditStore := store.NewAuditStore(db)
+
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		if err := runAudit(ctx, auditStore, os.Args[2:]); err != nil {
+			log.Fatalf("audit: %v", err)
+		}
+		return
+	}
+
 	config, err := agent.ParseConfig(ctx, "agent.json")
 	if err != nil {
 		slog.Info("parse config", "error", err)
@@ -31,41 +54,169 @@ func main() {
 	if err != nil {
 		log.Panicf("load gemini client: %v", err)
 	}
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./agent.db"
+
+	var sqlConfig *tool.SQLConfig
+	if config != nil {
+		sqlConfig = config.SQL
 	}
-	db, err := sqlx.Open("sqlite3", dbPath)
+	sqlTool, err := tool.NewSQL(ctx, db, sqlConfig)
 	if err != nil {
-		log.Panicf("load database: %v", err)
+		log.Panicf("load sql tool: %v", err)
+	}
+	defer sqlTool.Close()
+	var (
+		httpConfig     *tool.HTTPConfig
+		starlarkConfig *tool.StarlarkConfig
+	)
+	if config != nil {
+		httpConfig = config.HTTP
+		starlarkConfig = config.Starlark
 	}
-	defer db.Close()
-
 	tools := []tool.Tool{
 		tool.NewUserName(),
 		tool.NewMath(),
-		tool.NewSQL(db),
+		tool.NewTime(),
+		sqlTool,
+		tool.NewHTTP(httpConfig),
+		tool.NewStarlark(starlarkConfig),
+	}
+	if config != nil && config.FileSystem != nil {
+		fsTool, err := tool.NewFileSystem(config.FileSystem)
+		if err != nil {
+			log.Panicf("load file system tool: %v", err)
+		}
+		defer fsTool.Close()
+		tools = append(tools, fsTool)
+	}
+	if config != nil && config.Shell != nil {
+		shellTool, err := tool.NewShell(config.Shell)
+		if err != nil {
+			log.Panicf("load shell tool: %v", err)
+		}
+		tools = append(tools, shellTool)
+	}
+	if config != nil && config.Git != nil {
+		gitTool, err := tool.NewGit(ctx, config.Git)
+		if err != nil {
+			log.Panicf("load git tool: %v", err)
+		}
+		tools = append(tools, gitTool)
+	}
+	if config != nil && config.Data != nil {
+		dataTool, err := tool.NewData(config.Data)
+		if err != nil {
+			log.Panicf("load data tool: %v", err)
+		}
+		defer dataTool.Close()
+		tools = append(tools, dataTool)
 	}
 	if config != nil {
+		for _, name := range slices.Sorted(maps.Keys(config.Plugins)) {
+			p, err := plugin.Load(ctx, config.Plugins[name])
+			if err != nil {
+				log.Panicf("load plugin %s: %v", name, err)
+			}
+			tools = append(tools, p)
+		}
+		for _, name := range slices.Sorted(maps.Keys(config.WasmPlugins)) {
+			w, err := plugin.LoadWasm(ctx, config.WasmPlugins[name])
+			if err != nil {
+				log.Panicf("load wasm plugin %s: %v", name, err)
+			}
+			defer w.Close()
+			tools = append(tools, w)
+		}
+		for _, name := range slices.Sorted(maps.Keys(config.Declared)) {
+			t, err := tool.NewDeclared(config.Declared[name])
+			if err != nil {
+				log.Panicf("load tool %s: %v", name, err)
+			}
+			tools = append(tools, t)
+		}
 		tools = append(tools, config.MCP.Tools()...)
+		defer config.MCP.Close()
+		if err := printMCPStatus(os.Stdout, config.MCP.Status()); err != nil {
+			slog.Error("print MCP status", "error", err)
+		}
 	}
 
-	toolBelt := tool.NewToolBelt(tools...)
+	var (
+		cacheConfig         *tool.CacheConfig
+		validationConfig    *tool.ValidationConfig
+		toolSelectionConfig *tool.ToolSelectionConfig
+		jobsConfig          *jobs.Config
+	)
+	if config != nil {
+		cacheConfig = config.Cache
+		validationConfig = config.Validation
+		toolSelectionConfig = config.ToolSelection
+		jobsConfig = config.Jobs
+	}
+	jobRunner := jobs.NewRunner(store.NewJobStore(db), jobsConfig, tool.NewToolBelt(tools...), func(job *jobs.Job) {
+		fmt.Printf("\n[job %s: %s %s]\n> ", job.ID, job.Function, job.Status)
+	})
+	if err := jobRunner.Recover(ctx); err != nil {
+		slog.Error("recover jobs", "error", err)
+	}
+	// The retriever searches the other tools, and is one itself for its find_tools
+	// function.
+	retriever := tool.NewRetriever(toolSelectionConfig, tool.NewToolBelt(append(tools, jobRunner)...))
+	toolBelt := tool.NewToolBelt(append(tools, jobRunner, retriever)...)
+	cacheStore, err := newCacheStore(db, cacheConfig)
+	if err != nil {
+		log.Panicf("load tool cache: %v", err)
+	}
+	cache := tool.NewCache(cacheStore, cacheConfig, toolBelt)
+	validator, err := tool.NewValidator(validationConfig, toolBelt)
+	if err != nil {
+		log.Panicf("load tool result validation: %v", err)
+	}
 	chatStore := store.NewChatStore(db)
-	agent := agent.NewAgent(config, toolBelt, chatStore, llm.NewGemini(geminiClient))
+	model := llm.NewGemini(geminiClient)
+	in := newConsole(os.Stdin, os.Stdout)
+	if config != nil {
+		approval := &samplingApproval{in: in}
+		config.MCP.SetSampler(agent.NewSampler(model), approval.approve)
+	}
+	agent := agent.NewAgent(config, toolBelt, chatStore, auditStore, cache, validator, retriever, jobRunner, model)
+	if config != nil {
+		// The functions of MCP servers connecting after startup, or changing when they
+		// reconnect, are registered again. Servers may have connected since the tool
+		// belt was built.
+		var reloading sync.Mutex
+		reloadTools := func() {
+			reloading.Lock()
+			defer reloading.Unlock()
+			jobRunner.Reload(tool.NewToolBelt(tools...))
+			retriever.Reload(tool.NewToolBelt(append(tools, jobRunner)...))
+			toolBelt := tool.NewToolBelt(append(tools, jobRunner, retriever)...)
+			cache.Reload(toolBelt)
+			validator.Reload(toolBelt)
+			agent.SetToolBelt(toolBelt)
+		}
+		config.MCP.OnToolsChanged(reloadTools)
+		reloadTools()
+	}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	slog.Info("Agent started. Type 'exit' to quit.")
+	slog.Info("Agent started. Type '/mcp' for the MCP servers status, '/resources' and '/attach <server> <uri>' to attach MCP resources, '/prompts' and '/<server>:<prompt> [arg=value ...]' to send MCP prompts, 'exit' to quit.")
 
 	chatID := uuid.New().String()
+	commands := &mcpCommands{}
+	if config != nil {
+		commands.client = config.MCP
+		config.MCP.OnResourceUpdated(func(server, uri string) {
+			fmt.Printf("\n[resource %s updated on %s, /attach it again to send the new version]\n> ", uri, server)
+		})
+	}
 
 	for {
 		fmt.Print("> ")
-		if !scanner.Scan() {
+		line, ok := in.Line()
+		if !ok {
 			break
 		}
 
-		input := strings.TrimSpace(scanner.Text())
+		input := strings.TrimSpace(line)
 		if input == "exit" {
 			break
 		}
@@ -74,7 +225,17 @@ func main() {
 			continue
 		}
 
-		response, err := agent.SendMessage(ctx, chatID, input)
+		var response []*chat.Message
+		if messages, ok := commands.prompt(tool.WithChatID(ctx, chatID), os.Stdout, in, input); ok {
+			if messages == nil {
+				continue
+			}
+			response, err = agent.SendMessages(ctx, chatID, messages)
+		} else if commands.run(tool.WithChatID(ctx, chatID), os.Stdout, input) {
+			continue
+		} else {
+			response, err = agent.SendMessage(ctx, chatID, commands.message(input))
+		}
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			continue
@@ -96,3 +257,18 @@ func main() {
 		}
 	}
 }
+
+// newCacheStore returns the store of tool results selected by cfg, in memory by default.
+func newCacheStore(db *sqlx.DB, cfg *tool.CacheConfig) (tool.CacheStore, error) {
+	if cfg == nil {
+		return tool.NewMemoryCache(0), nil
+	}
+	switch cfg.Store {
+	case "", "memory":
+		return tool.NewMemoryCache(cfg.MaxEntries), nil
+	case "sqlite":
+		return store.NewCacheStore(db), nil
+	default:
+		return nil, fmt.Errorf("unknown cache store %q, expected memory or sqlite", cfg.Store)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aliphe/skipery/agent/chat"
+	"github.com/aliphe/skipery/mcp"
+)
+
+const (
+	// maxSuggestions caps the completions shown for a prompt argument.
+	maxSuggestions = 10
+	// maxSampledText caps the text shown of each message of a sampling request.
+	maxSampledText = 500
+)
+
+// mcpCommands runs the terminal commands about MCP servers:
+//
+//	/mcp                     shows the status of the servers
+//	/resources [server]      lists the resources of the servers
+//	/attach <server> <uri>   attaches a resource to the next message
+//	/prompts                 lists the prompts of the servers
+//	/<server>:<prompt> [arg=value ...]
+//	                         sends a prompt, asking for its missing arguments
+type mcpCommands struct {
+	client *mcp.Client
+	// attachments are the resources attached to the next message.
+	attachments []string
+}
+
+// run runs input when it is an MCP command, reporting whether it was one.
+func (m *mcpCommands) run(ctx context.Context, out io.Writer, input string) bool {
+	args := strings.Fields(input)
+	var err error
+	switch args[0] {
+	case "/mcp":
+		err = printMCPStatus(out, m.client.Status())
+	case "/resources":
+		if m.client == nil {
+			err = fmt.Errorf("no MCP servers configured")
+			break
+		}
+		var resources []mcp.Resource
+		if resources, err = m.client.ListResources(ctx, strings.Join(args[1:], " ")); err == nil {
+			err = printResources(out, resources)
+		}
+	case "/attach":
+		if len(args) != 3 {
+			err = fmt.Errorf("usage: /attach <server> <uri>")
+			break
+		}
+		err = m.attach(ctx, out, args[1], args[2])
+	case "/prompts":
+		err = printPrompts(out, m.client.Prompts())
+	default:
+		return false
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+	}
+	return true
+}
+
+// attach reads a resource for the next message, and subscribes to its updates.
+func (m *mcpCommands) attach(ctx context.Context, out io.Writer, server, uri string) error {
+	if m.client == nil {
+		return fmt.Errorf("no MCP servers configured")
+	}
+	contents, err := m.client.ReadResource(ctx, server, uri)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Attached resource %s from the %s MCP server:\n", uri, server)
+	for _, c := range contents {
+		if text, ok := c["text"].(string); ok {
+			b.WriteString(text + "\n")
+			if c["truncated"] == true {
+				b.WriteString("[truncated]\n")
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "[%v, %v bytes, saved as %v]\n", c["mime_type"], c["size"], c["path"])
+	}
+	m.attachments = append(m.attachments, b.String())
+
+	subscribed, err := m.client.Subscribe(ctx, server, uri)
+	if err != nil {
+		return err
+	}
+	if subscribed {
+		fmt.Fprintf(out, "Attached %s to the next message. Its updates will be reported.\n", uri)
+	} else {
+		fmt.Fprintf(out, "Attached %s to the next message.\n", uri)
+	}
+	return nil
+}
+
+// prompt renders input when it is a prompt command, reporting whether it was one. The
+// missing required arguments are read from in, and a value ending with ? is completed
+// by the server when it has suggestions. It returns no messages when the prompt
+// couldn't be rendered.
+func (m *mcpCommands) prompt(ctx context.Context, out io.Writer, in *console, input string) ([]*chat.Message, bool) {
+	name, rest, _ := strings.Cut(input, " ")
+	server, promptName, ok := strings.Cut(strings.TrimPrefix(name, "/"), ":")
+	if !strings.HasPrefix(name, "/") || !ok || server == "" || promptName == "" {
+		return nil, false
+	}
+	messages, err := m.renderPrompt(ctx, out, in, server, promptName, rest)
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return nil, true
+	}
+	return messages, true
+}
+
+func (m *mcpCommands) renderPrompt(ctx context.Context, out io.Writer, in *console, server, name, rest string) ([]*chat.Message, error) {
+	if m.client == nil {
+		return nil, fmt.Errorf("no MCP servers configured")
+	}
+	p, err := m.client.FindPrompt(server, name)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := splitArgs(rest)
+	if err != nil {
+		return nil, err
+	}
+	args := map[string]string{}
+	for _, f := range fields {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("argument %q must be name=value", f)
+		}
+		if !hasArgument(p, k) {
+			return nil, fmt.Errorf("prompt %s:%s has no argument %s", server, p.Name, k)
+		}
+		args[k] = v
+	}
+
+	for _, arg := range p.Arguments {
+		value, ok := args[arg.Name]
+		switch {
+		case ok && strings.HasSuffix(value, "?"):
+			// The value is completed below.
+		case ok || !arg.Required:
+			continue
+		default:
+			suggestions, err := m.client.CompletePrompt(ctx, server, p.Name, arg.Name, "", args)
+			if err != nil {
+				return nil, err
+			}
+			printSuggestions(out, suggestions)
+		}
+		for {
+			if !strings.HasSuffix(value, "?") && value != "" {
+				break
+			}
+			if value != "" {
+				suggestions, err := m.client.CompletePrompt(ctx, server, p.Name, arg.Name, strings.TrimSuffix(value, "?"), args)
+				if err != nil {
+					return nil, err
+				}
+				// Without suggestions, the value is kept as typed, such as a question.
+				if len(suggestions) == 0 {
+					break
+				}
+				if len(suggestions) == 1 {
+					value = suggestions[0]
+					fmt.Fprintf(out, "%s=%s\n", arg.Name, value)
+					break
+				}
+				printSuggestions(out, suggestions)
+			}
+			label := arg.Name
+			if arg.Description != "" {
+				label += " (" + arg.Description + ")"
+			}
+			line, ok := in.Ask(label + ": ")
+			if !ok {
+				return nil, fmt.Errorf("prompt %s:%s canceled", server, p.Name)
+			}
+			value = strings.TrimSpace(line)
+			if value == "" && !arg.Required {
+				break
+			}
+		}
+		if value != "" {
+			args[arg.Name] = value
+		}
+	}
+
+	rendered, err := m.client.GetPrompt(ctx, server, p.Name, args)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*chat.Message, 0, len(rendered))
+	for _, msg := range rendered {
+		author := chat.AuthorUser
+		if msg.Role == "assistant" {
+			author = chat.AuthorModel
+		}
+		messages = append(messages, &chat.Message{Author: author, Text: msg.Text})
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("prompt %s:%s has no messages", server, p.Name)
+	}
+	return messages, nil
+}
+
+// hasArgument reports whether p takes the argument name.
+func hasArgument(p *mcp.Prompt, name string) bool {
+	for _, arg := range p.Arguments {
+		if arg.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitArgs splits s on spaces, keeping the spaces between double or single quotes,
+// which are removed.
+func splitArgs(s string) ([]string, error) {
+	var (
+		fields  []string
+		b       strings.Builder
+		quote   rune
+		inField bool
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			b.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, b.String())
+				b.Reset()
+				inField = false
+			}
+		default:
+			b.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inField {
+		fields = append(fields, b.String())
+	}
+	return fields, nil
+}
+
+// printSuggestions writes the first completions of an argument.
+func printSuggestions(out io.Writer, suggestions []string) {
+	if len(suggestions) == 0 {
+		return
+	}
+	more := ""
+	if len(suggestions) > maxSuggestions {
+		more = fmt.Sprintf(" and %d more", len(suggestions)-maxSuggestions)
+		suggestions = suggestions[:maxSuggestions]
+	}
+	fmt.Fprintf(out, "Suggestions: %s%s (end a value with ? to complete it)\n", strings.Join(suggestions, ", "), more)
+}
+
+// message returns input followed by the attached resources, which are sent once.
+func (m *mcpCommands) message(input string) string {
+	if len(m.attachments) == 0 {
+		return input
+	}
+	msg := input + "\n\n" + strings.Join(m.attachments, "\n")
+	m.attachments = nil
+	return msg
+}
+
+// samplingApproval asks the user to approve the completions requested by MCP servers.
+type samplingApproval struct {
+	in *console
+
+	mu sync.Mutex
+	// always are the servers whose requests are approved until the agent stops.
+	always map[string]bool
+}
+
+// approve shows req and asks whether to run it.
+func (a *samplingApproval) approve(ctx context.Context, req *mcp.SamplingRequest) bool {
+	a.mu.Lock()
+	always := a.always[req.Server]
+	a.mu.Unlock()
+	if always {
+		return true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n[MCP server %s requests a completion of up to %d tokens]\n", req.Server, req.MaxTokens)
+	if req.SystemPrompt != "" {
+		fmt.Fprintf(&b, "system: %s\n", shorten(req.SystemPrompt, maxSampledText))
+	}
+	for _, m := range req.Messages {
+		fmt.Fprintf(&b, "%s: %s\n", m.Role, shorten(m.Text, maxSampledText))
+	}
+	b.WriteString("Run it? [y]es, [n]o, [a]lways for this server: ")
+	answer, ok := a.in.Ask(b.String())
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	case "a", "always":
+		a.mu.Lock()
+		if a.always == nil {
+			a.always = map[string]bool{}
+		}
+		a.always[req.Server] = true
+		a.mu.Unlock()
+		return true
+	default:
+		return false
+	}
+}
+
+// shorten cuts s to max runes.
+func shorten(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max]) + "..."
+}
+
+// printResources writes a table of resources.
+func printResources(out io.Writer, resources []mcp.Resource) error {
+	if len(resources) == 0 {
+		_, err := fmt.Fprintln(out, "No resources.")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tURI\tNAME\tTYPE\tDESCRIPTION")
+	for _, r := range resources {
+		typ := r.MIMEType
+		if r.Template {
+			typ = "template"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Server, r.URI, r.Name, typ, r.Description)
+	}
+	return w.Flush()
+}
+
+// printPrompts writes a table of prompts, with their arguments. Optional arguments are
+// in brackets.
+func printPrompts(out io.Writer, prompts []mcp.Prompt) error {
+	if len(prompts) == 0 {
+		_, err := fmt.Fprintln(out, "No prompts.")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMMAND\tARGUMENTS\tDESCRIPTION")
+	for _, p := range prompts {
+		args := make([]string, len(p.Arguments))
+		for i, arg := range p.Arguments {
+			args[i] = arg.Name
+			if !arg.Required {
+				args[i] = "[" + arg.Name + "]"
+			}
+		}
+		fmt.Fprintf(w, "/%s:%s\t%s\t%s\n", p.Server, p.Name, strings.Join(args, " "), p.Description)
+	}
+	return w.Flush()
+}
+
+// printMCPStatus writes a table of the MCP servers, their connection and their tools.
+func printMCPStatus(out io.Writer, servers []mcp.ServerStatus) error {
+	if len(servers) == 0 {
+		_, err := fmt.Fprintln(out, "No MCP servers configured.")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tTRANSPORT\tSTATUS\tSINCE\tRECONNECTS\tSAMPLED TOKENS\tTOOLS\tERROR")
+	for _, s := range servers {
+		since := ""
+		if s.Status == mcp.StatusConnected {
+			since = s.ConnectedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			s.Name, s.Transport, s.Status, since, s.Reconnects, s.SampledTokens, tools(s.Tools), s.Error)
+	}
+	return w.Flush()
+}
+
+// tools lists the first tool names, followed by the count of the others.
+func tools(names []string) string {
+	const max = 5
+	if len(names) <= max {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:max], ", "), len(names)-max)
+}
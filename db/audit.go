@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aliphe/skipery/agent/audit"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type toolCall struct {
+	ID         string
+	ChatID     string `db:"chat_id"`
+	MessageID  string `db:"message_id"`
+	Function   string
+	Source     string
+	Args       string
+	ResultSize int `db:"result_size"`
+	Error      string
+	DurationMS int64 `db:"duration_ms"`
+	Approval   string
+	Cached     bool
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func (t *toolCall) audit() (*audit.ToolCall, error) {
+	var args map[string]any
+	if t.Args != "" {
+		if err := json.Unmarshal([]byte(t.Args), &args); err != nil {
+			return nil, fmt.Errorf("unmarshal args: %w", err)
+		}
+	}
+	return &audit.ToolCall{
+		ID:         t.ID,
+		ChatID:     t.ChatID,
+		MessageID:  t.MessageID,
+		Function:   t.Function,
+		Source:     t.Source,
+		Args:       args,
+		ResultSize: t.ResultSize,
+		Error:      t.Error,
+		Duration:   time.Duration(t.DurationMS) * time.Millisecond,
+		Approval:   audit.Approval(t.Approval),
+		Cached:     t.Cached,
+		CreatedAt:  t.CreatedAt,
+	}, nil
+}
+
+type AuditStore struct {
+	db *sqlx.DB
+}
+
+func NewAuditStore(db *sqlx.DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+// Ensure AuditStore implements audit.Store interface
+var _ audit.Store = (*AuditStore)(nil)
+
+// SaveToolCall appends a tool call to the audit log.
+func (s *AuditStore) SaveToolCall(ctx context.Context, call *audit.ToolCall) error {
+	args, err := json.Marshal(call.Args)
+	if err != nil {
+		return fmt.Errorf("marshal args: %w", err)
+	}
+	if call.ID == "" {
+		call.ID = uuid.New().String()
+	}
+	if call.CreatedAt.IsZero() {
+		call.CreatedAt = time.Now()
+	}
+	// Timestamps are stored in UTC, so that they compare as text in ListToolCalls.
+	if _, err := s.db.ExecContext(ctx, "INSERT INTO tool_calls (id, chat_id, message_id, function, source, args, result_size, error, duration_ms, approval, cached, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		call.ID, call.ChatID, call.MessageID, call.Function, call.Source, string(args), call.ResultSize, call.Error, call.Duration.Milliseconds(), string(call.Approval), call.Cached, call.CreatedAt.UTC()); err != nil {
+		return fmt.Errorf("insert tool call: %w", err)
+	}
+	return nil
+}
+
+// ListToolCalls returns the tool calls matching the filter, most recent first.
+func (s *AuditStore) ListToolCalls(ctx context.Context, filter audit.Filter) ([]*audit.ToolCall, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if filter.ChatID != "" {
+		where = append(where, "chat_id = ?")
+		args = append(args, filter.ChatID)
+	}
+	if filter.Function != "" {
+		where = append(where, "function = ?")
+		args = append(args, filter.Function)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+
+	query := "SELECT * FROM tool_calls"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	var t []*toolCall
+	if err := s.db.SelectContext(ctx, &t, query, args...); err != nil {
+		return nil, fmt.Errorf("fetch tool calls: %w", err)
+	}
+
+	out := make([]*audit.ToolCall, len(t))
+	for i, call := range t {
+		var err error
+		out[i], err = call.audit()
+		if err != nil {
+			return nil, fmt.Errorf("tool call: %w", err)
+		}
+	}
+	return out, nil
+}
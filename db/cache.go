@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aliphe/skipery/tool"
+	"github.com/jmoiron/sqlx"
+)
+
+type CacheStore struct {
+	db *sqlx.DB
+}
+
+func NewCacheStore(db *sqlx.DB) *CacheStore {
+	return &CacheStore{db: db}
+}
+
+// Ensure CacheStore implements tool.CacheStore interface
+var _ tool.CacheStore = (*CacheStore)(nil)
+
+// GetResult returns the cached result of key, unless it expired.
+func (s *CacheStore) GetResult(ctx context.Context, key string) (map[string]any, bool, error) {
+	var b []byte
+	err := s.db.GetContext(ctx, &b, "SELECT result FROM tool_cache WHERE key = ? AND expires_at > ?", key, time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("fetch cached result: %w", err)
+	}
+	var res map[string]any
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, false, fmt.Errorf("unmarshal cached result: %w", err)
+	}
+	return res, true, nil
+}
+
+// SaveResult caches a result until expiresAt, and drops the expired ones.
+func (s *CacheStore) SaveResult(ctx context.Context, key string, result map[string]any, expiresAt time.Time) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("marshal result: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM tool_cache WHERE expires_at <= ?", time.Now().UTC()); err != nil {
+		return fmt.Errorf("delete expired results: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "INSERT OR REPLACE INTO tool_cache (key, result, expires_at) VALUES (?, ?, ?)", key, b, expiresAt.UTC()); err != nil {
+		return fmt.Errorf("insert cached result: %w", err)
+	}
+	return nil
+}
@@ -41,6 +41,7 @@ func (m *message) chat() (*chat.Message, error) {
 		}
 	}
 	return &chat.Message{
+		ID:                m.ID,
 		Author:            chat.Author(m.Author),
 		Text:              m.Content,
 		FunctionCalls:     functionCalls,
@@ -96,8 +97,11 @@ func (s *ChatStore) SaveMessages(ctx context.Context, id string, messages []*cha
 		if err != nil {
 			return fmt.Errorf("marshal function responses: %w", err)
 		}
+		if msg.ID == "" {
+			msg.ID = uuid.New().String()
+		}
 		m := &message{
-			ID:                uuid.New().String(),
+			ID:                msg.ID,
 			ChatID:            id,
 			Author:            string(msg.Author),
 			FunctionCalls:     string(fc),
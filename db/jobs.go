@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aliphe/skipery/agent/jobs"
+	"github.com/jmoiron/sqlx"
+)
+
+type job struct {
+	ID         string
+	ChatID     string `db:"chat_id"`
+	Function   string
+	Args       string
+	Status     string
+	Result     sql.NullString
+	Error      string
+	CreatedAt  time.Time    `db:"created_at"`
+	FinishedAt sql.NullTime `db:"finished_at"`
+}
+
+func (j *job) job() (*jobs.Job, error) {
+	var args, result map[string]any
+	if j.Args != "" {
+		if err := json.Unmarshal([]byte(j.Args), &args); err != nil {
+			return nil, fmt.Errorf("unmarshal args: %w", err)
+		}
+	}
+	if j.Result.Valid && j.Result.String != "" {
+		if err := json.Unmarshal([]byte(j.Result.String), &result); err != nil {
+			return nil, fmt.Errorf("unmarshal result: %w", err)
+		}
+	}
+	return &jobs.Job{
+		ID:         j.ID,
+		ChatID:     j.ChatID,
+		Function:   j.Function,
+		Args:       args,
+		Status:     jobs.Status(j.Status),
+		Result:     result,
+		Error:      j.Error,
+		CreatedAt:  j.CreatedAt,
+		FinishedAt: j.FinishedAt.Time,
+	}, nil
+}
+
+type JobStore struct {
+	db *sqlx.DB
+}
+
+func NewJobStore(db *sqlx.DB) *JobStore {
+	return &JobStore{db: db}
+}
+
+// Ensure JobStore implements jobs.Store interface
+var _ jobs.Store = (*JobStore)(nil)
+
+// SaveJob inserts a job, or updates it when it exists.
+func (s *JobStore) SaveJob(ctx context.Context, j *jobs.Job) error {
+	args, err := json.Marshal(j.Args)
+	if err != nil {
+		return fmt.Errorf("marshal args: %w", err)
+	}
+	var result sql.NullString
+	if j.Result != nil {
+		b, err := json.Marshal(j.Result)
+		if err != nil {
+			return fmt.Errorf("marshal result: %w", err)
+		}
+		result = sql.NullString{String: string(b), Valid: true}
+	}
+	finishedAt := sql.NullTime{Time: j.FinishedAt, Valid: !j.FinishedAt.IsZero()}
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO jobs (id, chat_id, function, args, status, result, error, created_at, finished_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET status = excluded.status, result = excluded.result, error = excluded.error, finished_at = excluded.finished_at`,
+		j.ID, j.ChatID, j.Function, string(args), string(j.Status), result, j.Error, j.CreatedAt, finishedAt); err != nil {
+		return fmt.Errorf("save job: %w", err)
+	}
+	return nil
+}
+
+// GetJob returns a job by ID, nil when it doesn't exist.
+func (s *JobStore) GetJob(ctx context.Context, id string) (*jobs.Job, error) {
+	var j job
+	err := s.db.GetContext(ctx, &j, "SELECT * FROM jobs WHERE id = ?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetch job: %w", err)
+	}
+	return j.job()
+}
+
+// ListJobs returns the jobs matching the filter, most recent first.
+func (s *JobStore) ListJobs(ctx context.Context, filter jobs.Filter) ([]*jobs.Job, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if filter.ChatID != "" {
+		where = append(where, "chat_id = ?")
+		args = append(args, filter.ChatID)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, string(filter.Status))
+	}
+	query := "SELECT * FROM jobs"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC"
+
+	var js []*job
+	if err := s.db.SelectContext(ctx, &js, query, args...); err != nil {
+		return nil, fmt.Errorf("fetch jobs: %w", err)
+	}
+	out := make([]*jobs.Job, len(js))
+	for i, j := range js {
+		var err error
+		if out[i], err = j.job(); err != nil {
+			return nil, fmt.Errorf("job: %w", err)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS tool_calls_created_at;
+
+DROP INDEX IF EXISTS tool_calls_chat_id;
+
+DROP TABLE IF EXISTS tool_calls;
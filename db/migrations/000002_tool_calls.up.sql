@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS tool_calls (
+    id TEXT PRIMARY KEY,
+    chat_id TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    function TEXT NOT NULL,
+    source TEXT NOT NULL,
+    args BLOB,
+    result_size INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    approval TEXT NOT NULL,
+    -- UTC, in the format of the times saved by the sqlite3 driver, so that they compare as text.
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS tool_calls_chat_id ON tool_calls (chat_id);
+CREATE INDEX IF NOT EXISTS tool_calls_created_at ON tool_calls (created_at);
@@ -0,0 +1,5 @@
+ALTER TABLE tool_calls DROP COLUMN cached;
+
+DROP INDEX IF EXISTS tool_cache_expires_at;
+
+DROP TABLE IF EXISTS tool_cache;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS tool_cache (
+    key TEXT PRIMARY KEY,
+    result BLOB NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS tool_cache_expires_at ON tool_cache (expires_at);
+
+ALTER TABLE tool_calls ADD COLUMN cached BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS jobs_status;
+
+DROP INDEX IF EXISTS jobs_chat_id;
+
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id TEXT PRIMARY KEY,
+    chat_id TEXT NOT NULL,
+    function TEXT NOT NULL,
+    args BLOB,
+    status TEXT NOT NULL,
+    result BLOB,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS jobs_chat_id ON jobs (chat_id);
+
+CREATE INDEX IF NOT EXISTS jobs_status ON jobs (status);
@@ -2,7 +2,13 @@ module github.com/aliphe/skipery
 
 go 1.24.2
 
-require github.com/mattn/go-sqlite3 v1.14.22
+require (
+	github.com/google/jsonschema-go v0.3.0
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/shopspring/decimal v1.4.0
+	github.com/tetratelabs/wazero v1.8.2
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+)
 
 require (
 	cloud.google.com/go v0.116.0 // indirect
@@ -16,6 +22,7 @@ require (
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/crypto v0.36.0 // indirect
+	golang.org/x/oauth2 v0.30.0 // indirect
 	golang.org/x/sync v0.14.0 // indirect
 	google.golang.org/grpc v1.70.0 // indirect
 )
@@ -23,8 +30,8 @@ require (
 require (
 	github.com/google/uuid v1.6.0
 	github.com/jmoiron/sqlx v1.4.0
-	github.com/modelcontextprotocol/go-sdk v0.2.0
-	golang.org/x/net v0.38.0 // indirect
+	github.com/modelcontextprotocol/go-sdk v1.1.0
+	golang.org/x/net v0.38.0
 	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/genai v1.14.0
@@ -11,6 +11,8 @@ import (
 	"google.golang.org/genai"
 )
 
+const geminiModel = "gemini-2.0-flash"
+
 type Gemini struct {
 	cli *genai.Client
 }
@@ -21,6 +23,11 @@ func NewGemini(cli *genai.Client) *Gemini {
 	}
 }
 
+// Name returns the name of the model.
+func (g *Gemini) Name() string {
+	return geminiModel
+}
+
 func fromJSONSchema(sch jsonschema.JSONSchema) *genai.Schema {
 	props := make(map[string]*genai.Schema)
 	for k, prop := range sch.Properties {
@@ -73,6 +80,10 @@ func fromToolBelt(tb tool.ToolBelt) ([]*genai.Tool, error) {
 
 		var functionDeclarations []*genai.FunctionDeclaration
 		for _, fct := range t.Functions(context.Background()) {
+			// The tool belt can be a subset of the functions of its tools.
+			if tb[fct.ID] != t {
+				continue
+			}
 			functionDeclarations = append(functionDeclarations, &genai.FunctionDeclaration{
 				Name:        fct.ID,
 				Description: fct.Description,
@@ -150,19 +161,24 @@ func (g *Gemini) SendMessage(ctx context.Context, tb tool.ToolBelt, messages []*
 	ctx, cancel := context.WithTimeout(ctx, time.Second*60)
 	defer cancel()
 
-	content, err := g.cli.Models.GenerateContent(
-		ctx,
-		"gemini-2.0-flash",
-		history,
-		&genai.GenerateContentConfig{Tools: tools,
-			SystemInstruction: &genai.Content{
-				Parts: []*genai.Part{
-					{
-						Text: "You are a helpful assistant that showcases the proper use of system-provided tools, use them as much as possible.",
-					},
+	config := &genai.GenerateContentConfig{Tools: tools,
+		SystemInstruction: &genai.Content{
+			Parts: []*genai.Part{
+				{
+					Text: "You are a helpful assistant that showcases the proper use of system-provided tools, use them as much as possible.",
 				},
 			},
 		},
+	}
+	if n := chat.MaxTokens(ctx); n > 0 {
+		config.MaxOutputTokens = int32(n)
+	}
+
+	content, err := g.cli.Models.GenerateContent(
+		ctx,
+		geminiModel,
+		history,
+		config,
 	)
 	if err != nil {
 		return nil, err
@@ -173,6 +189,9 @@ func (g *Gemini) SendMessage(ctx context.Context, tb tool.ToolBelt, messages []*
 		Author: chat.AuthorModel,
 		Text:   content.Text(),
 	}
+	if content.UsageMetadata != nil {
+		res.Tokens = int(content.UsageMetadata.CandidatesTokenCount)
+	}
 
 	for _, fc := range content.FunctionCalls() {
 		res.FunctionCalls = append(res.FunctionCalls, chat.FunctionCall{
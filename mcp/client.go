@@ -2,113 +2,450 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
 	"os/exec"
-	"strings"
+	"reflect"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/aliphe/skipery/pkg/jsonschema"
 	"github.com/aliphe/skipery/tool"
-	mcpjson "github.com/modelcontextprotocol/go-sdk/jsonschema"
+	mcpjson "github.com/google/jsonschema-go/jsonschema"
 	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
+// Transports of MCP servers.
+const (
+	TransportStdio          = "stdio"
+	TransportSSE            = "sse"
+	TransportStreamableHTTP = "streamable-http"
+)
+
+// Config describes an MCP server, started as a command or reached at a URL. String
+// fields can reference environment variables as ${NAME}.
 type Config struct {
-	Name    string
-	Command string   `json:"command"`
-	Args    []string `json:"args"`
-	url     string
+	Name string
+	// Transport is stdio, sse or streamable-http. It defaults to stdio for commands and
+	// streamable-http for URLs.
+	Transport string            `json:"transport"`
+	Command   string            `json:"command"`
+	Args      []string          `json:"args"`
+	Env       map[string]string `json:"env"`
+	Cwd       string            `json:"cwd"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	// Token is sent as a bearer token to servers reached at a URL.
+	Token    string `json:"token"`
+	Disabled bool   `json:"disabled"`
+	// Sampling lets the server request completions from the model of the agent. It is
+	// disabled when nil.
+	Sampling *SamplingConfig `json:"sampling"`
+	// transport, when set, is used instead of the transport described by the other
+	// fields, such as to connect to an in-process server.
+	transport mcpsdk.Transport
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolate replaces the ${NAME} references of s with environment variables.
+func interpolate(s string) (string, error) {
+	var err error
+	s = envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRef.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v
+	})
+	return s, err
+}
+
+// Resolve interpolates environment variables and checks the transport of the server.
+func (cfg *Config) Resolve() error {
+	var err error
+	expand := func(s *string) {
+		if err == nil {
+			*s, err = interpolate(*s)
+		}
+	}
+	expand(&cfg.Command)
+	for i := range cfg.Args {
+		expand(&cfg.Args[i])
+	}
+	for k, v := range cfg.Env {
+		expand(&v)
+		cfg.Env[k] = v
+	}
+	expand(&cfg.Cwd)
+	expand(&cfg.URL)
+	for k, v := range cfg.Headers {
+		expand(&v)
+		cfg.Headers[k] = v
+	}
+	expand(&cfg.Token)
+	if err != nil {
+		return fmt.Errorf("MCP server %s: %w", cfg.Name, err)
+	}
+
+	if err := cfg.Sampling.resolve(); err != nil {
+		return fmt.Errorf("MCP server %s: %w", cfg.Name, err)
+	}
+
+	if cfg.Transport == "" {
+		cfg.Transport = TransportStdio
+		if cfg.URL != "" {
+			cfg.Transport = TransportStreamableHTTP
+		}
+	}
+	switch cfg.Transport {
+	case TransportStdio:
+		if cfg.Command == "" {
+			return fmt.Errorf("MCP server %s: the stdio transport requires a command", cfg.Name)
+		}
+	case TransportSSE, TransportStreamableHTTP:
+		u, err := url.Parse(cfg.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("MCP server %s: the %s transport requires an http or https url", cfg.Name, cfg.Transport)
+		}
+	default:
+		return fmt.Errorf("MCP server %s: unknown transport %q, expected stdio, sse or streamable-http", cfg.Name, cfg.Transport)
+	}
+	return nil
 }
 
 type Client struct {
-	cli      *mcpsdk.Client
-	sessions []*Session
+	cli       *mcpsdk.Client
+	artifacts tool.ArtifactStore
+	resources *resourceTool
+
+	mu                sync.Mutex
+	sessions          []*Session
+	onResourceUpdated func(server, uri string)
+	onToolsChanged    func()
+	sampler           Sampler
+	approveSampling   func(ctx context.Context, req *SamplingRequest) bool
 }
 
-func NewClient() *Client {
-	cli := mcpsdk.NewClient(&mcpsdk.Implementation{
+// NewClient creates a client of MCP servers, saving the binary content of their results
+// in artifacts. Binary content is dropped when artifacts is nil.
+func NewClient(artifacts tool.ArtifactStore) *Client {
+	c := &Client{artifacts: artifacts}
+	c.resources = &resourceTool{client: c}
+	c.cli = mcpsdk.NewClient(&mcpsdk.Implementation{
 		Name:    "agent leaf",
 		Version: "0.0.1",
-	}, nil)
+	}, &mcpsdk.ClientOptions{
+		ResourceUpdatedHandler:   c.resourceUpdated,
+		ToolListChangedHandler:   c.toolListChanged,
+		PromptListChangedHandler: c.promptListChanged,
+		CreateMessageHandler:     c.createMessage,
+	})
+	return c
+}
 
-	return &Client{
-		cli: cli,
+// Connect connects to the server described by cfg, which must be resolved, and
+// supervises it. The server is kept when the connection fails, reporting the error in
+// its status and retrying in the background. Disabled servers are only reported.
+func (c *Client) Connect(ctx context.Context, cfg *Config) error {
+	s := &Session{
+		name:      cfg.Name,
+		cfg:       cfg,
+		cli:       c.cli,
+		artifacts: c.artifacts,
+		changed:   c.toolsChanged,
+		status:    StatusConnecting,
+		done:      make(chan struct{}),
 	}
+	c.mu.Lock()
+	c.sessions = append(c.sessions, s)
+	c.mu.Unlock()
+	if cfg.Disabled {
+		s.status = StatusDisabled
+		return nil
+	}
+
+	err := s.connect(ctx)
+	go s.supervise()
+	return err
 }
 
-func (c *Client) Connect(ctx context.Context, cfg *Config) error {
-	var t mcpsdk.Transport
-	switch {
-	case cfg.Command != "":
-		t = mcpsdk.NewCommandTransport(exec.Command(cfg.Command, cfg.Args...))
-	case cfg.url != "":
-		t = mcpsdk.NewSSEClientTransport(cfg.url, nil)
+// transport returns a new transport to the server described by cfg.
+func transport(cfg *Config) (mcpsdk.Transport, error) {
+	if cfg.transport != nil {
+		return cfg.transport, nil
+	}
+	switch cfg.Transport {
+	case TransportStdio:
+		cmd := exec.Command(cfg.Command, cfg.Args...)
+		cmd.Dir = cfg.Cwd
+		cmd.Env = os.Environ()
+		for k, v := range cfg.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		return &mcpsdk.CommandTransport{Command: cmd}, nil
+	case TransportSSE:
+		return &mcpsdk.SSEClientTransport{Endpoint: cfg.URL, HTTPClient: httpClient(cfg)}, nil
+	case TransportStreamableHTTP:
+		return &mcpsdk.StreamableClientTransport{Endpoint: cfg.URL, HTTPClient: httpClient(cfg)}, nil
 	default:
-		return fmt.Errorf("invalid command for MCP server %s", cfg.Name)
+		return nil, fmt.Errorf("invalid transport for MCP server %s", cfg.Name)
 	}
-	s, err := c.cli.Connect(ctx, t)
-	if err != nil {
-		return err
+}
+
+// httpClient returns a client sending the headers and token of cfg with every request.
+func httpClient(cfg *Config) *http.Client {
+	headers := http.Header{}
+	for k, v := range cfg.Headers {
+		headers.Set(k, v)
 	}
-	c.sessions = append(c.sessions, &Session{session: s})
-	return nil
+	if cfg.Token != "" {
+		headers.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	return &http.Client{Transport: &headerTransport{headers: headers, base: http.DefaultTransport}}
+}
+
+type headerTransport struct {
+	headers http.Header
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header[k] = v
+	}
+	return t.base.RoundTrip(req)
 }
 
+// Tools returns the sessions of the servers that aren't disabled, connected or not, and
+// the tool of their resources.
 func (c *Client) Tools() []tool.Tool {
 	if c == nil {
 		return nil
 	}
+	sessions := c.enabled()
+	if len(sessions) == 0 {
+		return nil
+	}
 	// Manual conversion is required because []ConcreteType and []Interface have different
 	// memory layouts in Go.
-	out := make([]tool.Tool, 0)
-	for _, s := range c.sessions {
+	out := make([]tool.Tool, 0, len(sessions)+1)
+	for _, s := range sessions {
 		out = append(out, s)
 	}
+	return append(out, c.resources)
+}
+
+// enabled returns the sessions of the servers that aren't disabled.
+func (c *Client) enabled() []*Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []*Session
+	for _, s := range c.sessions {
+		if !s.cfg.Disabled {
+			out = append(out, s)
+		}
+	}
 	return out
 }
 
+// Status returns the status of every server, in the order they were added.
+func (c *Client) Status() []ServerStatus {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]ServerStatus, len(c.sessions))
+	for i, s := range c.sessions {
+		out[i] = s.Status()
+	}
+	return out
+}
+
+// Close stops supervising the servers and closes their sessions.
+func (c *Client) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	sessions := slices.Clone(c.sessions)
+	c.mu.Unlock()
+	var errs []error
+	for _, s := range sessions {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Session is the connection to an MCP server. It lasts across reconnections, so that
+// it stays the tool of the server functions.
 type Session struct {
+	name string
+	cfg  *Config
+	cli  *mcpsdk.Client
+	// artifacts keeps the binary content of results
+	artifacts tool.ArtifactStore
+	// changed is called when the functions of the server change.
+	changed func()
+	// done is closed when the session is closed.
+	done chan struct{}
+
+	mu      sync.Mutex
 	session *mcpsdk.ClientSession
+	// cancel ends the context of the connection of session.
+	cancel      context.CancelFunc
+	status      Status
+	err         error
+	connectedAt time.Time
+	reconnects  int
+	// functions are the functions listed when the server last connected.
+	functions []tool.Function
+	// prompts are the prompts listed when the server last connected.
+	prompts []Prompt
+	// subscriptions are the URIs of the resources subscribed to.
+	subscriptions []string
+	// sampledTokens counts the tokens generated for the sampling requests of the server.
+	sampledTokens int
+}
+
+// Name returns the name of the MCP server the session is connected to.
+func (s *Session) Name() string {
+	return s.name
+}
+
+// current returns the session of the server when it is connected.
+func (s *Session) current() (*mcpsdk.ClientSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != StatusConnected {
+		if s.err != nil {
+			return nil, fmt.Errorf("MCP server %s is %s: %w", s.name, s.status, s.err)
+		}
+		return nil, fmt.Errorf("MCP server %s is %s", s.name, s.status)
+	}
+	return s.session, nil
 }
 
 // Call executes a function on the MCP session.
 func (s *Session) Call(ctx context.Context, function string, args map[string]any) (map[string]any, error) {
-	res, err := s.session.CallTool(ctx, &mcpsdk.CallToolParams{
+	session, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	res, err := session.CallTool(ctx, &mcpsdk.CallToolParams{
 		Name:      function,
 		Arguments: args,
 	})
 	if err != nil {
 		return nil, err
 	}
+	return s.result(ctx, res)
+}
 
-	cs := make([]string, 0, len(res.Content))
-	for _, content := range res.Content {
-		b, _ := content.MarshalJSON()
-		cs = append(cs, string(b))
+// Functions returns the functions listed when the server last connected, so that they
+// are kept while it reconnects. The functions of a server that failed to connect are
+// added once it connects, reported to the handler set with OnToolsChanged.
+func (s *Session) Functions(ctx context.Context) []tool.Function {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.functions
+}
+
+// setFunctions replaces the functions of the server, reporting when they changed.
+func (s *Session) setFunctions(functions []tool.Function) {
+	s.mu.Lock()
+	changed := !reflect.DeepEqual(s.functions, functions)
+	s.functions = functions
+	s.mu.Unlock()
+	if changed && s.changed != nil {
+		s.changed()
 	}
+}
 
-	return map[string]any{
-		"result": strings.Join(cs, ", "),
-	}, nil
+// OnToolsChanged sets the function called when the functions of a server change, such
+// as when it connects after failing to, so that they can be registered again.
+func (c *Client) OnToolsChanged(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onToolsChanged = fn
 }
 
-// Functions returns a list of functions that the MCP session can perform.
-func (s *Session) Functions(ctx context.Context) []tool.Function {
-	res, err := s.session.ListTools(ctx, nil)
+func (c *Client) toolsChanged() {
+	c.mu.Lock()
+	fn := c.onToolsChanged
+	c.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// toolListChanged lists the functions of a server again when it reports a change.
+func (c *Client) toolListChanged(ctx context.Context, req *mcpsdk.ToolListChangedRequest) {
+	s := c.sessionOf(req.Session)
+	if s == nil {
+		return
+	}
+	functions, err := listFunctions(ctx, req.Session)
 	if err != nil {
-		return nil
+		slog.Warn("list tools of MCP server", "server", s.name, "error", err)
+		return
 	}
+	s.setFunctions(functions)
+}
 
-	tools := make([]tool.Function, 0, len(res.Tools))
-	for _, t := range res.Tools {
-		tools = append(tools, tool.Function{
+// capabilities returns the capabilities the server announced.
+func capabilities(session *mcpsdk.ClientSession) *mcpsdk.ServerCapabilities {
+	if res := session.InitializeResult(); res != nil && res.Capabilities != nil {
+		return res.Capabilities
+	}
+	return &mcpsdk.ServerCapabilities{}
+}
+
+// listFunctions lists the functions of the server.
+func listFunctions(ctx context.Context, session *mcpsdk.ClientSession) ([]tool.Function, error) {
+	var functions []tool.Function
+	if capabilities(session).Tools == nil {
+		return nil, nil
+	}
+	for t, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			return nil, err
+		}
+		functions = append(functions, tool.Function{
 			ID:          t.Name,
 			DisplayName: t.Title,
 			Description: t.Description,
-			Parameters:  toJSONSchema(t.InputSchema),
-			Response:    toJSONSchema(t.OutputSchema),
+			Parameters:  toJSONSchema(decodeSchema(t.InputSchema)),
+			Response:    toJSONSchema(decodeSchema(t.OutputSchema)),
 		})
 	}
-	return tools
+	return functions, nil
+}
+
+// decodeSchema decodes a schema received from a server, nil when it is invalid.
+func decodeSchema(v any) *mcpjson.Schema {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var sch mcpjson.Schema
+	if err := json.Unmarshal(b, &sch); err != nil {
+		return nil
+	}
+	return &sch
 }
 
 func toJSONSchema(sch *mcpjson.Schema) jsonschema.JSONSchema {
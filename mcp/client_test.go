@@ -0,0 +1,399 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliphe/skipery/tool"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type addInput struct {
+	A int `json:"a" jsonschema:"the first number"`
+	B int `json:"b" jsonschema:"the second number"`
+}
+
+type addOutput struct {
+	Sum int `json:"sum"`
+}
+
+type echoInput struct {
+	Text string `json:"text"`
+}
+
+// newServer returns a server with tools returning structured content, text, images
+// and errors.
+func newServer() *mcpsdk.Server {
+	server := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	mcpsdk.AddTool(server, &mcpsdk.Tool{Name: "add", Title: "Add", Description: "Adds two numbers"},
+		func(ctx context.Context, req *mcpsdk.CallToolRequest, in addInput) (*mcpsdk.CallToolResult, addOutput, error) {
+			return nil, addOutput{Sum: in.A + in.B}, nil
+		})
+	mcpsdk.AddTool(server, &mcpsdk.Tool{Name: "echo", Description: "Echoes a text"},
+		func(ctx context.Context, req *mcpsdk.CallToolRequest, in echoInput) (*mcpsdk.CallToolResult, any, error) {
+			return &mcpsdk.CallToolResult{Content: []mcpsdk.Content{&mcpsdk.TextContent{Text: in.Text}}}, nil, nil
+		})
+	mcpsdk.AddTool(server, &mcpsdk.Tool{Name: "image", Description: "Returns an image"},
+		func(ctx context.Context, req *mcpsdk.CallToolRequest, in struct{}) (*mcpsdk.CallToolResult, any, error) {
+			return &mcpsdk.CallToolResult{Content: []mcpsdk.Content{&mcpsdk.ImageContent{MIMEType: "image/png", Data: []byte("png")}}}, nil, nil
+		})
+	mcpsdk.AddTool(server, &mcpsdk.Tool{Name: "fail", Description: "Always fails"},
+		func(ctx context.Context, req *mcpsdk.CallToolRequest, in struct{}) (*mcpsdk.CallToolResult, any, error) {
+			return nil, nil, errors.New("out of order")
+		})
+	return server
+}
+
+// connect connects c to server under name through in-memory transports.
+func connect(t *testing.T, c *Client, name string, server *mcpsdk.Server) {
+	t.Helper()
+	clientTransport, serverTransport := mcpsdk.NewInMemoryTransports()
+	ctx := context.Background()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Connect(ctx, &Config{Name: name, transport: clientTransport}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigResolve(t *testing.T) {
+	t.Setenv("MCP_TEST_HOST", "mcp.example.com")
+	t.Setenv("MCP_TEST_TOKEN", "secret")
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    Config
+		wantErr string
+	}{
+		{
+			name: "command",
+			cfg:  Config{Name: "fs", Command: "mcp-fs", Args: []string{"--root", "${MCP_TEST_HOST}"}},
+			want: Config{Name: "fs", Transport: TransportStdio, Command: "mcp-fs", Args: []string{"--root", "mcp.example.com"}},
+		},
+		{
+			name: "url",
+			cfg:  Config{Name: "remote", URL: "https://${MCP_TEST_HOST}/mcp", Token: "${MCP_TEST_TOKEN}", Headers: map[string]string{"X-Token": "${MCP_TEST_TOKEN}"}},
+			want: Config{Name: "remote", Transport: TransportStreamableHTTP, URL: "https://mcp.example.com/mcp", Token: "secret", Headers: map[string]string{"X-Token": "secret"}},
+		},
+		{
+			name: "sse",
+			cfg:  Config{Name: "remote", Transport: TransportSSE, URL: "http://localhost:8080/sse"},
+			want: Config{Name: "remote", Transport: TransportSSE, URL: "http://localhost:8080/sse"},
+		},
+		{
+			name:    "unset variable",
+			cfg:     Config{Name: "fs", Command: "mcp-fs", Env: map[string]string{"KEY": "${MCP_TEST_UNSET}"}},
+			wantErr: "MCP server fs: environment variable MCP_TEST_UNSET is not set",
+		},
+		{
+			name:    "stdio without command",
+			cfg:     Config{Name: "fs", Transport: TransportStdio},
+			wantErr: "the stdio transport requires a command",
+		},
+		{
+			name:    "invalid url",
+			cfg:     Config{Name: "remote", Transport: TransportSSE, URL: "ftp://example.com"},
+			wantErr: "the sse transport requires an http or https url",
+		},
+		{
+			name:    "unknown transport",
+			cfg:     Config{Name: "remote", Transport: "websocket", URL: "http://example.com"},
+			wantErr: `unknown transport "websocket"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Resolve()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.cfg, tt.want) {
+				t.Errorf("Resolve() = %+v, want %+v", tt.cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientTools(t *testing.T) {
+	c := NewClient(nil)
+	defer c.Close()
+	connect(t, c, "math", newServer())
+
+	other := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "other", Version: "1.0.0"}, nil)
+	mcpsdk.AddTool(other, &mcpsdk.Tool{Name: "greet", Description: "Greets someone"},
+		func(ctx context.Context, req *mcpsdk.CallToolRequest, in struct{}) (*mcpsdk.CallToolResult, any, error) {
+			return &mcpsdk.CallToolResult{Content: []mcpsdk.Content{&mcpsdk.TextContent{Text: "hello"}}}, nil, nil
+		})
+	connect(t, c, "greeter", other)
+
+	status := c.Status()
+	if len(status) != 2 {
+		t.Fatalf("Status() returned %d servers, want 2", len(status))
+	}
+	for _, st := range status {
+		if st.Status != StatusConnected {
+			t.Errorf("server %s is %s, want connected", st.Name, st.Status)
+		}
+	}
+	if want := []string{"add", "echo", "fail", "image"}; !reflect.DeepEqual(sorted(status[0].Tools), want) {
+		t.Errorf("tools of math = %v, want %v", status[0].Tools, want)
+	}
+
+	// The functions are named after the tools, their tool being the session of their
+	// server.
+	tools := c.Tools()
+	if len(tools) != 3 {
+		t.Fatalf("Tools() returned %d tools, want the 2 servers and the resource tool", len(tools))
+	}
+	belt := tool.NewToolBelt(tools...)
+	for fn, server := range map[string]string{"add": "math", "echo": "math", "greet": "greeter"} {
+		named, ok := belt[fn].(interface{ Name() string })
+		if !ok || named.Name() != server {
+			t.Errorf("function %s belongs to %v, want server %s", fn, belt[fn], server)
+		}
+	}
+
+	var add tool.Function
+	for _, fn := range tools[0].Functions(context.Background()) {
+		if fn.ID == "add" {
+			add = fn
+		}
+	}
+	if add.DisplayName != "Add" || add.Description != "Adds two numbers" {
+		t.Errorf("add is described as %q: %q", add.DisplayName, add.Description)
+	}
+	if add.Parameters.Type != "object" || add.Parameters.Properties["a"].Type != "integer" || add.Parameters.Properties["a"].Description != "the first number" {
+		t.Errorf("parameters of add = %+v", add.Parameters)
+	}
+	if add.Response.Properties["sum"].Type != "integer" {
+		t.Errorf("response of add = %+v", add.Response)
+	}
+}
+
+func TestClientCall(t *testing.T) {
+	c := NewClient(nil)
+	defer c.Close()
+	connect(t, c, "math", newServer())
+	session := c.Tools()[0]
+
+	tests := []struct {
+		name    string
+		fn      string
+		args    map[string]any
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "structured",
+			fn:   "add",
+			args: map[string]any{"a": 2, "b": 3},
+			want: map[string]any{"sum": 5.0},
+		},
+		{
+			name: "text",
+			fn:   "echo",
+			args: map[string]any{"text": "hi"},
+			want: map[string]any{"content": []map[string]any{{"type": "text", "text": "hi"}}},
+		},
+		{
+			name: "image",
+			fn:   "image",
+			want: map[string]any{"content": []map[string]any{{
+				"type":      "image",
+				"mime_type": "image/png",
+				"size":      3,
+				"omitted":   "binary content isn't kept without an artifact store",
+			}}},
+		},
+		{name: "error", fn: "fail", wantErr: "out of order"},
+		{name: "invalid arguments", fn: "add", args: map[string]any{"a": "two"}, wantErr: "invalid params"},
+		{name: "unknown tool", fn: "subtract", wantErr: `unknown tool "subtract"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := session.Call(context.Background(), tt.fn, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Call() = %v, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Call() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	// Calls fail once the server is closed.
+	c.Close()
+	if _, err := session.Call(context.Background(), "echo", map[string]any{"text": "hi"}); err == nil || !strings.Contains(err.Error(), "MCP server math is closed") {
+		t.Errorf("Call() after Close = %v, want a closed error", err)
+	}
+}
+
+func TestClientToolListChanged(t *testing.T) {
+	c := NewClient(nil)
+	defer c.Close()
+	changed := make(chan struct{}, 1)
+	c.OnToolsChanged(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	server := newServer()
+	connect(t, c, "math", server)
+	// Connecting lists the functions for the first time.
+	<-changed
+
+	mcpsdk.AddTool(server, &mcpsdk.Tool{Name: "negate", Description: "Negates a number"},
+		func(ctx context.Context, req *mcpsdk.CallToolRequest, in struct {
+			N int `json:"n"`
+		}) (*mcpsdk.CallToolResult, addOutput, error) {
+			return nil, addOutput{Sum: -in.N}, nil
+		})
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported after the server added a tool")
+	}
+	if tools := c.Status()[0].Tools; !slices.Contains(tools, "negate") {
+		t.Errorf("tools = %v, want negate listed", tools)
+	}
+}
+
+func TestClientHTTP(t *testing.T) {
+	t.Setenv("MCP_TEST_TOKEN", "secret")
+	server := newServer()
+	handlers := map[string]http.Handler{
+		TransportStreamableHTTP: mcpsdk.NewStreamableHTTPHandler(func(*http.Request) *mcpsdk.Server { return server }, nil),
+		TransportSSE:            mcpsdk.NewSSEHandler(func(*http.Request) *mcpsdk.Server { return server }, nil),
+	}
+	for transport, handler := range handlers {
+		t.Run(transport, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Team") != "agents" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				handler.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+			// The client keeps the event stream of SSE open.
+			defer srv.CloseClientConnections()
+
+			cfg := &Config{Name: "remote", Transport: transport, URL: srv.URL, Token: "${MCP_TEST_TOKEN}", Headers: map[string]string{"X-Team": "agents"}}
+			if err := cfg.Resolve(); err != nil {
+				t.Fatal(err)
+			}
+			c := NewClient(nil)
+			if err := c.Connect(context.Background(), cfg); err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.Tools()[0].Call(context.Background(), "add", map[string]any{"a": 1, "b": 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, map[string]any{"sum": 2.0}) {
+				t.Errorf("Call() = %v, want a sum of 2", got)
+			}
+
+			// Without the token, the server refuses the connection.
+			if err := NewClient(nil).Connect(context.Background(), &Config{Name: "remote", Transport: transport, URL: srv.URL}); err == nil {
+				t.Error("Connect() without a token succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestClientResources(t *testing.T) {
+	server := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "notes", Version: "1.0.0"}, &mcpsdk.ServerOptions{
+		SubscribeHandler:   func(context.Context, *mcpsdk.SubscribeRequest) error { return nil },
+		UnsubscribeHandler: func(context.Context, *mcpsdk.UnsubscribeRequest) error { return nil },
+	})
+	read := func(ctx context.Context, req *mcpsdk.ReadResourceRequest) (*mcpsdk.ReadResourceResult, error) {
+		return &mcpsdk.ReadResourceResult{Contents: []*mcpsdk.ResourceContents{
+			{URI: req.Params.URI, MIMEType: "text/plain", Text: "buy milk"},
+		}}, nil
+	}
+	server.AddResource(&mcpsdk.Resource{URI: "file:///todo.txt", Name: "todo", Description: "The todo list", MIMEType: "text/plain"}, read)
+	server.AddResourceTemplate(&mcpsdk.ResourceTemplate{URITemplate: "file:///{path}", Name: "file"}, read)
+
+	c := NewClient(nil)
+	defer c.Close()
+	updated := make(chan string, 1)
+	c.OnResourceUpdated(func(server, uri string) { updated <- server + " " + uri })
+	connect(t, c, "notes", server)
+	belt := tool.NewToolBelt(c.Tools()...)
+	ctx := context.Background()
+
+	got, err := belt.Call(ctx, "list_resources", map[string]any{"query": "TODO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"resources": []map[string]any{{"server": "notes", "name": "todo", "uri": "file:///todo.txt", "description": "The todo list", "mime_type": "text/plain"}},
+		"truncated": false,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("list_resources = %v, want %v", got, want)
+	}
+	got, err = belt.Call(ctx, "list_resources", map[string]any{"server": "notes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resources := got["resources"].([]map[string]any); len(resources) != 2 || resources[1]["uri_template"] != "file:///{path}" {
+		t.Errorf("list_resources = %v, want the resource and the template", got)
+	}
+
+	got, err = belt.Call(ctx, "read_resource", map[string]any{"server": "notes", "uri": "file:///todo.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]any{"contents": []map[string]any{{"type": "resource", "uri": "file:///todo.txt", "mime_type": "text/plain", "text": "buy milk"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read_resource = %v, want %v", got, want)
+	}
+	if _, err := belt.Call(ctx, "read_resource", map[string]any{"server": "other", "uri": "file:///todo.txt"}); err == nil || !strings.Contains(err.Error(), "unknown MCP server other") {
+		t.Errorf("reading on an unknown server = %v, want an unknown server error", err)
+	}
+
+	ok, err := c.Subscribe(ctx, "notes", "file:///todo.txt")
+	if err != nil || !ok {
+		t.Fatalf("Subscribe() = %v, %v, want a subscription", ok, err)
+	}
+	if err := server.ResourceUpdated(ctx, &mcpsdk.ResourceUpdatedNotificationParams{URI: "file:///todo.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case u := <-updated:
+		if u != "notes file:///todo.txt" {
+			t.Errorf("update of %q, want notes file:///todo.txt", u)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update reported after the resource changed")
+	}
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
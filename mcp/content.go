@@ -0,0 +1,119 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// result converts the result of an MCP tool into the result of a function. Structured
+// content is returned as is. Otherwise the content items are listed under content,
+// with their binary data saved as artifacts. Results flagged as errors are returned as
+// errors.
+func (s *Session) result(ctx context.Context, res *mcpsdk.CallToolResult) (map[string]any, error) {
+	if res.IsError {
+		var texts []string
+		for _, c := range res.Content {
+			if t, ok := c.(*mcpsdk.TextContent); ok && t.Text != "" {
+				texts = append(texts, t.Text)
+			}
+		}
+		if len(texts) == 0 {
+			return nil, errors.New("the tool reported an error without a message")
+		}
+		return nil, errors.New(strings.Join(texts, "\n"))
+	}
+
+	// Structured content is the result described by the output schema of the tool, checked
+	// against the response schema of the function.
+	if structured, ok := res.StructuredContent.(map[string]any); ok {
+		return structured, nil
+	}
+
+	content := make([]map[string]any, 0, len(res.Content))
+	for _, c := range res.Content {
+		item, err := s.content(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, item)
+	}
+	return map[string]any{"content": content}, nil
+}
+
+// content converts a content item of a result.
+func (s *Session) content(ctx context.Context, c mcpsdk.Content) (map[string]any, error) {
+	switch c := c.(type) {
+	case *mcpsdk.TextContent:
+		return map[string]any{"type": "text", "text": c.Text}, nil
+	case *mcpsdk.ImageContent:
+		return s.binary(ctx, "image", c.MIMEType, c.Data)
+	case *mcpsdk.AudioContent:
+		return s.binary(ctx, "audio", c.MIMEType, c.Data)
+	case *mcpsdk.ResourceLink:
+		item := map[string]any{"type": "resource_link", "uri": c.URI, "name": c.Name}
+		setNonEmpty(item, "title", c.Title)
+		setNonEmpty(item, "description", c.Description)
+		setNonEmpty(item, "mime_type", c.MIMEType)
+		if c.Size != nil {
+			item["size"] = *c.Size
+		}
+		return item, nil
+	case *mcpsdk.EmbeddedResource:
+		if c.Resource == nil {
+			return nil, errors.New("embedded resource without contents")
+		}
+		return s.resourceContents(ctx, c.Resource)
+	default:
+		return nil, fmt.Errorf("unsupported content %T", c)
+	}
+}
+
+// resourceContents converts the contents of a resource, keeping text inline and saving
+// blobs as artifacts.
+func (s *Session) resourceContents(ctx context.Context, rc *mcpsdk.ResourceContents) (map[string]any, error) {
+	var item map[string]any
+	if rc.Blob != nil {
+		var err error
+		if item, err = s.binary(ctx, "resource", rc.MIMEType, rc.Blob); err != nil {
+			return nil, err
+		}
+	} else {
+		text := rc.Text
+		item = map[string]any{"type": "resource"}
+		if len(text) > maxResourceText {
+			text = text[:maxResourceText]
+			item["truncated"] = true
+		}
+		item["text"] = text
+		setNonEmpty(item, "mime_type", rc.MIMEType)
+	}
+	item["uri"] = rc.URI
+	return item, nil
+}
+
+// binary saves binary data in the artifact store, describing it without the data.
+func (s *Session) binary(ctx context.Context, typ, mimeType string, data []byte) (map[string]any, error) {
+	item := map[string]any{"type": typ, "size": len(data)}
+	setNonEmpty(item, "mime_type", mimeType)
+	if s.artifacts == nil {
+		item["omitted"] = "binary content isn't kept without an artifact store"
+		return item, nil
+	}
+	a, err := s.artifacts.SaveArtifact(ctx, mimeType, data)
+	if err != nil {
+		return nil, fmt.Errorf("save %s of MCP server %s: %w", typ, s.name, err)
+	}
+	item["artifact_id"] = a.ID
+	item["path"] = a.Path
+	return item, nil
+}
+
+func setNonEmpty(m map[string]any, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
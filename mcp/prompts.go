@@ -0,0 +1,188 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Prompt is a prompt template published by an MCP server, such as a code review
+// request, turned into messages from its arguments.
+type Prompt struct {
+	Server      string
+	Name        string
+	Title       string
+	Description string
+	Arguments   []PromptArgument
+}
+
+// PromptArgument is an argument of a prompt.
+type PromptArgument struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// PromptMessage is a message of a prompt, from the user or the assistant.
+type PromptMessage struct {
+	// Role is user or assistant.
+	Role string
+	Text string
+}
+
+// listPrompts lists the prompts of the server.
+func listPrompts(ctx context.Context, server string, session *mcpsdk.ClientSession) ([]Prompt, error) {
+	if capabilities(session).Prompts == nil {
+		return nil, nil
+	}
+	var prompts []Prompt
+	for p, err := range session.Prompts(ctx, nil) {
+		if err != nil {
+			return nil, err
+		}
+		prompt := Prompt{Server: server, Name: p.Name, Title: p.Title, Description: p.Description}
+		for _, arg := range p.Arguments {
+			prompt.Arguments = append(prompt.Arguments, PromptArgument{
+				Name:        arg.Name,
+				Description: arg.Description,
+				Required:    arg.Required,
+			})
+		}
+		prompts = append(prompts, prompt)
+	}
+	return prompts, nil
+}
+
+// promptListChanged lists the prompts of a server again when it reports a change.
+func (c *Client) promptListChanged(ctx context.Context, req *mcpsdk.PromptListChangedRequest) {
+	s := c.sessionOf(req.Session)
+	if s == nil {
+		return
+	}
+	prompts, err := listPrompts(ctx, s.name, req.Session)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.prompts = prompts
+	s.mu.Unlock()
+}
+
+// Prompts returns the prompts of the servers, as listed when they last connected.
+func (c *Client) Prompts() []Prompt {
+	if c == nil {
+		return nil
+	}
+	var prompts []Prompt
+	for _, s := range c.enabled() {
+		s.mu.Lock()
+		prompts = append(prompts, s.prompts...)
+		s.mu.Unlock()
+	}
+	return prompts
+}
+
+// GetPrompt renders a prompt of a server with args. Images and audio are saved as
+// artifacts, referenced in the text of their message.
+func (c *Client) GetPrompt(ctx context.Context, server, name string, args map[string]string) ([]PromptMessage, error) {
+	s, err := c.session(server)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	res, err := session.GetPrompt(ctx, &mcpsdk.GetPromptParams{Name: name, Arguments: args})
+	if err != nil {
+		return nil, fmt.Errorf("get prompt %s of MCP server %s: %w", name, server, err)
+	}
+	messages := make([]PromptMessage, 0, len(res.Messages))
+	for _, m := range res.Messages {
+		if m.Content == nil {
+			continue
+		}
+		item, err := s.content(ctx, m.Content)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, PromptMessage{Role: string(m.Role), Text: contentText(item)})
+	}
+	return messages, nil
+}
+
+// contentText renders a content item as the text of a message.
+func contentText(item map[string]any) string {
+	if text, ok := item["text"].(string); ok {
+		if uri, ok := item["uri"].(string); ok {
+			return fmt.Sprintf("Resource %s:\n%s", uri, text)
+		}
+		return text
+	}
+	if item["type"] == "resource_link" {
+		return fmt.Sprintf("Resource %v (%v)", item["uri"], item["name"])
+	}
+	if path, ok := item["path"].(string); ok {
+		return fmt.Sprintf("[%v %v, %v bytes, saved as %s]", item["type"], item["mime_type"], item["size"], path)
+	}
+	return fmt.Sprintf("[%v %v, %v bytes, omitted]", item["type"], item["mime_type"], item["size"])
+}
+
+// CompletePrompt returns the values suggested by a server for an argument of a prompt,
+// starting with value. The other arguments already known give context to the server.
+// It returns nil when the server doesn't complete arguments.
+func (c *Client) CompletePrompt(ctx context.Context, server, prompt, arg, value string, args map[string]string) ([]string, error) {
+	s, err := c.session(server)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	if capabilities(session).Completions == nil {
+		return nil, nil
+	}
+	res, err := session.Complete(ctx, &mcpsdk.CompleteParams{
+		Ref:      &mcpsdk.CompleteReference{Type: "ref/prompt", Name: prompt},
+		Argument: mcpsdk.CompleteParamsArgument{Name: arg, Value: value},
+		Context:  &mcpsdk.CompleteContext{Arguments: args},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("complete %s of prompt %s: %w", arg, prompt, err)
+	}
+	return res.Completion.Values, nil
+}
+
+// FindPrompt returns the prompt of a server named name, or the only one whose name
+// starts with it.
+func (c *Client) FindPrompt(server, name string) (*Prompt, error) {
+	var matches []Prompt
+	for _, p := range c.Prompts() {
+		if p.Server != server {
+			continue
+		}
+		if p.Name == name {
+			return &p, nil
+		}
+		if strings.HasPrefix(p.Name, name) {
+			matches = append(matches, p)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("unknown prompt %s:%s", server, name)
+	case 1:
+		return &matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, p := range matches {
+			names[i] = p.Name
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("prompt %s:%s is ambiguous: %s", server, name, strings.Join(names, ", "))
+	}
+}
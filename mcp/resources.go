@@ -0,0 +1,371 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+	"github.com/aliphe/skipery/tool"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// maxResourceText caps the text of a resource returned inline.
+	maxResourceText = 100_000
+	// maxListedResources caps the resources returned by list_resources.
+	maxListedResources = 200
+)
+
+// Resource is a resource of an MCP server, such as a file or a record, or a template of
+// resource URIs.
+type Resource struct {
+	Server string
+	// URI identifies the resource. Templates have a URI template instead, such as
+	// file:///{path}, to fill in before reading.
+	URI         string
+	Template    bool
+	Name        string
+	Title       string
+	Description string
+	MIMEType    string
+	Size        int64
+}
+
+// resources lists the resources and resource templates of the server.
+func (s *Session) resources(ctx context.Context) ([]Resource, error) {
+	session, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	if capabilities(session).Resources == nil {
+		return nil, nil
+	}
+	var out []Resource
+	for r, err := range session.Resources(ctx, nil) {
+		if err != nil {
+			return nil, fmt.Errorf("list resources of MCP server %s: %w", s.name, err)
+		}
+		out = append(out, Resource{
+			Server:      s.name,
+			URI:         r.URI,
+			Name:        r.Name,
+			Title:       r.Title,
+			Description: r.Description,
+			MIMEType:    r.MIMEType,
+			Size:        r.Size,
+		})
+	}
+	for t, err := range session.ResourceTemplates(ctx, nil) {
+		if err != nil {
+			return nil, fmt.Errorf("list resource templates of MCP server %s: %w", s.name, err)
+		}
+		out = append(out, Resource{
+			Server:      s.name,
+			URI:         t.URITemplate,
+			Template:    true,
+			Name:        t.Name,
+			Title:       t.Title,
+			Description: t.Description,
+			MIMEType:    t.MIMEType,
+		})
+	}
+	return out, nil
+}
+
+// readResource reads a resource of the server, saving binary contents as artifacts.
+func (s *Session) readResource(ctx context.Context, uri string) ([]map[string]any, error) {
+	session, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+	res, err := session.ReadResource(ctx, &mcpsdk.ReadResourceParams{URI: uri})
+	if err != nil {
+		return nil, fmt.Errorf("read %s on MCP server %s: %w", uri, s.name, err)
+	}
+	contents := make([]map[string]any, 0, len(res.Contents))
+	for _, rc := range res.Contents {
+		item, err := s.resourceContents(ctx, rc)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, item)
+	}
+	return contents, nil
+}
+
+// subscribe subscribes to the updates of a resource, when the server supports it. The
+// subscription is renewed when the server reconnects.
+func (s *Session) subscribe(ctx context.Context, uri string) (bool, error) {
+	session, err := s.current()
+	if err != nil {
+		return false, err
+	}
+	if caps := capabilities(session).Resources; caps == nil || !caps.Subscribe {
+		return false, nil
+	}
+	if err := session.Subscribe(ctx, &mcpsdk.SubscribeParams{URI: uri}); err != nil {
+		return false, fmt.Errorf("subscribe to %s on MCP server %s: %w", uri, s.name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Contains(s.subscriptions, uri) {
+		s.subscriptions = append(s.subscriptions, uri)
+	}
+	return true, nil
+}
+
+// resubscribe renews the subscriptions of the session after a reconnection.
+func (s *Session) resubscribe(ctx context.Context, session *mcpsdk.ClientSession) {
+	s.mu.Lock()
+	uris := slices.Clone(s.subscriptions)
+	s.mu.Unlock()
+	for _, uri := range uris {
+		if err := session.Subscribe(ctx, &mcpsdk.SubscribeParams{URI: uri}); err != nil {
+			slog.Warn("renew MCP resource subscription", "server", s.name, "uri", uri, "error", err)
+		}
+	}
+}
+
+// session returns the session of a server.
+func (c *Client) session(server string) (*Session, error) {
+	for _, s := range c.enabled() {
+		if s.name == server {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown MCP server %s", server)
+}
+
+// sessionOf returns the session of the server connected through session, nil when it
+// is unknown.
+func (c *Client) sessionOf(session *mcpsdk.ClientSession) *Session {
+	for _, s := range c.enabled() {
+		s.mu.Lock()
+		current := s.session
+		s.mu.Unlock()
+		if current == session {
+			return s
+		}
+	}
+	return nil
+}
+
+// ListResources lists the resources and resource templates of a server, or of every
+// connected server when server is empty.
+func (c *Client) ListResources(ctx context.Context, server string) ([]Resource, error) {
+	if server != "" {
+		s, err := c.session(server)
+		if err != nil {
+			return nil, err
+		}
+		return s.resources(ctx)
+	}
+	var out []Resource
+	for _, s := range c.enabled() {
+		if s.Status().Status != StatusConnected {
+			continue
+		}
+		resources, err := s.resources(ctx)
+		if err != nil {
+			slog.Warn("list MCP resources", "server", s.name, "error", err)
+			continue
+		}
+		out = append(out, resources...)
+	}
+	return out, nil
+}
+
+// ReadResource reads a resource of a server. Text is returned inline, binary contents
+// are saved as artifacts.
+func (c *Client) ReadResource(ctx context.Context, server, uri string) ([]map[string]any, error) {
+	s, err := c.session(server)
+	if err != nil {
+		return nil, err
+	}
+	return s.readResource(ctx, uri)
+}
+
+// Subscribe subscribes to the updates of a resource, reported to the handler set with
+// OnResourceUpdated. It reports false when the server doesn't support subscriptions.
+func (c *Client) Subscribe(ctx context.Context, server, uri string) (bool, error) {
+	s, err := c.session(server)
+	if err != nil {
+		return false, err
+	}
+	return s.subscribe(ctx, uri)
+}
+
+// OnResourceUpdated sets the function called when a subscribed resource is updated.
+func (c *Client) OnResourceUpdated(fn func(server, uri string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onResourceUpdated = fn
+}
+
+// resourceUpdated dispatches an update notification to the handler.
+func (c *Client) resourceUpdated(ctx context.Context, req *mcpsdk.ResourceUpdatedNotificationRequest) {
+	c.mu.Lock()
+	fn := c.onResourceUpdated
+	c.mu.Unlock()
+	if s := c.sessionOf(req.Session); fn != nil && s != nil {
+		fn(s.name, req.Params.URI)
+	}
+}
+
+var _ tool.Tool = (*resourceTool)(nil)
+
+// resourceTool gives the model access to the resources of the MCP servers.
+type resourceTool struct {
+	client *Client
+}
+
+func (t *resourceTool) Name() string {
+	return "mcp_resources"
+}
+
+func (t *resourceTool) Functions(ctx context.Context) []tool.Function {
+	server := jsonschema.JSONSchema{
+		Type:        "string",
+		Description: "The name of the MCP server, as returned by list_resources",
+		Examples:    []any{"linear", "github"},
+	}
+	return []tool.Function{
+		{
+			ID:          "list_resources",
+			DisplayName: "List Resources",
+			Description: "Lists the resources exposed by the connected MCP servers, such as files, records or documents, and the templates of resource URIs. Use this function to find a resource before reading it with read_resource.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for listing resources",
+				Properties: map[string]jsonschema.JSONSchema{
+					"server": server,
+					"query": {
+						Type:        "string",
+						Description: "Only returns the resources whose URI, name or description contain this text, ignoring case",
+						Examples:    []any{"readme", "roadmap"},
+					},
+				},
+				PropertyOrdering: []string{"server", "query"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The resources found",
+				Properties: map[string]jsonschema.JSONSchema{
+					"resources": {
+						Type:        "array",
+						Description: "The resources, and the templates of resource URIs to fill in before reading",
+						Items: &jsonschema.JSONSchema{
+							Type: "object",
+							Properties: map[string]jsonschema.JSONSchema{
+								"server":       {Type: "string", Description: "The MCP server of the resource"},
+								"uri":          {Type: "string", Description: "The URI of the resource"},
+								"uri_template": {Type: "string", Description: "The URI template, such as file:///{path}, for templates"},
+								"name":         {Type: "string", Description: "The name of the resource"},
+								"description":  {Type: "string", Description: "What the resource contains"},
+								"mime_type":    {Type: "string", Description: "The MIME type of the resource"},
+								"size":         {Type: "integer", Description: "The size of the resource in bytes"},
+							},
+						},
+					},
+					"truncated": {Type: "boolean", Description: "Whether more resources matched"},
+				},
+			},
+		},
+		{
+			ID:          "read_resource",
+			DisplayName: "Read Resource",
+			Description: "Reads a resource of an MCP server by URI. Text is returned inline, and binary contents such as images are saved as files whose path is returned. Use this function to read the resources found with list_resources, filling in the templates.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for reading a resource",
+				Properties: map[string]jsonschema.JSONSchema{
+					"server": server,
+					"uri": {
+						Type:        "string",
+						Description: "The URI of the resource",
+						Examples:    []any{"file:///project/README.md", "linear://issues/ENG-123"},
+					},
+				},
+				Required:         []string{"server", "uri"},
+				PropertyOrdering: []string{"server", "uri"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The contents of the resource",
+				Properties: map[string]jsonschema.JSONSchema{
+					"contents": {
+						Type:        "array",
+						Description: "The contents of the resource and its sub-resources",
+						Items: &jsonschema.JSONSchema{
+							Type: "object",
+							Properties: map[string]jsonschema.JSONSchema{
+								"uri":         {Type: "string", Description: "The URI of the content"},
+								"mime_type":   {Type: "string", Description: "The MIME type of the content"},
+								"text":        {Type: "string", Description: "The text of the content"},
+								"truncated":   {Type: "boolean", Description: "Whether the text was cut"},
+								"artifact_id": {Type: "string", Description: "The artifact holding binary content"},
+								"path":        {Type: "string", Description: "The file of the artifact"},
+								"size":        {Type: "integer", Description: "The size of binary content in bytes"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *resourceTool) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	server, _ := params["server"].(string)
+	switch fn {
+	case "list_resources":
+		resources, err := t.client.ListResources(ctx, server)
+		if err != nil {
+			return nil, err
+		}
+		query, _ := params["query"].(string)
+		query = strings.ToLower(query)
+		out := []map[string]any{}
+		truncated := false
+		for _, r := range resources {
+			if query != "" && !strings.Contains(strings.ToLower(r.URI+"\n"+r.Name+"\n"+r.Title+"\n"+r.Description), query) {
+				continue
+			}
+			if len(out) == maxListedResources {
+				truncated = true
+				break
+			}
+			item := map[string]any{"server": r.Server, "name": r.Name}
+			if r.Template {
+				item["uri_template"] = r.URI
+			} else {
+				item["uri"] = r.URI
+			}
+			setNonEmpty(item, "description", r.Description)
+			setNonEmpty(item, "mime_type", r.MIMEType)
+			if r.Size > 0 {
+				item["size"] = r.Size
+			}
+			out = append(out, item)
+		}
+		return map[string]any{"resources": out, "truncated": truncated}, nil
+	case "read_resource":
+		uri, ok := params["uri"].(string)
+		if !ok || uri == "" {
+			return nil, fmt.Errorf("uri parameter must be a non-empty string")
+		}
+		if server == "" {
+			return nil, fmt.Errorf("server parameter must be a non-empty string")
+		}
+		contents, err := t.client.ReadResource(ctx, server, uri)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"contents": contents}, nil
+	default:
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+}
@@ -0,0 +1,163 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Approvals of sampling requests.
+const (
+	// SamplingApprovalAsk asks the user before running each request.
+	SamplingApprovalAsk  = "ask"
+	SamplingApprovalAuto = "auto"
+)
+
+// defaultSamplingMaxTokens caps the completions of servers setting no limit.
+const defaultSamplingMaxTokens = 1000
+
+// SamplingConfig sets how a server can request completions from the model of the agent.
+type SamplingConfig struct {
+	// Approval is ask, the default, to ask the user before running each request, or
+	// auto to run them without asking.
+	Approval string `json:"approval"`
+	// MaxTokens caps the tokens of a completion, 1000 by default. Requests asking for
+	// more are cut to this limit.
+	MaxTokens int `json:"maxTokens"`
+	// MaxTotalTokens caps the tokens generated for the server since the start of the
+	// agent. It is unlimited when 0.
+	MaxTotalTokens int `json:"maxTotalTokens"`
+}
+
+// resolve sets the defaults of cfg and checks it.
+func (cfg *SamplingConfig) resolve() error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Approval == "" {
+		cfg.Approval = SamplingApprovalAsk
+	}
+	if cfg.Approval != SamplingApprovalAsk && cfg.Approval != SamplingApprovalAuto {
+		return fmt.Errorf("unknown sampling approval %q, expected ask or auto", cfg.Approval)
+	}
+	if cfg.MaxTokens < 0 || cfg.MaxTotalTokens < 0 {
+		return errors.New("sampling token limits can't be negative")
+	}
+	if cfg.MaxTokens == 0 {
+		cfg.MaxTokens = defaultSamplingMaxTokens
+	}
+	return nil
+}
+
+// SamplingRequest is a completion requested by a server.
+type SamplingRequest struct {
+	Server       string
+	SystemPrompt string
+	Messages     []PromptMessage
+	// MaxTokens is the limit of generated tokens, within the limits of the server.
+	MaxTokens int
+}
+
+// SamplingResult is the completion of a SamplingRequest.
+type SamplingResult struct {
+	Text  string
+	Model string
+	// Tokens is the number of generated tokens, 0 when the model doesn't report it.
+	Tokens int
+}
+
+// Sampler runs the completions requested by servers.
+type Sampler interface {
+	Sample(ctx context.Context, req *SamplingRequest) (*SamplingResult, error)
+}
+
+// SetSampler sets the sampler running the completions requested by servers, and the
+// function approving the requests of the servers whose approval is ask. These requests
+// are declined when approve is nil.
+func (c *Client) SetSampler(sampler Sampler, approve func(ctx context.Context, req *SamplingRequest) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sampler = sampler
+	c.approveSampling = approve
+}
+
+// createMessage runs a sampling request of a server, within its token limits.
+func (c *Client) createMessage(ctx context.Context, req *mcpsdk.CreateMessageRequest) (*mcpsdk.CreateMessageResult, error) {
+	c.mu.Lock()
+	sampler, approve := c.sampler, c.approveSampling
+	c.mu.Unlock()
+	s := c.sessionOf(req.Session)
+	if s == nil {
+		return nil, errors.New("sampling request from an unknown MCP session")
+	}
+	cfg := s.cfg.Sampling
+	if cfg == nil || sampler == nil {
+		return nil, fmt.Errorf("sampling is not enabled for MCP server %s", s.name)
+	}
+
+	r := &SamplingRequest{
+		Server:       s.name,
+		SystemPrompt: req.Params.SystemPrompt,
+		MaxTokens:    cfg.MaxTokens,
+	}
+	if n := int(req.Params.MaxTokens); n > 0 && n < r.MaxTokens {
+		r.MaxTokens = n
+	}
+	for _, m := range req.Params.Messages {
+		text, ok := m.Content.(*mcpsdk.TextContent)
+		if !ok {
+			return nil, fmt.Errorf("sampling supports text messages only, got %T", m.Content)
+		}
+		r.Messages = append(r.Messages, PromptMessage{Role: string(m.Role), Text: text.Text})
+	}
+
+	// The tokens of the request are reserved until the model reports how many it used,
+	// so that concurrent requests can't exceed the budget.
+	s.mu.Lock()
+	if cfg.MaxTotalTokens > 0 {
+		left := cfg.MaxTotalTokens - s.sampledTokens
+		if left <= 0 {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("MCP server %s used its sampling budget of %d tokens", s.name, cfg.MaxTotalTokens)
+		}
+		r.MaxTokens = min(r.MaxTokens, left)
+	}
+	s.sampledTokens += r.MaxTokens
+	s.mu.Unlock()
+	used := 0
+	defer func() {
+		s.mu.Lock()
+		s.sampledTokens += used - r.MaxTokens
+		s.mu.Unlock()
+	}()
+
+	if cfg.Approval != SamplingApprovalAuto && (approve == nil || !approve(ctx, r)) {
+		return nil, fmt.Errorf("the user declined the sampling request of MCP server %s", s.name)
+	}
+	res, err := sampler.Sample(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("sample for MCP server %s: %w", s.name, err)
+	}
+	// Without a count from the model, the request uses its whole limit.
+	used = res.Tokens
+	if used == 0 {
+		used = r.MaxTokens
+	}
+
+	model := res.Model
+	if model == "" {
+		model = "unknown"
+	}
+	stopReason := "endTurn"
+	if res.Tokens >= r.MaxTokens {
+		stopReason = "maxTokens"
+	}
+	return &mcpsdk.CreateMessageResult{
+		Content:    &mcpsdk.TextContent{Text: res.Text},
+		Model:      model,
+		Role:       "assistant",
+		StopReason: stopReason,
+	}, nil
+}
@@ -0,0 +1,246 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aliphe/skipery/tool"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// connectTimeout bounds connecting to a server and listing its tools.
+	connectTimeout = 30 * time.Second
+	// pingInterval is the time between two pings of a connected server, which is
+	// reconnected when a ping fails or takes longer than pingTimeout.
+	pingInterval = 30 * time.Second
+	pingTimeout  = 10 * time.Second
+	// Reconnections are attempted after minBackoff, doubling up to maxBackoff.
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// Status is the state of the connection to an MCP server.
+type Status string
+
+const (
+	StatusConnecting   Status = "connecting"
+	StatusConnected    Status = "connected"
+	StatusReconnecting Status = "reconnecting"
+	// StatusFailed is the status of a server that couldn't connect, retried in the
+	// background.
+	StatusFailed   Status = "failed"
+	StatusDisabled Status = "disabled"
+	StatusClosed   Status = "closed"
+)
+
+// ServerStatus describes an MCP server and its connection.
+type ServerStatus struct {
+	Name      string
+	Transport string
+	Status    Status
+	// Error is the last connection error, set while the server isn't connected.
+	Error string
+	// ConnectedAt is the time of the last successful connection.
+	ConnectedAt time.Time
+	// Reconnects counts the connections lost since the start of the agent.
+	Reconnects int
+	// Tools are the names of the functions of the server.
+	Tools []string
+	// SampledTokens counts the tokens generated for the sampling requests of the server.
+	SampledTokens int
+}
+
+// Status returns the status of the server.
+func (s *Session) Status() ServerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := ServerStatus{
+		Name:          s.name,
+		Transport:     s.cfg.Transport,
+		Status:        s.status,
+		ConnectedAt:   s.connectedAt,
+		Reconnects:    s.reconnects,
+		SampledTokens: s.sampledTokens,
+	}
+	if s.err != nil && s.status != StatusConnected {
+		st.Error = s.err.Error()
+	}
+	for _, fn := range s.functions {
+		st.Tools = append(st.Tools, fn.ID)
+	}
+	return st
+}
+
+// connect opens a new session to the server and lists its functions.
+func (s *Session) connect(ctx context.Context) error {
+	// Transports keep streams open with the context they connect with, so it lasts as
+	// long as the connection. A timer bounds connecting instead.
+	connCtx, cancelConn := context.WithCancel(context.WithoutCancel(ctx))
+	timer := time.AfterFunc(connectTimeout, cancelConn)
+	defer timer.Stop()
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	var functions []tool.Function
+	err := func() error {
+		t, err := transport(s.cfg)
+		if err != nil {
+			return err
+		}
+		session, err := s.cli.Connect(connCtx, t, nil)
+		if err != nil {
+			return fmt.Errorf("connect to MCP server %s: %w", s.name, err)
+		}
+		if !timer.Stop() {
+			session.Close()
+			return fmt.Errorf("connect to MCP server %s: %w", s.name, context.DeadlineExceeded)
+		}
+		functions, err = listFunctions(ctx, session)
+		if err != nil {
+			session.Close()
+			return fmt.Errorf("list tools of MCP server %s: %w", s.name, err)
+		}
+		prompts, err := listPrompts(ctx, s.name, session)
+		if err != nil {
+			session.Close()
+			return fmt.Errorf("list prompts of MCP server %s: %w", s.name, err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.closed() {
+			session.Close()
+			return fmt.Errorf("MCP server %s is closed", s.name)
+		}
+		if s.cancel != nil {
+			s.cancel()
+		}
+		s.session = session
+		s.cancel = cancelConn
+		s.status = StatusConnected
+		s.err = nil
+		s.connectedAt = time.Now()
+		s.prompts = prompts
+		return nil
+	}()
+	if err == nil {
+		s.mu.Lock()
+		session := s.session
+		s.mu.Unlock()
+		s.setFunctions(functions)
+		s.resubscribe(ctx, session)
+	}
+	if err != nil {
+		cancelConn()
+		s.mu.Lock()
+		if !s.closed() {
+			s.status = StatusFailed
+			s.err = err
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// supervise watches the connection to the server until the session is closed,
+// reconnecting with an exponential backoff when it is lost.
+func (s *Session) supervise() {
+	backoff := minBackoff
+	for {
+		s.mu.Lock()
+		session := s.session
+		connected := s.status == StatusConnected
+		s.mu.Unlock()
+		if connected {
+			err := s.watch(session)
+			if s.closed() {
+				return
+			}
+			slog.Warn("MCP server connection lost", "server", s.name, "error", err)
+			s.mu.Lock()
+			s.status = StatusReconnecting
+			s.err = err
+			s.reconnects++
+			s.mu.Unlock()
+			backoff = minBackoff
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-time.After(backoff):
+		}
+		if err := s.connect(context.Background()); err != nil {
+			backoff = min(2*backoff, maxBackoff)
+			slog.Warn("reconnect MCP server", "server", s.name, "retry_in", backoff, "error", err)
+			continue
+		}
+		slog.Info("MCP server reconnected", "server", s.name)
+	}
+}
+
+// watch pings session until it fails, returning why, or until the session is closed.
+func (s *Session) watch(session *mcpsdk.ClientSession) error {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- session.Wait()
+	}()
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case err := <-closed:
+			if err == nil {
+				err = errors.New("the server closed the connection")
+			}
+			return err
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+			err := session.Ping(ctx, nil)
+			cancel()
+			if err != nil {
+				session.Close()
+				return fmt.Errorf("ping: %w", err)
+			}
+		}
+	}
+}
+
+func (s *Session) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops supervising the server and closes its session.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	if s.closed() {
+		s.mu.Unlock()
+		return nil
+	}
+	close(s.done)
+	session := s.session
+	if s.status != StatusDisabled {
+		s.status = StatusClosed
+	}
+	cancel := s.cancel
+	s.mu.Unlock()
+	// The session is closed without the lock, which its notification handlers may need.
+	if cancel != nil {
+		defer cancel()
+	}
+	if session != nil {
+		return session.Close()
+	}
+	return nil
+}
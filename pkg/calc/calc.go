@@ -0,0 +1,608 @@
+// Package calc evaluates arithmetic expressions with arbitrary-precision decimals.
+//
+// Expressions support the + - * / ^ operators, parentheses, percentages (15% is 0.15),
+// the pi and e constants, caller-provided variables and the functions listed in
+// Functions. A % followed by a number, a name or a parenthesis is a modulo instead:
+// 10 % 3 is 1. Nothing but arithmetic can be expressed, which makes it safe to
+// evaluate untrusted input.
+package calc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+// Precision is the number of decimal places kept by divisions and irrational functions.
+const Precision = 32
+
+// guardDigits are extra decimal places computed by inexact operations before rounding
+// their result to Precision.
+const guardDigits = 8
+
+// maxExponent bounds the integer powers computed exactly, by repeated multiplication.
+// Larger powers are computed with logarithms, like fractional ones.
+const maxExponent = 10000
+
+// maxDigits bounds the digits of the integer part of every operand and result, so that
+// a single expression can't exhaust memory or time, such as nested powers.
+const maxDigits = 1000
+
+// Error reports a malformed or invalid expression.
+type Error struct {
+	// Pos is the byte offset of the error in the expression
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+type function struct {
+	args int
+	// optional counts trailing arguments that can be omitted
+	optional int
+	call     func(args []decimal.Decimal) (decimal.Decimal, error)
+}
+
+var functions = map[string]function{
+	"abs":   {args: 1, call: func(a []decimal.Decimal) (decimal.Decimal, error) { return a[0].Abs(), nil }},
+	"sqrt":  {args: 1, call: func(a []decimal.Decimal) (decimal.Decimal, error) { return sqrt(a[0]) }},
+	"exp":   {args: 1, call: func(a []decimal.Decimal) (decimal.Decimal, error) { return exp(a[0]) }},
+	"ln":    {args: 1, call: func(a []decimal.Decimal) (decimal.Decimal, error) { return ln(a[0]) }},
+	"log":   {args: 2, optional: 1, call: log},
+	"sin":   {args: 1, call: float(math.Sin)},
+	"cos":   {args: 1, call: float(math.Cos)},
+	"tan":   {args: 1, call: float(math.Tan)},
+	"asin":  {args: 1, call: float(math.Asin)},
+	"acos":  {args: 1, call: float(math.Acos)},
+	"atan":  {args: 1, call: float(math.Atan)},
+	"round": {args: 2, optional: 1, call: round},
+	"floor": {args: 1, call: func(a []decimal.Decimal) (decimal.Decimal, error) { return a[0].Floor(), nil }},
+	"ceil":  {args: 1, call: func(a []decimal.Decimal) (decimal.Decimal, error) { return a[0].Ceil(), nil }},
+	"mod":   {args: 2, call: mod},
+	"min":   {args: 2, call: func(a []decimal.Decimal) (decimal.Decimal, error) { return decimal.Min(a[0], a[1]), nil }},
+	"max":   {args: 2, call: func(a []decimal.Decimal) (decimal.Decimal, error) { return decimal.Max(a[0], a[1]), nil }},
+}
+
+var constants = map[string]decimal.Decimal{
+	"pi": decimal.RequireFromString("3.14159265358979323846264338327950288"),
+	"e":  decimal.RequireFromString("2.71828182845904523536028747135266250"),
+}
+
+// Functions lists the names of the supported functions.
+func Functions() []string {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Evaluate computes the value of expr. Identifiers are looked up in vars, then in the
+// pi and e constants.
+func Evaluate(expr string, vars map[string]decimal.Decimal) (decimal.Decimal, error) {
+	p := &parser{input: expr, vars: vars}
+	if err := p.next(); err != nil {
+		return decimal.Zero, err
+	}
+	if p.tok.kind == tokenEOF {
+		return decimal.Zero, &Error{Pos: 0, Msg: "empty expression"}
+	}
+	v, err := p.expression()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if p.tok.kind != tokenEOF {
+		return decimal.Zero, p.unexpected()
+	}
+	return v, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	input string
+	pos   int
+	tok   token
+	vars  map[string]decimal.Decimal
+}
+
+// next reads the following token into p.tok.
+func (p *parser) next() error {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.tok = token{kind: tokenEOF, pos: start}
+		return nil
+	}
+
+	c := p.input[p.pos]
+	switch {
+	case isDigit(c) || c == '.':
+		for p.pos < len(p.input) && (isDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		// Exponent, as in 1.5e-3
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			end := p.pos + 1
+			if end < len(p.input) && (p.input[end] == '+' || p.input[end] == '-') {
+				end++
+			}
+			if end < len(p.input) && isDigit(p.input[end]) {
+				for end < len(p.input) && isDigit(p.input[end]) {
+					end++
+				}
+				p.pos = end
+			}
+		}
+		p.tok = token{kind: tokenNumber, text: p.input[start:p.pos], pos: start}
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.input) && (p.input[p.pos] == '_' || unicode.IsLetter(rune(p.input[p.pos])) || isDigit(p.input[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokenIdent, text: p.input[start:p.pos], pos: start}
+	case strings.ContainsRune("+-*/^%(),", rune(c)):
+		p.pos++
+		p.tok = token{kind: tokenOperator, text: string(c), pos: start}
+	default:
+		return &Error{Pos: start, Msg: fmt.Sprintf("unexpected character %q", c)}
+	}
+	return nil
+}
+
+func (p *parser) is(op string) bool {
+	return p.tok.kind == tokenOperator && p.tok.text == op
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return &Error{Pos: p.tok.pos, Msg: "unexpected end of expression"}
+	}
+	return &Error{Pos: p.tok.pos, Msg: fmt.Sprintf("unexpected %q", p.tok.text)}
+}
+
+// expression parses additions and subtractions.
+func (p *parser) expression() (decimal.Decimal, error) {
+	v, err := p.term()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	for p.is("+") || p.is("-") {
+		op, pos := p.tok.text, p.tok.pos
+		if err := p.next(); err != nil {
+			return decimal.Zero, err
+		}
+		r, err := p.term()
+		if err != nil {
+			return decimal.Zero, err
+		}
+		if op == "+" {
+			v = v.Add(r)
+		} else {
+			v = v.Sub(r)
+		}
+		if v, err = bound(v); err != nil {
+			return decimal.Zero, &Error{Pos: pos, Msg: err.Error()}
+		}
+	}
+	return v, nil
+}
+
+// term parses multiplications, divisions and modulos.
+func (p *parser) term() (decimal.Decimal, error) {
+	v, err := p.unary()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	for p.is("*") || p.is("/") || p.is("%") {
+		op := p.tok
+		if err := p.next(); err != nil {
+			return decimal.Zero, err
+		}
+		r, err := p.unary()
+		if err != nil {
+			return decimal.Zero, err
+		}
+		switch {
+		case op.text == "*":
+			// The product has as many digits as its operands together.
+			if intDigits(v)+intDigits(r) > maxDigits+1 {
+				return decimal.Zero, &Error{Pos: op.pos, Msg: tooLarge().Error()}
+			}
+			v = v.Mul(r)
+		case r.IsZero():
+			return decimal.Zero, &Error{Pos: op.pos, Msg: "division by zero"}
+		case op.text == "/":
+			v = v.DivRound(r, Precision)
+		default:
+			v = v.Mod(r)
+		}
+		if v, err = bound(v); err != nil {
+			return decimal.Zero, &Error{Pos: op.pos, Msg: err.Error()}
+		}
+	}
+	return v, nil
+}
+
+// unary parses signs, which bind looser than powers: -2^2 is -4.
+func (p *parser) unary() (decimal.Decimal, error) {
+	if p.is("-") || p.is("+") {
+		neg := p.is("-")
+		if err := p.next(); err != nil {
+			return decimal.Zero, err
+		}
+		v, err := p.unary()
+		if err != nil {
+			return decimal.Zero, err
+		}
+		if neg {
+			v = v.Neg()
+		}
+		return v, nil
+	}
+	return p.power()
+}
+
+// power parses right-associative exponentiations.
+func (p *parser) power() (decimal.Decimal, error) {
+	v, err := p.postfix()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if !p.is("^") {
+		return v, nil
+	}
+	pos := p.tok.pos
+	if err := p.next(); err != nil {
+		return decimal.Zero, err
+	}
+	e, err := p.unary()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	v, err = pow(v, e)
+	if err == nil {
+		v, err = bound(v)
+	}
+	if err != nil {
+		return decimal.Zero, &Error{Pos: pos, Msg: err.Error()}
+	}
+	return v, nil
+}
+
+// postfix parses percentages, leaving the % followed by an operand to term as a
+// modulo.
+func (p *parser) postfix() (decimal.Decimal, error) {
+	v, err := p.primary()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	for p.is("%") && !p.operandFollows() {
+		v = v.Shift(-2)
+		if err := p.next(); err != nil {
+			return decimal.Zero, err
+		}
+	}
+	return v, nil
+}
+
+// primary parses numbers, identifiers, function calls and parenthesized expressions.
+func (p *parser) primary() (decimal.Decimal, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokenNumber:
+		v, err := decimal.NewFromString(tok.text)
+		if err != nil {
+			return decimal.Zero, &Error{Pos: tok.pos, Msg: fmt.Sprintf("invalid number %q", tok.text)}
+		}
+		if v, err = bound(v); err != nil {
+			return decimal.Zero, &Error{Pos: tok.pos, Msg: err.Error()}
+		}
+		return v, p.next()
+	case tok.kind == tokenIdent:
+		if err := p.next(); err != nil {
+			return decimal.Zero, err
+		}
+		if p.is("(") {
+			return p.call(tok)
+		}
+		if v, ok := p.vars[tok.text]; ok {
+			v, err := bound(v)
+			if err != nil {
+				return decimal.Zero, &Error{Pos: tok.pos, Msg: fmt.Sprintf("%s: %v", tok.text, err)}
+			}
+			return v, nil
+		}
+		if v, ok := constants[strings.ToLower(tok.text)]; ok {
+			return v, nil
+		}
+		if _, ok := functions[strings.ToLower(tok.text)]; ok {
+			return decimal.Zero, &Error{Pos: tok.pos, Msg: fmt.Sprintf("function %s must be called with parentheses", tok.text)}
+		}
+		return decimal.Zero, &Error{Pos: tok.pos, Msg: fmt.Sprintf("unknown variable %s", tok.text)}
+	case p.is("("):
+		if err := p.next(); err != nil {
+			return decimal.Zero, err
+		}
+		v, err := p.expression()
+		if err != nil {
+			return decimal.Zero, err
+		}
+		if !p.is(")") {
+			if p.tok.kind == tokenEOF {
+				return decimal.Zero, &Error{Pos: tok.pos, Msg: "unclosed parenthesis"}
+			}
+			return decimal.Zero, p.unexpected()
+		}
+		return v, p.next()
+	default:
+		return decimal.Zero, p.unexpected()
+	}
+}
+
+// call parses the arguments of a function call, the current token being the opening
+// parenthesis.
+func (p *parser) call(name token) (decimal.Decimal, error) {
+	fn, ok := functions[strings.ToLower(name.text)]
+	if !ok {
+		return decimal.Zero, &Error{Pos: name.pos, Msg: fmt.Sprintf("unknown function %s, available functions are: %s", name.text, strings.Join(Functions(), ", "))}
+	}
+	if err := p.next(); err != nil {
+		return decimal.Zero, err
+	}
+
+	var args []decimal.Decimal
+	for !p.is(")") {
+		if len(args) > 0 {
+			if !p.is(",") {
+				return decimal.Zero, p.unexpected()
+			}
+			if err := p.next(); err != nil {
+				return decimal.Zero, err
+			}
+		}
+		v, err := p.expression()
+		if err != nil {
+			return decimal.Zero, err
+		}
+		args = append(args, v)
+	}
+	if err := p.next(); err != nil {
+		return decimal.Zero, err
+	}
+
+	if len(args) < fn.args-fn.optional || len(args) > fn.args {
+		want := fmt.Sprint(fn.args)
+		if fn.optional > 0 {
+			want = fmt.Sprintf("%d to %d", fn.args-fn.optional, fn.args)
+		}
+		return decimal.Zero, &Error{Pos: name.pos, Msg: fmt.Sprintf("%s takes %s arguments, got %d", name.text, want, len(args))}
+	}
+	v, err := fn.call(args)
+	if err == nil {
+		v, err = bound(v)
+	}
+	if err != nil {
+		return decimal.Zero, &Error{Pos: name.pos, Msg: fmt.Sprintf("%s: %v", name.text, err)}
+	}
+	return v, nil
+}
+
+// operandFollows reports whether the token after the current one starts an operand: a
+// number, an identifier or a parenthesized expression.
+func (p *parser) operandFollows() bool {
+	i := p.pos
+	for i < len(p.input) && unicode.IsSpace(rune(p.input[i])) {
+		i++
+	}
+	if i == len(p.input) {
+		return false
+	}
+	c := p.input[i]
+	return isDigit(c) || c == '.' || c == '_' || c == '(' || unicode.IsLetter(rune(c))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// bound fails when the integer part of d has more than maxDigits digits, and rounds
+// its fractional part to maxDigits places.
+func bound(d decimal.Decimal) (decimal.Decimal, error) {
+	switch {
+	case intDigits(d) > maxDigits:
+		return decimal.Zero, tooLarge()
+	case intDigits(d) < -maxDigits:
+		return decimal.Zero, nil
+	case d.Exponent() < -maxDigits:
+		return d.Round(maxDigits), nil
+	}
+	return d, nil
+}
+
+func tooLarge() error {
+	return fmt.Errorf("number is too large, the limit is %d digits", maxDigits)
+}
+
+// intDigits returns the number of digits of the integer part of d, which is negative or
+// zero below 0.1.
+func intDigits(d decimal.Decimal) int {
+	if d.IsZero() {
+		return 0
+	}
+	return d.NumDigits() + int(d.Exponent())
+}
+
+// log10 estimates the decimal logarithm of |d|, which must not be zero, from its
+// binary exponent, so that it works whatever the size of d.
+func log10(d decimal.Decimal) float64 {
+	mant := new(big.Float)
+	exp := new(big.Float).SetInt(d.Coefficient()).MantExp(mant)
+	m, _ := mant.Float64()
+	return (float64(exp)+math.Log2(math.Abs(m)))*math.Log10(2) + float64(d.Exponent())
+}
+
+func pow(base, exp decimal.Decimal) (decimal.Decimal, error) {
+	if exp.IsZero() {
+		// 0^0 is 1 too, as in most languages.
+		return decimal.NewFromInt(1), nil
+	}
+	if base.IsZero() {
+		if exp.IsNegative() {
+			return decimal.Zero, fmt.Errorf("division by zero")
+		}
+		if exp.IsInteger() {
+			return base.PowWithPrecision(exp, Precision)
+		}
+		return decimal.Zero, nil
+	}
+	if !exp.IsInteger() && base.IsNegative() {
+		return decimal.Zero, fmt.Errorf("cannot raise a negative number to a fractional power")
+	}
+	// The magnitude of the result is checked before computing it, since computing it is
+	// what takes time and memory.
+	switch digits := exp.InexactFloat64() * log10(base); {
+	case digits > maxDigits:
+		return decimal.Zero, tooLarge()
+	case digits < -(Precision + guardDigits):
+		// The result rounds to zero.
+		return decimal.Zero, nil
+	}
+	if exp.IsInteger() && exp.Abs().LessThanOrEqual(decimal.NewFromInt(maxExponent)) {
+		return base.PowWithPrecision(exp, Precision)
+	}
+	// |base|^exp = e^(exp*ln(|base|)), negative bases having an integer exponent.
+	l, err := base.Abs().Ln(Precision + guardDigits)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	v, err := exp.Mul(l).ExpTaylor(Precision + guardDigits)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if base.IsNegative() && !exp.Mod(decimal.NewFromInt(2)).IsZero() {
+		v = v.Neg()
+	}
+	return v.Round(Precision), nil
+}
+
+// exp computes e^x. The cost of the Taylor series grows with x, which is bounded by
+// the size of the result.
+func exp(x decimal.Decimal) (decimal.Decimal, error) {
+	switch digits := x.InexactFloat64() * math.Log10E; {
+	case digits > maxDigits:
+		return decimal.Zero, tooLarge()
+	case digits < -(Precision + guardDigits):
+		// The result rounds to zero.
+		return decimal.Zero, nil
+	}
+	v, err := x.ExpTaylor(Precision + guardDigits)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return v.Round(Precision), nil
+}
+
+func sqrt(d decimal.Decimal) (decimal.Decimal, error) {
+	if d.IsNegative() {
+		return decimal.Zero, fmt.Errorf("square root of a negative number")
+	}
+	f := new(big.Float).SetPrec(256)
+	if _, ok := f.SetString(d.String()); !ok {
+		return decimal.Zero, fmt.Errorf("invalid number %s", d)
+	}
+	v, err := decimal.NewFromString(f.Sqrt(f).Text('f', Precision))
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return v.Round(Precision), nil
+}
+
+func ln(d decimal.Decimal) (decimal.Decimal, error) {
+	if !d.IsPositive() {
+		return decimal.Zero, fmt.Errorf("logarithm of a non-positive number")
+	}
+	return d.Ln(Precision)
+}
+
+// log computes the logarithm of its first argument, in base 10 unless a second
+// argument gives the base.
+func log(args []decimal.Decimal) (decimal.Decimal, error) {
+	base := decimal.NewFromInt(10)
+	if len(args) == 2 {
+		base = args[1]
+	}
+	if base.Equal(decimal.NewFromInt(1)) {
+		return decimal.Zero, fmt.Errorf("logarithm base cannot be 1")
+	}
+	if !args[0].IsPositive() || !base.IsPositive() {
+		return decimal.Zero, fmt.Errorf("logarithm of a non-positive number")
+	}
+	// Guard digits keep exact results such as log(8, 2) from ending in 9s.
+	n, err := args[0].Ln(Precision + guardDigits)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	b, err := base.Ln(Precision + guardDigits)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return n.DivRound(b, Precision+guardDigits).Round(Precision), nil
+}
+
+// round rounds its first argument half away from zero, to the number of decimal places
+// given by the second argument, 0 by default.
+func round(args []decimal.Decimal) (decimal.Decimal, error) {
+	places := decimal.Zero
+	if len(args) == 2 {
+		places = args[1]
+	}
+	if !places.IsInteger() {
+		return decimal.Zero, fmt.Errorf("decimal places must be an integer")
+	}
+	if places.Abs().GreaterThan(decimal.NewFromInt(maxDigits)) {
+		return decimal.Zero, fmt.Errorf("decimal places must be between %d and %d", -maxDigits, maxDigits)
+	}
+	return args[0].Round(int32(places.IntPart())), nil
+}
+
+func mod(args []decimal.Decimal) (decimal.Decimal, error) {
+	if args[1].IsZero() {
+		return decimal.Zero, fmt.Errorf("division by zero")
+	}
+	return args[0].Mod(args[1]), nil
+}
+
+// float computes f with float64 precision, for functions decimals don't provide.
+func float(f func(float64) float64) func([]decimal.Decimal) (decimal.Decimal, error) {
+	return func(args []decimal.Decimal) (decimal.Decimal, error) {
+		v := f(args[0].InexactFloat64())
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return decimal.Zero, fmt.Errorf("%s is out of the function domain", args[0])
+		}
+		return decimal.NewFromFloat(v), nil
+	}
+}
@@ -0,0 +1,127 @@
+package calc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestEvaluate(t *testing.T) {
+	vars := map[string]decimal.Decimal{
+		"price": decimal.RequireFromString("19.99"),
+		"n":     decimal.NewFromInt(3),
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		// Precedence and associativity
+		{expr: "1 + 2 * 3", want: "7"},
+		{expr: "(1 + 2) * 3", want: "9"},
+		{expr: "10 - 4 - 3", want: "3"},
+		{expr: "2 * 3 ^ 2", want: "18"},
+		{expr: "2 ^ 3 ^ 2", want: "512"},
+		{expr: "1 / 3", want: "0.33333333333333333333333333333333"},
+		{expr: "0.1 + 0.2", want: "0.3"},
+
+		// Unary signs bind looser than powers.
+		{expr: "-2 ^ 2", want: "-4"},
+		{expr: "(-2) ^ 2", want: "4"},
+		{expr: "2 ^ -1", want: "0.5"},
+		{expr: "--3", want: "3"},
+		{expr: "-3 * -3", want: "9"},
+		{expr: "+5", want: "5"},
+
+		// Percentages and modulos
+		{expr: "15%", want: "0.15"},
+		{expr: "200 * 15%", want: "30"},
+		{expr: "50%%", want: "0.005"},
+		{expr: "100 + 10% * 100", want: "110"},
+		{expr: "10 % 3", want: "1"},
+		{expr: "10 % 3 * 2", want: "2"},
+		{expr: "10%(4)", want: "2"},
+		{expr: "7.5 % 2", want: "1.5"},
+		{expr: "-7 % 3", want: "-1"},
+		{expr: "10 % n", want: "1"},
+
+		// Powers
+		{expr: "0 ^ 0", want: "1"},
+		{expr: "0 ^ 2", want: "0"},
+		{expr: "2 ^ 0.5", want: "1.4142135623730950488016887242097"},
+		{expr: "1 ^ 100000", want: "1"},
+		{expr: "(-1) ^ 100001", want: "-1"},
+		{expr: "0.5 ^ 100000", want: "0"},
+		{expr: "round(1.0001 ^ 20000, 10)", want: "7.3883172795"},
+
+		// Variables, constants and functions
+		{expr: "round(price * n, 2)", want: "59.97"},
+		{expr: "round(pi, 4)", want: "3.1416"},
+		{expr: "log(8, 2)", want: "3"},
+		{expr: "mod(10, 4)", want: "2"},
+		{expr: "max(1, min(5, 3))", want: "3"},
+		{expr: "1.5e3", want: "1500"},
+
+		// Digit limits
+		{expr: "10 ^ 999", want: "1" + strings.Repeat("0", 999)},
+		{expr: "1e-1001", want: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Evaluate(tt.expr, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Evaluate(%q) = %s, want %s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantPos int
+		wantMsg string
+	}{
+		{expr: "", wantPos: 0, wantMsg: "empty expression"},
+		{expr: "1 +", wantPos: 3, wantMsg: "unexpected end of expression"},
+		{expr: "2 * (3 + 4", wantPos: 4, wantMsg: "unclosed parenthesis"},
+		{expr: "1 2", wantPos: 2, wantMsg: `unexpected "2"`},
+		{expr: "3 $ 4", wantPos: 2, wantMsg: `unexpected character '$'`},
+		{expr: "1 / (2 - 2)", wantPos: 2, wantMsg: "division by zero"},
+		{expr: "5 % 0", wantPos: 2, wantMsg: "division by zero"},
+		{expr: "0 ^ -1", wantPos: 2, wantMsg: "division by zero"},
+		{expr: "(-8) ^ 0.5", wantPos: 5, wantMsg: "cannot raise a negative number to a fractional power"},
+		{expr: "x + 1", wantPos: 0, wantMsg: "unknown variable x"},
+		{expr: "1 + sqrt", wantPos: 4, wantMsg: "function sqrt must be called with parentheses"},
+		{expr: "1 + cube(2)", wantPos: 4, wantMsg: "unknown function cube"},
+		{expr: "round(1, 2, 3)", wantPos: 0, wantMsg: "round takes 1 to 2 arguments, got 3"},
+		{expr: "sqrt(-1)", wantPos: 0, wantMsg: "sqrt: square root of a negative number"},
+		{expr: "1.2.3", wantPos: 0, wantMsg: `invalid number "1.2.3"`},
+
+		// Digit limits
+		{expr: "10 ^ 1000", wantPos: 3, wantMsg: "number is too large, the limit is 1000 digits"},
+		{expr: "1" + strings.Repeat("0", 1000), wantPos: 0, wantMsg: "number is too large"},
+		{expr: "1e999 * 100", wantPos: 6, wantMsg: "number is too large"},
+		{expr: "1e999 + 9e999", wantPos: 6, wantMsg: "number is too large"},
+		{expr: "2 ^ 2 ^ 2 ^ 2 ^ 2", wantPos: 2, wantMsg: "number is too large"},
+		{expr: "1.0001 ^ 100000000", wantPos: 7, wantMsg: "number is too large"},
+		{expr: "exp(10000)", wantPos: 0, wantMsg: "exp: number is too large"},
+		{expr: "round(1, 1001)", wantPos: 0, wantMsg: "decimal places must be between -1000 and 1000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Evaluate(tt.expr, nil)
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Evaluate(%q) = %s, %v, want an *Error", tt.expr, got, err)
+			}
+			if e.Pos != tt.wantPos || !strings.Contains(e.Msg, tt.wantMsg) {
+				t.Errorf("Evaluate(%q) failed with %q at %d, want %q at %d", tt.expr, e.Msg, e.Pos, tt.wantMsg, tt.wantPos)
+			}
+		})
+	}
+}
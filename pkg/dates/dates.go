@@ -0,0 +1,382 @@
+// Package dates parses dates written in natural language, such as "next tuesday",
+// "in 3 days" or "march 5 at 2pm".
+package dates
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	weekdays = map[string]time.Weekday{
+		"sunday": time.Sunday, "sun": time.Sunday,
+		"monday": time.Monday, "mon": time.Monday,
+		"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+		"wednesday": time.Wednesday, "wed": time.Wednesday,
+		"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+		"friday": time.Friday, "fri": time.Friday,
+		"saturday": time.Saturday, "sat": time.Saturday,
+	}
+	months = map[string]time.Month{
+		"january": time.January, "jan": time.January,
+		"february": time.February, "feb": time.February,
+		"march": time.March, "mar": time.March,
+		"april": time.April, "apr": time.April,
+		"may":  time.May,
+		"june": time.June, "jun": time.June,
+		"july": time.July, "jul": time.July,
+		"august": time.August, "aug": time.August,
+		"september": time.September, "sep": time.September, "sept": time.September,
+		"october": time.October, "oct": time.October,
+		"november": time.November, "nov": time.November,
+		"december": time.December, "dec": time.December,
+	}
+	numbers = map[string]int{
+		"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+		"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+	}
+	units = map[string]string{
+		"minute": "minute", "min": "minute",
+		"hour": "hour", "hr": "hour", "h": "hour",
+		"day": "day", "d": "day",
+		"week": "week", "wk": "week", "w": "week",
+		"month": "month", "mo": "month",
+		"year": "year", "yr": "year", "y": "year",
+	}
+	layouts = []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	}
+)
+
+// Parse returns the date described by text, relative to now and in its location.
+// Dates without a time of day are returned at midnight, while relative times such as
+// "in 2 hours" keep the time of now.
+func Parse(text string, now time.Time) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, text, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	words := strings.Fields(strings.NewReplacer(",", " ", ".", " ").Replace(strings.ToLower(text)))
+	if len(words) == 0 {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+	words, clock, hasClock := splitClock(words)
+	t, exact, err := parseDate(words, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognized date %q: %w", text, err)
+	}
+	switch {
+	case hasClock:
+		t = time.Date(t.Year(), t.Month(), t.Day(), clock[0], clock[1], clock[2], 0, t.Location())
+	case !exact:
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t, nil
+}
+
+// LocalZone returns the IANA name of the local timezone, such as Europe/Paris, or its
+// abbreviation when the name can't be found.
+func LocalZone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		return tz
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	if name := time.Local.String(); name != "Local" {
+		return name
+	}
+	name, _ := time.Now().Zone()
+	return name
+}
+
+// splitClock removes the time of day from words, introduced by "at" or found at
+// either end, and returns it as hours, minutes and seconds.
+func splitClock(words []string) ([]string, [3]int, bool) {
+	for i, w := range words {
+		if w != "at" {
+			continue
+		}
+		for _, n := range []int{2, 1} {
+			if i+1+n > len(words) {
+				continue
+			}
+			if clock, ok := parseClock(words[i+1 : i+1+n]); ok {
+				return append(words[:i:i], words[i+1+n:]...), clock, true
+			}
+		}
+	}
+	for _, n := range []int{2, 1} {
+		if len(words) < n {
+			continue
+		}
+		if clock, ok := parseClock(words[len(words)-n:]); ok {
+			return words[:len(words)-n], clock, true
+		}
+		if clock, ok := parseClock(words[:n]); ok {
+			return words[n:], clock, true
+		}
+	}
+	return words, [3]int{}, false
+}
+
+// parseClock parses times of day such as "3pm", "3:30 pm", "15:30" or "noon".
+func parseClock(words []string) ([3]int, bool) {
+	s := strings.Join(words, "")
+	switch s {
+	case "noon", "midday":
+		return [3]int{12, 0, 0}, true
+	case "midnight":
+		return [3]int{0, 0, 0}, true
+	}
+
+	pm, am := strings.HasSuffix(s, "pm"), strings.HasSuffix(s, "am")
+	if pm || am {
+		s = s[:len(s)-2]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 || (len(parts) == 1 && !pm && !am) {
+		// A lone number is a day or a count, not a time.
+		return [3]int{}, false
+	}
+	var clock [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || (i > 0 && (len(p) != 2 || n > 59)) {
+			return [3]int{}, false
+		}
+		clock[i] = n
+	}
+	switch {
+	case pm || am:
+		if clock[0] < 1 || clock[0] > 12 {
+			return [3]int{}, false
+		}
+		clock[0] %= 12
+		if pm {
+			clock[0] += 12
+		}
+	case clock[0] > 23:
+		return [3]int{}, false
+	}
+	return clock, true
+}
+
+// parseDate parses the date part of words. exact reports whether the result keeps
+// the time of now.
+func parseDate(words []string, now time.Time) (t time.Time, exact bool, err error) {
+	if len(words) > 0 && words[0] == "the" {
+		words = words[1:]
+	}
+	switch strings.Join(words, " ") {
+	case "", "today", "tonight":
+		return now, false, nil
+	case "now", "right now":
+		return now, true, nil
+	case "tomorrow":
+		return now.AddDate(0, 0, 1), false, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), false, nil
+	case "day after tomorrow":
+		return now.AddDate(0, 0, 2), false, nil
+	case "day before yesterday":
+		return now.AddDate(0, 0, -2), false, nil
+	}
+
+	// in 3 days, 2 weeks ago, 5 hours from now
+	switch {
+	case len(words) == 3 && words[0] == "in":
+		return shift(now, words[1], words[2], 1)
+	case len(words) == 3 && (words[2] == "ago" || words[2] == "later"):
+		sign := 1
+		if words[2] == "ago" {
+			sign = -1
+		}
+		return shift(now, words[0], words[1], sign)
+	case len(words) == 4 && words[2] == "from" && words[3] == "now":
+		return shift(now, words[0], words[1], 1)
+	}
+
+	// tuesday, next friday, last monday, next week
+	if len(words) <= 2 {
+		modifier, name := "", words[0]
+		if len(words) == 2 {
+			modifier, name = words[0], words[1]
+		}
+		if day, ok := weekdays[name]; ok {
+			diff := int(day - now.Weekday())
+			switch modifier {
+			case "", "this", "on":
+				diff = (diff + 7) % 7
+			case "next":
+				diff = (diff+6)%7 + 1
+			case "last", "previous":
+				diff = -((-diff+6)%7 + 1)
+			default:
+				return time.Time{}, false, fmt.Errorf("unknown modifier %q", modifier)
+			}
+			return now.AddDate(0, 0, diff), false, nil
+		}
+		if unit, ok := units[strings.TrimSuffix(name, "s")]; ok && len(words) == 2 {
+			switch modifier {
+			case "next":
+				return shift(now, "1", unit, 1)
+			case "last", "previous":
+				return shift(now, "1", unit, -1)
+			case "this":
+				return now, unit == "minute" || unit == "hour", nil
+			}
+		}
+	}
+
+	// start of next month, end of the year, end of last week
+	if len(words) >= 3 && words[1] == "of" && (words[0] == "start" || words[0] == "beginning" || words[0] == "end") {
+		return boundary(words[0] == "end", words[2:], now)
+	}
+
+	return calendar(words, now)
+}
+
+// shift moves now by count units, in the direction of sign.
+func shift(now time.Time, count, unit string, sign int) (time.Time, bool, error) {
+	n, ok := numbers[count]
+	if !ok {
+		var err error
+		if n, err = strconv.Atoi(count); err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid count %q", count)
+		}
+	}
+	u, ok := units[unit]
+	if !ok {
+		if u, ok = units[strings.TrimSuffix(unit, "s")]; !ok {
+			return time.Time{}, false, fmt.Errorf("unknown unit %q", unit)
+		}
+	}
+	n *= sign
+	switch u {
+	case "minute":
+		return now.Add(time.Duration(n) * time.Minute), true, nil
+	case "hour":
+		return now.Add(time.Duration(n) * time.Hour), true, nil
+	case "day":
+		return now.AddDate(0, 0, n), false, nil
+	case "week":
+		return now.AddDate(0, 0, 7*n), false, nil
+	case "month":
+		return now.AddDate(0, n, 0), false, nil
+	default:
+		return now.AddDate(n, 0, 0), false, nil
+	}
+}
+
+// boundary returns the first or last day of the week, month or year named by words.
+// Weeks start on Monday.
+func boundary(end bool, words []string, now time.Time) (time.Time, bool, error) {
+	if words[0] == "the" {
+		words = words[1:]
+	}
+	if len(words) == 2 {
+		var err error
+		if now, _, err = parseDate(words, now); err != nil {
+			return time.Time{}, false, err
+		}
+		words = words[1:]
+	}
+	if len(words) != 1 {
+		return time.Time{}, false, fmt.Errorf("unknown period %q", strings.Join(words, " "))
+	}
+
+	y, m, d := now.Date()
+	var start time.Time
+	switch units[strings.TrimSuffix(words[0], "s")] {
+	case "week":
+		start = time.Date(y, m, d-(int(now.Weekday())+6)%7, 0, 0, 0, 0, now.Location())
+		if end {
+			return start.AddDate(0, 0, 6), false, nil
+		}
+	case "month":
+		start = time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+		if end {
+			return start.AddDate(0, 1, -1), false, nil
+		}
+	case "year":
+		start = time.Date(y, time.January, 1, 0, 0, 0, 0, now.Location())
+		if end {
+			return start.AddDate(1, 0, -1), false, nil
+		}
+	default:
+		return time.Time{}, false, fmt.Errorf("unknown period %q", words[0])
+	}
+	return start, false, nil
+}
+
+// calendar parses dates such as "march 5", "5th of march 2025" or "tuesday 2025-03-04".
+// Dates without a year are the next ones to come.
+func calendar(words []string, now time.Time) (time.Time, bool, error) {
+	var (
+		month      time.Month
+		day, year  int
+		onlyMonth  = true
+		unexpected []string
+	)
+	for _, w := range words {
+		if t, err := time.ParseInLocation("2006-01-02", w, now.Location()); err == nil {
+			return t, false, nil
+		}
+		if m, ok := months[w]; ok && month == 0 {
+			month = m
+			continue
+		}
+		if _, ok := weekdays[w]; ok || w == "of" || w == "the" || w == "on" {
+			continue
+		}
+		digits := strings.TrimRight(w, "stndrh")
+		n, err := strconv.Atoi(digits)
+		switch {
+		case err != nil:
+			unexpected = append(unexpected, w)
+		case len(digits) == 4 && year == 0:
+			year = n
+		case n >= 1 && n <= 31 && day == 0:
+			day, onlyMonth = n, false
+		default:
+			unexpected = append(unexpected, w)
+		}
+	}
+	if len(unexpected) > 0 {
+		return time.Time{}, false, fmt.Errorf("unexpected %q", strings.Join(unexpected, " "))
+	}
+	if month == 0 {
+		return time.Time{}, false, fmt.Errorf("no month")
+	}
+	if onlyMonth {
+		day = 1
+	}
+
+	explicitYear := year != 0
+	if !explicitYear {
+		year = now.Year()
+	}
+	t := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	if t.Day() != day {
+		return time.Time{}, false, fmt.Errorf("%s has no day %d", month, day)
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if !explicitYear && t.Before(today) {
+		t = t.AddDate(1, 0, 0)
+	}
+	return t, false, nil
+}
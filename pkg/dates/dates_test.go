@@ -0,0 +1,120 @@
+package dates
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2025, time.March, 12, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		text string
+		want string
+	}{
+		// Absolute dates
+		{text: "2025-03-04", want: "2025-03-04T00:00:00Z"},
+		{text: "2025-03-04T10:30", want: "2025-03-04T10:30:00Z"},
+		{text: "2025-03-04T10:30:00+01:00", want: "2025-03-04T10:30:00+01:00"},
+		{text: "march 5", want: "2026-03-05T00:00:00Z"},
+		{text: "March 12", want: "2025-03-12T00:00:00Z"},
+		{text: "5th of april 2024 at 3:30 pm", want: "2024-04-05T15:30:00Z"},
+		{text: "december", want: "2025-12-01T00:00:00Z"},
+		{text: "tuesday 2025-03-04", want: "2025-03-04T00:00:00Z"},
+
+		// Relative days
+		{text: "today", want: "2025-03-12T00:00:00Z"},
+		{text: "now", want: "2025-03-12T15:04:05Z"},
+		{text: "Tomorrow at 9am", want: "2025-03-13T09:00:00Z"},
+		{text: "yesterday", want: "2025-03-11T00:00:00Z"},
+		{text: "the day after tomorrow", want: "2025-03-14T00:00:00Z"},
+		{text: "noon", want: "2025-03-12T12:00:00Z"},
+		{text: "in 3 days", want: "2025-03-15T00:00:00Z"},
+		{text: "in 2 hours", want: "2025-03-12T17:04:05Z"},
+		{text: "five minutes from now", want: "2025-03-12T15:09:05Z"},
+		{text: "2 weeks ago", want: "2025-02-26T00:00:00Z"},
+		{text: "in a month", want: "2025-04-12T00:00:00Z"},
+		{text: "next week", want: "2025-03-19T00:00:00Z"},
+		{text: "last year", want: "2024-03-12T00:00:00Z"},
+
+		// Weekdays
+		{text: "wednesday", want: "2025-03-12T00:00:00Z"},
+		{text: "tuesday", want: "2025-03-18T00:00:00Z"},
+		{text: "next wednesday", want: "2025-03-19T00:00:00Z"},
+		{text: "next thursday", want: "2025-03-13T00:00:00Z"},
+		{text: "last friday", want: "2025-03-07T00:00:00Z"},
+		{text: "last wednesday", want: "2025-03-05T00:00:00Z"},
+		{text: "friday at 17:30", want: "2025-03-14T17:30:00Z"},
+
+		// Boundaries, weeks starting on Monday
+		{text: "start of the week", want: "2025-03-10T00:00:00Z"},
+		{text: "end of last week", want: "2025-03-09T00:00:00Z"},
+		{text: "end of the month", want: "2025-03-31T00:00:00Z"},
+		{text: "start of next month", want: "2025-04-01T00:00:00Z"},
+		{text: "beginning of the year", want: "2025-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := Parse(tt.text, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format(time.RFC3339) != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.text, got.Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// The day before clocks moved forward, on March 9 2025.
+	now := time.Date(2025, time.March, 8, 12, 0, 0, 0, ny)
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "tomorrow", want: "2025-03-09T00:00:00-05:00"},
+		{text: "in 24 hours", want: "2025-03-09T13:00:00-04:00"},
+		{text: "monday at 8am", want: "2025-03-10T08:00:00-04:00"},
+		{text: "2025-03-10 08:00", want: "2025-03-10T08:00:00-04:00"},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.text, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Format(time.RFC3339) != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.text, got.Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	now := time.Date(2025, time.March, 12, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		text    string
+		wantErr string
+	}{
+		{text: "  ", wantErr: "empty date"},
+		{text: "february 30", wantErr: "February has no day 30"},
+		{text: "in 3 fortnights", wantErr: `unknown unit "fortnights"`},
+		{text: "in many days", wantErr: `invalid count "many"`},
+		{text: "soon friday", wantErr: `unknown modifier "soon"`},
+		{text: "next blursday", wantErr: `unexpected "next blursday"`},
+		{text: "end of the decade", wantErr: `unknown period "decade"`},
+		{text: "the 5th", wantErr: "no month"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := Parse(tt.text, now)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse(%q) = %s, %v, want an error containing %q", tt.text, got, err, tt.wantErr)
+			}
+		})
+	}
+}
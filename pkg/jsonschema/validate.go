@@ -0,0 +1,119 @@
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Validate checks a decoded JSON value against the schema and returns its violations,
+// such as "rows[2].name: expected string, got number". Schemas without type accept any
+// value, and null is accepted for properties that aren't required.
+func (s JSONSchema) Validate(v any) []string {
+	var violations []string
+	s.validate("", v, &violations)
+	return violations
+}
+
+func (s JSONSchema) validate(path string, v any, violations *[]string) {
+	if s.Type == "" {
+		return
+	}
+	report := func(format string, args ...any) {
+		at := path
+		if at == "" {
+			at = "result"
+		}
+		*violations = append(*violations, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if got := typeOf(v); !matchesType(s.Type, v) {
+		report("expected %s, got %s", s.Type, got)
+		return
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				report("missing required property %s", name)
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			value, ok := v[name]
+			if !ok || (value == nil && !slices.Contains(s.Required, name)) {
+				continue
+			}
+			s.Properties[name].validate(join(path, name), value, violations)
+		}
+	case []any:
+		if s.Items == nil {
+			return
+		}
+		for i, item := range v {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, violations)
+		}
+	}
+}
+
+// matchesType reports whether v, as decoded by encoding/json, is of the JSON schema
+// type typ.
+func matchesType(typ string, v any) bool {
+	switch strings.ToLower(typ) {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	default:
+		// Types this package doesn't know are not checked.
+		return true
+	}
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
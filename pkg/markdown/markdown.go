@@ -0,0 +1,264 @@
+// Package markdown converts HTML documents to readable markdown text.
+package markdown
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	spaces       = regexp.MustCompile(`[ \t\r\n\f]+`)
+	blankLines   = regexp.MustCompile(`\n{3,}`)
+	trailingWS   = regexp.MustCompile(`[ \t]+\n`)
+	skippedAtoms = map[atom.Atom]bool{
+		atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+		atom.Template: true, atom.Svg: true, atom.Iframe: true, atom.Nav: true,
+		atom.Footer: true, atom.Form: true, atom.Button: true, atom.Select: true,
+	}
+	blockAtoms = map[atom.Atom]bool{
+		atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+		atom.Main: true, atom.Header: true, atom.Aside: true, atom.Figure: true,
+		atom.Figcaption: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+		atom.Details: true, atom.Summary: true, atom.Address: true,
+	}
+)
+
+// Document is an HTML document converted to markdown.
+type Document struct {
+	Title string
+	Text  string
+}
+
+// FromHTML converts the HTML document read from r to markdown. Relative links are
+// resolved against base when it is not nil. Scripts, styles, navigation and forms are
+// left out.
+func FromHTML(r io.Reader, base *url.URL) (*Document, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	c := &converter{base: base}
+	text := c.children(root)
+	text = trailingWS.ReplaceAllString(text, "\n")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+	return &Document{
+		Title: strings.TrimSpace(c.title),
+		Text:  strings.TrimSpace(text),
+	}, nil
+}
+
+type converter struct {
+	base  *url.URL
+	title string
+}
+
+func (c *converter) children(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(c.node(child))
+	}
+	return b.String()
+}
+
+func (c *converter) node(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return spaces.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return c.children(n)
+	}
+
+	if skippedAtoms[n.DataAtom] {
+		// The title lives in the skipped head.
+		if n.DataAtom == atom.Head {
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				if child.DataAtom == atom.Title {
+					c.title = text(child)
+				}
+			}
+		}
+		return ""
+	}
+	if blockAtoms[n.DataAtom] {
+		return block(c.children(n))
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		return block(strings.Repeat("#", level) + " " + inline(c.children(n)))
+	case atom.Br:
+		return "\n"
+	case atom.Hr:
+		return block("---")
+	case atom.A:
+		label := inline(c.children(n))
+		href := c.link(attr(n, "href"))
+		if href == "" || label == "" {
+			return label
+		}
+		return "[" + label + "](" + href + ")"
+	case atom.Img:
+		alt := strings.TrimSpace(attr(n, "alt"))
+		src := c.link(attr(n, "src"))
+		if alt == "" || src == "" {
+			return ""
+		}
+		return "![" + alt + "](" + src + ")"
+	case atom.Strong, atom.B:
+		return wrap("**", c.children(n))
+	case atom.Em, atom.I:
+		return wrap("*", c.children(n))
+	case atom.Code:
+		return wrap("`", text(n))
+	case atom.Pre:
+		return block("```\n" + strings.Trim(text(n), "\n") + "\n```")
+	case atom.Blockquote:
+		content := strings.TrimSpace(blankLines.ReplaceAllString(c.children(n), "\n\n"))
+		return block(prefixLines(content, "> ", "> "))
+	case atom.Ul, atom.Ol:
+		return block(c.list(n))
+	case atom.Table:
+		return block(c.table(n))
+	default:
+		return c.children(n)
+	}
+}
+
+func (c *converter) list(n *html.Node) string {
+	var (
+		items   []string
+		ordered = n.DataAtom == atom.Ol
+	)
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(len(items)+1) + ". "
+		}
+		content := strings.TrimSpace(blankLines.ReplaceAllString(c.children(li), "\n"))
+		content = strings.ReplaceAll(content, "\n\n", "\n")
+		items = append(items, prefixLines(content, marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+func (c *converter) table(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			switch child.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						row = append(row, strings.ReplaceAll(inline(c.children(cell)), "|", `\|`))
+					}
+				}
+				rows = append(rows, row)
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", width))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// link resolves href against the base URL, dropping script links.
+func (c *converter) link(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	if c.base == nil {
+		return href
+	}
+	u, err := c.base.Parse(href)
+	if err != nil {
+		return href
+	}
+	return u.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// text returns the raw text content of n, keeping its whitespace.
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(text(child))
+	}
+	return b.String()
+}
+
+func block(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	return "\n\n" + s + "\n\n"
+}
+
+func inline(s string) string {
+	return strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+}
+
+func wrap(marker, s string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	return marker + trimmed + marker
+}
+
+// prefixLines prefixes the first line of s with first and the following ones with rest.
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if i == 0 {
+			lines[i] = first + l
+		} else {
+			lines[i] = strings.TrimRight(rest+l, " ")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
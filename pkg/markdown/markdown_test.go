@@ -0,0 +1,76 @@
+package markdown
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFromHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "headings and paragraphs",
+			html: "<h1>Title</h1><p>First   paragraph\non two lines.</p><h3>Section</h3><p>Second.</p>",
+			want: "# Title\n\nFirst paragraph on two lines.\n\n### Section\n\nSecond.",
+		},
+		{
+			name: "inline formatting",
+			html: "<p><strong>bold</strong>, <em>italic</em> and <code>a  b</code></p>",
+			want: "**bold**, *italic* and `a  b`",
+		},
+		{
+			name: "links and images resolved against the base",
+			html: `<p><a href="/docs">Docs</a> <a href="javascript:alert(1)">run</a> <img src="logo.png" alt="Logo"></p>`,
+			want: "[Docs](https://example.com/docs) run ![Logo](https://example.com/guide/logo.png)",
+		},
+		{
+			name: "lists",
+			html: "<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>",
+			want: "- one\n- two\n  1. nested",
+		},
+		{
+			name: "table",
+			html: "<table><thead><tr><th>Name</th><th>Value</th></tr></thead><tbody><tr><td>a|b</td></tr></tbody></table>",
+			want: "| Name | Value |\n| --- | --- |\n| a\\|b |  |",
+		},
+		{
+			name: "preformatted text and quotes",
+			html: "<pre>\nfunc main() {\n\treturn\n}\n</pre><blockquote><p>quoted</p><p>twice</p></blockquote>",
+			want: "```\nfunc main() {\n\treturn\n}\n```\n\n> quoted\n>\n> twice",
+		},
+		{
+			name: "skipped elements",
+			html: "<nav>Menu</nav><script>alert(1)</script><style>p{}</style><p>Body</p><form><button>Send</button></form><footer>Legal</footer>",
+			want: "Body",
+		},
+	}
+	base, _ := url.Parse("https://example.com/guide/")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := FromHTML(strings.NewReader(tt.html), base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Text != tt.want {
+				t.Errorf("FromHTML() text = %q, want %q", doc.Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromHTMLTitle(t *testing.T) {
+	doc, err := FromHTML(strings.NewReader("<html><head><title> The  page </title></head><body><p>Hi</p></body></html>"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Title != "The  page" {
+		t.Errorf("FromHTML() title = %q, want %q", doc.Title, "The  page")
+	}
+	if doc.Text != "Hi" {
+		t.Errorf("FromHTML() text = %q, want %q", doc.Text, "Hi")
+	}
+}
@@ -0,0 +1,136 @@
+// Package search ranks short documents against a free text query with BM25.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters: k1 saturates the weight of repeated terms and b normalizes by
+// document length.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Index is a BM25 index of documents, identified by their position.
+type Index struct {
+	docs   []map[string]int
+	lens   []int
+	df     map[string]int
+	avgLen float64
+}
+
+// Result is a document matching a query.
+type Result struct {
+	Doc   int
+	Score float64
+}
+
+// NewIndex indexes docs.
+func NewIndex(docs []string) *Index {
+	ix := &Index{df: map[string]int{}}
+	total := 0
+	for _, doc := range docs {
+		terms := Tokenize(doc)
+		tf := map[string]int{}
+		for _, t := range terms {
+			tf[t]++
+		}
+		for t := range tf {
+			ix.df[t]++
+		}
+		ix.docs = append(ix.docs, tf)
+		ix.lens = append(ix.lens, len(terms))
+		total += len(terms)
+	}
+	if len(docs) > 0 {
+		ix.avgLen = float64(total) / float64(len(docs))
+	}
+	return ix
+}
+
+// Search returns up to n documents matching query, best first. Terms repeated in the
+// query weigh more.
+func (ix *Index) Search(query string, n int) []Result {
+	qtf := map[string]int{}
+	for _, t := range Tokenize(query) {
+		qtf[t]++
+	}
+	var results []Result
+	for i, tf := range ix.docs {
+		score := 0.0
+		for t, q := range qtf {
+			f := float64(tf[t])
+			if f == 0 {
+				continue
+			}
+			df := float64(ix.df[t])
+			idf := math.Log(1 + (float64(len(ix.docs))-df+0.5)/(df+0.5))
+			norm := f * (k1 + 1) / (f + k1*(1-b+b*float64(ix.lens[i])/ix.avgLen))
+			score += float64(q) * idf * norm
+		}
+		if score > 0 {
+			results = append(results, Result{Doc: i, Score: score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if n > 0 && len(results) > n {
+		results = results[:n]
+	}
+	return results
+}
+
+// Tokenize splits text into lower case terms, breaking identifiers such as sql_query or
+// listIssues into words, dropping stop words and reducing plurals.
+func Tokenize(text string) []string {
+	var (
+		terms []string
+		word  []rune
+	)
+	flush := func() {
+		if len(word) > 0 {
+			if w := strings.ToLower(string(word)); !stopWords[w] {
+				terms = append(terms, stem(w))
+			}
+			word = word[:0]
+		}
+	}
+	runes := []rune(text)
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			// A capital following a lower case letter starts a word of camelCase.
+			if unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]) {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return terms
+}
+
+func stem(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields("a an and are as at be by can do for from has have how i in is it its me my of on or so that the this to was what when which who will with you your") {
+		stopWords[w] = true
+	}
+}
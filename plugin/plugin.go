@@ -0,0 +1,208 @@
+// Package plugin runs executables as agent tools over a small JSON protocol, a
+// lightweight alternative to MCP for simple scripts.
+//
+// The executable is started for every request, which it reads as a JSON object on
+// stdin. It writes a JSON object on stdout and exits.
+//
+// A describe request, {"type": "describe"}, is answered with the functions of the
+// plugin:
+//
+//	{"functions": [{"id": "weather", "display_name": "Weather", "description": "...", "parameters": {...}, "response": {...}}]}
+//
+// A call request, {"type": "call", "function": "weather", "args": {...}, "chat_id": "..."},
+// is answered with {"result": {...}} on success, or {"error": "message"} when the call
+// fails. A non-zero exit code also fails the call, with the standard error as message.
+//
+// WebAssembly modules exchange the same documents through exported functions, in a
+// sandbox granting them only the capabilities listed in their configuration. See
+// WasmConfig.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+	"github.com/aliphe/skipery/tool"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// maxErrorLength caps the standard error reported when a plugin fails.
+	maxErrorLength = 2000
+)
+
+type Config struct {
+	Name    string
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Dir     string            `json:"dir"`
+	Env     map[string]string `json:"env"`
+	// Timeout bounds the execution time of a request.
+	Timeout tool.Duration `json:"timeout"`
+}
+
+type request struct {
+	Type     string         `json:"type"`
+	Function string         `json:"function,omitempty"`
+	Args     map[string]any `json:"args,omitempty"`
+	ChatID   string         `json:"chat_id,omitempty"`
+}
+
+type response struct {
+	Functions []function `json:"functions"`
+	Result    any        `json:"result"`
+	Error     string     `json:"error"`
+}
+
+type function struct {
+	ID          string                `json:"id"`
+	DisplayName string                `json:"display_name"`
+	Description string                `json:"description"`
+	Parameters  jsonschema.JSONSchema `json:"parameters"`
+	Response    jsonschema.JSONSchema `json:"response"`
+}
+
+var _ tool.Tool = (*Plugin)(nil)
+
+// Plugin is an executable wrapped as a tool.
+type Plugin struct {
+	cfg       Config
+	timeout   time.Duration
+	functions []tool.Function
+}
+
+// Load describes the plugin configured by cfg. The functions of the plugin are read
+// once and kept for the lifetime of the agent.
+func Load(ctx context.Context, cfg *Config) (*Plugin, error) {
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("missing command for plugin %s", cfg.Name)
+	}
+	p := &Plugin{cfg: *cfg, timeout: time.Duration(cfg.Timeout)}
+	if p.timeout <= 0 {
+		p.timeout = defaultTimeout
+	}
+
+	res, err := p.run(ctx, &request{Type: "describe"})
+	if err != nil {
+		return nil, err
+	}
+	p.functions, err = describedFunctions(cfg.Name, res.Functions)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// describedFunctions converts the functions described by a plugin to tool functions.
+func describedFunctions(name string, functions []function) ([]tool.Function, error) {
+	if len(functions) == 0 {
+		return nil, fmt.Errorf("plugin %s describes no functions", name)
+	}
+	var fns []tool.Function
+	for _, fn := range functions {
+		if fn.ID == "" {
+			return nil, fmt.Errorf("plugin %s describes a function without id", name)
+		}
+		if fn.Parameters.Type == "" {
+			fn.Parameters.Type = "object"
+		}
+		fns = append(fns, tool.Function{
+			ID:          fn.ID,
+			DisplayName: fn.DisplayName,
+			Description: fn.Description,
+			Parameters:  fn.Parameters,
+			Response:    fn.Response,
+		})
+	}
+	return fns, nil
+}
+
+// Name returns the name of the plugin.
+func (p *Plugin) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Plugin) Functions(ctx context.Context) []tool.Function {
+	return p.functions
+}
+
+func (p *Plugin) Call(ctx context.Context, fn string, args map[string]any) (map[string]any, error) {
+	res, err := p.run(ctx, &request{Type: "call", Function: fn, Args: args, ChatID: tool.ChatID(ctx)})
+	if err != nil {
+		return nil, err
+	}
+	return res.result()
+}
+
+// result returns the result of a call response, or its error.
+func (r *response) result() (map[string]any, error) {
+	if r.Error != "" {
+		return nil, errors.New(r.Error)
+	}
+	if result, ok := r.Result.(map[string]any); ok {
+		return result, nil
+	}
+	return map[string]any{"result": r.Result}, nil
+}
+
+// run sends req to a new process of the plugin and reads its response.
+func (p *Plugin) run(ctx context.Context, req *request) (*response, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.cfg.Command, p.cfg.Args...)
+	cmd.Dir = p.cfg.Dir
+	cmd.Env = os.Environ()
+	for k, v := range p.cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait forever for the output of processes started by a killed plugin.
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, fmt.Errorf("plugin %s timed out after %s", p.cfg.Name, p.timeout)
+	case errors.As(err, &exitErr):
+		return nil, fmt.Errorf("plugin %s failed with exit code %d: %s", p.cfg.Name, exitErr.ExitCode(), tail(stderr.String()))
+	case err != nil:
+		return nil, fmt.Errorf("run plugin %s: %w", p.cfg.Name, err)
+	}
+
+	var res response
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		return nil, fmt.Errorf("plugin %s returned an invalid response: %w", p.cfg.Name, err)
+	}
+	return &res, nil
+}
+
+// tail returns the end of a plugin standard error, where the failure is usually
+// explained.
+func tail(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "no error output"
+	}
+	if len(s) > maxErrorLength {
+		s = "..." + strings.ToValidUTF8(s[len(s)-maxErrorLength:], "")
+	}
+	return s
+}
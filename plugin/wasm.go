@@ -0,0 +1,303 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliphe/skipery/tool"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+const (
+	defaultWasmMaxMemory = 64
+	// hostModule is the name of the module providing the host functions to WASM plugins.
+	hostModule = "skipery"
+)
+
+var _ tool.Tool = (*Wasm)(nil)
+
+// WasmConfig configures a WebAssembly plugin. A WASM plugin is a WASI reactor module
+// exporting:
+//
+//   - alloc(size i32) i32, allocating size bytes of its memory for the host to write in.
+//   - describe() i64, returning the describe response.
+//   - call(ptr i32, len i32) i64, handling the call request written at ptr.
+//
+// Requests and responses are the JSON documents of executable plugins. Responses are
+// returned as their address in the upper 32 bits and their length in the lower ones.
+// A new instance of the module handles every request, so no state is kept between
+// calls.
+type WasmConfig struct {
+	Name string
+	// Path is the path of the .wasm file.
+	Path string `json:"path"`
+	// MaxMemory caps, in MiB, the memory of the module.
+	MaxMemory int `json:"maxMemory"`
+	// Timeout bounds the execution time of a request.
+	Timeout tool.Duration `json:"timeout"`
+	// Capabilities grants access to the host. Modules have none by default.
+	Capabilities WasmCapabilities `json:"capabilities"`
+}
+
+// WasmCapabilities lists what a WASM plugin can access on the host.
+type WasmCapabilities struct {
+	// Env sets the environment variables of the module. Variables of the agent aren't
+	// visible otherwise.
+	Env map[string]string `json:"env"`
+	// Dirs mounts host directories, read-only, mapping paths in the module to host paths.
+	Dirs map[string]string `json:"dirs"`
+	// Clock gives the real time to the module, instead of a fixed one.
+	Clock bool `json:"clock"`
+	// Random gives a cryptographic random source to the module, instead of a
+	// deterministic one.
+	Random bool `json:"random"`
+	// HTTP lets the module fetch URLs with the http_fetch host function, restricted like
+	// the HTTP tool.
+	HTTP *tool.HTTPConfig `json:"http"`
+}
+
+// Wasm is a WebAssembly module wrapped as a tool.
+type Wasm struct {
+	cfg       WasmConfig
+	timeout   time.Duration
+	runtime   wazero.Runtime
+	module    wazero.CompiledModule
+	http      *tool.HTTP
+	functions []tool.Function
+}
+
+// LoadWasm compiles the module configured by cfg and describes it. The functions of the
+// module are read once and kept for the lifetime of the agent.
+func LoadWasm(ctx context.Context, cfg *WasmConfig) (*Wasm, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("missing path for wasm plugin %s", cfg.Name)
+	}
+	code, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read wasm plugin %s: %w", cfg.Name, err)
+	}
+	maxMemory := cfg.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = defaultWasmMaxMemory
+	}
+	w := &Wasm{cfg: *cfg, timeout: time.Duration(cfg.Timeout)}
+	if w.timeout <= 0 {
+		w.timeout = defaultTimeout
+	}
+	if cfg.Capabilities.HTTP != nil {
+		w.http = tool.NewHTTP(cfg.Capabilities.HTTP)
+	}
+	for guest, host := range cfg.Capabilities.Dirs {
+		if info, err := os.Stat(host); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("wasm plugin %s: %s is not a directory", cfg.Name, host)
+		}
+		if !filepath.IsAbs(guest) {
+			return nil, fmt.Errorf("wasm plugin %s: mount point %s must be absolute", cfg.Name, guest)
+		}
+	}
+
+	// A page is 64KiB.
+	w.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(maxMemory)*16).
+		WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, w.runtime); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("wasm plugin %s: %w", cfg.Name, err)
+	}
+	_, err = w.runtime.NewHostModuleBuilder(hostModule).
+		NewFunctionBuilder().
+		WithGoModuleFunction(api.GoModuleFunc(w.httpFetch), []api.ValueType{api.ValueTypeI32, api.ValueTypeI32}, []api.ValueType{api.ValueTypeI64}).
+		Export("http_fetch").
+		Instantiate(ctx)
+	if err != nil {
+		w.Close()
+		return nil, fmt.Errorf("wasm plugin %s: %w", cfg.Name, err)
+	}
+	w.module, err = w.runtime.CompileModule(ctx, code)
+	if err != nil {
+		w.Close()
+		return nil, fmt.Errorf("compile wasm plugin %s: %w", cfg.Name, err)
+	}
+	for _, name := range []string{"alloc", "describe", "call"} {
+		if _, ok := w.module.ExportedFunctions()[name]; !ok {
+			w.Close()
+			return nil, fmt.Errorf("wasm plugin %s doesn't export %s", cfg.Name, name)
+		}
+	}
+
+	res, err := w.run(ctx, nil)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	w.functions, err = describedFunctions(cfg.Name, res.Functions)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Name returns the name of the plugin.
+func (w *Wasm) Name() string {
+	return w.cfg.Name
+}
+
+func (w *Wasm) Functions(ctx context.Context) []tool.Function {
+	return w.functions
+}
+
+func (w *Wasm) Call(ctx context.Context, fn string, args map[string]any) (map[string]any, error) {
+	res, err := w.run(ctx, &request{Type: "call", Function: fn, Args: args, ChatID: tool.ChatID(ctx)})
+	if err != nil {
+		return nil, err
+	}
+	return res.result()
+}
+
+// Close releases the runtime of the module.
+func (w *Wasm) Close() error {
+	return w.runtime.Close(context.Background())
+}
+
+// run instantiates the module and sends it req, or a describe request when req is nil.
+func (w *Wasm) run(ctx context.Context, req *request) (*response, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	mod, err := w.runtime.InstantiateModule(ctx, w.module, w.moduleConfig(&stderr))
+	if err != nil {
+		return nil, w.failure(ctx, "instantiate", err, &stderr)
+	}
+	defer mod.Close(context.Background())
+
+	var packed []uint64
+	if req == nil {
+		packed, err = mod.ExportedFunction("describe").Call(ctx)
+	} else {
+		var in []byte
+		if in, err = json.Marshal(req); err != nil {
+			return nil, err
+		}
+		var ptr uint32
+		if ptr, err = writeGuest(ctx, mod, in); err != nil {
+			return nil, w.failure(ctx, "write request to", err, &stderr)
+		}
+		packed, err = mod.ExportedFunction("call").Call(ctx, uint64(ptr), uint64(len(in)))
+	}
+	if err != nil {
+		return nil, w.failure(ctx, "run", err, &stderr)
+	}
+
+	out, ok := mod.Memory().Read(uint32(packed[0]>>32), uint32(packed[0]))
+	if !ok {
+		return nil, fmt.Errorf("wasm plugin %s returned a response out of its memory", w.cfg.Name)
+	}
+	var res response
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("wasm plugin %s returned an invalid response: %w", w.cfg.Name, err)
+	}
+	return &res, nil
+}
+
+// moduleConfig grants the capabilities of the plugin to a new instance.
+func (w *Wasm) moduleConfig(stderr *bytes.Buffer) wazero.ModuleConfig {
+	caps := w.cfg.Capabilities
+	// Reactor modules are initialized by _initialize, command modules would exit in
+	// _start before handling any request.
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStderr(stderr)
+	for k, v := range caps.Env {
+		config = config.WithEnv(k, v)
+	}
+	if len(caps.Dirs) > 0 {
+		fs := wazero.NewFSConfig()
+		for guest, host := range caps.Dirs {
+			fs = fs.WithReadOnlyDirMount(host, guest)
+		}
+		config = config.WithFSConfig(fs)
+	}
+	if caps.Clock {
+		config = config.WithSysWalltime().WithSysNanotime().WithSysNanosleep()
+	}
+	if caps.Random {
+		config = config.WithRandSource(rand.Reader)
+	}
+	return config
+}
+
+// failure explains why running the module failed: a timeout, an exit or a trap.
+func (w *Wasm) failure(ctx context.Context, action string, err error, stderr *bytes.Buffer) error {
+	var exitErr *sys.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("wasm plugin %s timed out after %s", w.cfg.Name, w.timeout)
+	case errors.As(err, &exitErr):
+		return fmt.Errorf("wasm plugin %s exited with code %d: %s", w.cfg.Name, exitErr.ExitCode(), tail(stderr.String()))
+	}
+	// Traps come with a stack trace of the module, which the model can't make use of.
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	if stderr.Len() > 0 {
+		return fmt.Errorf("%s wasm plugin %s: %s: %s", action, w.cfg.Name, msg, tail(stderr.String()))
+	}
+	return fmt.Errorf("%s wasm plugin %s: %s", action, w.cfg.Name, msg)
+}
+
+// httpFetch implements the http_fetch host function. It reads a {"url": "..."} request
+// and returns the result of the HTTP tool, or {"error": "..."}.
+func (w *Wasm) httpFetch(ctx context.Context, mod api.Module, stack []uint64) {
+	respond := func(v any) {
+		out, _ := json.Marshal(v)
+		ptr, err := writeGuest(ctx, mod, out)
+		if err != nil {
+			panic(err)
+		}
+		stack[0] = uint64(ptr)<<32 | uint64(len(out))
+	}
+	if w.http == nil {
+		respond(map[string]any{"error": "http is not allowed for this plugin"})
+		return
+	}
+	in, ok := mod.Memory().Read(api.DecodeU32(stack[0]), api.DecodeU32(stack[1]))
+	if !ok {
+		panic(fmt.Errorf("http_fetch request out of memory"))
+	}
+	var args map[string]any
+	if err := json.Unmarshal(in, &args); err != nil {
+		respond(map[string]any{"error": "invalid request: " + err.Error()})
+		return
+	}
+	result, err := w.http.Call(ctx, "http_fetch", args)
+	if err != nil {
+		respond(map[string]any{"error": err.Error()})
+		return
+	}
+	respond(result)
+}
+
+// writeGuest copies data into memory allocated by the module and returns its address.
+func writeGuest(ctx context.Context, mod api.Module, data []byte) (uint32, error) {
+	res, err := mod.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	ptr := api.DecodeU32(res[0])
+	if !mod.Memory().Write(ptr, data) {
+		return 0, fmt.Errorf("allocated memory out of range")
+	}
+	return ptr, nil
+}
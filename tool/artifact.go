@@ -0,0 +1,90 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultArtifactDir = "./artifacts"
+
+// ArtifactConfig sets where the binary outputs of tools, such as images, are kept.
+type ArtifactConfig struct {
+	// Dir is the directory of the artifacts, ./artifacts by default. Artifacts are saved
+	// in a sub-directory per chat.
+	Dir string `json:"dir"`
+}
+
+// Artifact is a binary output of a tool, kept out of the prompt.
+type Artifact struct {
+	ID       string
+	ChatID   string
+	MIMEType string
+	Size     int
+	// Path is where the artifact can be opened.
+	Path      string
+	CreatedAt time.Time
+}
+
+// ArtifactStore keeps the binary outputs of tools.
+type ArtifactStore interface {
+	SaveArtifact(ctx context.Context, mimeType string, data []byte) (*Artifact, error)
+}
+
+var _ ArtifactStore = (*ArtifactDir)(nil)
+
+// ArtifactDir is an ArtifactStore saving artifacts as files.
+type ArtifactDir struct {
+	dir string
+}
+
+// NewArtifactDir creates a store of artifacts in the directory set by cfg, created on
+// the first save.
+func NewArtifactDir(cfg *ArtifactConfig) *ArtifactDir {
+	dir := defaultArtifactDir
+	if cfg != nil && cfg.Dir != "" {
+		dir = cfg.Dir
+	}
+	return &ArtifactDir{dir: dir}
+}
+
+// SaveArtifact saves data in a file named after a new artifact ID, with the extension
+// of its MIME type.
+func (d *ArtifactDir) SaveArtifact(ctx context.Context, mimeType string, data []byte) (*Artifact, error) {
+	a := &Artifact{
+		ID:        uuid.New().String(),
+		ChatID:    ChatID(ctx),
+		MIMEType:  mimeType,
+		Size:      len(data),
+		CreatedAt: time.Now(),
+	}
+	dir := d.dir
+	if a.ChatID != "" {
+		dir = filepath.Join(dir, a.ChatID)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create artifact directory: %w", err)
+	}
+	a.Path = filepath.Join(dir, a.ID+extension(mimeType))
+	if err := os.WriteFile(a.Path, data, 0o644); err != nil {
+		return nil, fmt.Errorf("save artifact: %w", err)
+	}
+	return a, nil
+}
+
+// extension returns the file extension of a MIME type, .bin when unknown.
+func extension(mimeType string) string {
+	// mime.ExtensionsByType sorts extensions alphabetically, which picks .jfif for JPEG.
+	if mimeType == "image/jpeg" {
+		return ".jpg"
+	}
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
@@ -0,0 +1,233 @@
+package tool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCacheMaxEntries = 1000
+
+// CacheConfig tunes the caching of function results.
+type CacheConfig struct {
+	// Store is where results are kept: "memory", the default, or "sqlite" to keep them
+	// across restarts.
+	Store string `json:"store"`
+	// Functions sets how long the results of functions are reused, by function ID or
+	// pattern such as "linear_*". It overrides the TTL declared by the functions, and
+	// "0s" disables caching.
+	Functions map[string]Duration `json:"functions"`
+	// MaxEntries caps the number of results kept in memory.
+	MaxEntries int `json:"maxEntries"`
+}
+
+// CacheStore keeps function results until they expire.
+type CacheStore interface {
+	GetResult(ctx context.Context, key string) (map[string]any, bool, error)
+	SaveResult(ctx context.Context, key string, result map[string]any, expiresAt time.Time) error
+}
+
+// Cache reuses the results of cacheable functions called again with the same
+// arguments in the same chat. Errors are never cached.
+type Cache struct {
+	store CacheStore
+	cfg   *CacheConfig
+
+	mu   sync.Mutex
+	ttls map[string]time.Duration
+}
+
+// NewCache creates a cache of the functions of tb. Functions are cacheable when they
+// declare a CacheTTL or when cfg matches them.
+func NewCache(store CacheStore, cfg *CacheConfig, tb ToolBelt) *Cache {
+	c := &Cache{store: store, cfg: cfg}
+	c.Reload(tb)
+	return c
+}
+
+// Reload reads the cacheable functions of tb again, such as when the functions of an
+// MCP server change after it reconnects.
+func (c *Cache) Reload(tb ToolBelt) {
+	cfg := c.cfg
+	ttls := map[string]time.Duration{}
+	seen := map[Tool]bool{}
+	for _, t := range tb {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		for _, fn := range t.Functions(context.Background()) {
+			if fn.CacheTTL > 0 {
+				ttls[fn.ID] = fn.CacheTTL
+			}
+		}
+	}
+	if cfg != nil {
+		// Patterns are applied first, longest last, so that exact IDs win over them
+		// and longer patterns over shorter ones.
+		patterns := slices.SortedFunc(maps.Keys(cfg.Functions), func(a, b string) int {
+			aExact, bExact := !strings.Contains(a, "*"), !strings.Contains(b, "*")
+			if aExact != bExact {
+				if aExact {
+					return 1
+				}
+				return -1
+			}
+			if len(a) != len(b) {
+				return len(a) - len(b)
+			}
+			return strings.Compare(a, b)
+		})
+		for _, pattern := range patterns {
+			for id := range tb {
+				if MatchWildcard(pattern, id) {
+					ttls[id] = time.Duration(cfg.Functions[pattern])
+				}
+			}
+		}
+	}
+	for id, ttl := range ttls {
+		if ttl <= 0 {
+			delete(ttls, id)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttls = ttls
+}
+
+// Call calls function through tb, unless a result of the same call is cached. It
+// reports whether the result comes from the cache.
+func (c *Cache) Call(ctx context.Context, tb ToolBelt, function string, args map[string]any) (map[string]any, bool, error) {
+	c.mu.Lock()
+	ttl, ok := c.ttls[function]
+	c.mu.Unlock()
+	if !ok {
+		res, err := tb.Call(ctx, function, args)
+		return res, false, err
+	}
+	key, err := cacheKey(ChatID(ctx), function, args)
+	if err != nil {
+		res, err := tb.Call(ctx, function, args)
+		return res, false, err
+	}
+
+	res, ok, err := c.store.GetResult(ctx, key)
+	if err != nil {
+		slog.Error("read tool cache", "function", function, "error", err)
+	}
+	if ok {
+		slog.Info("tool cache hit", "function", function, "chat", ChatID(ctx))
+		return res, true, nil
+	}
+
+	res, err = tb.Call(ctx, function, args)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := c.store.SaveResult(ctx, key, res, time.Now().Add(ttl)); err != nil {
+		slog.Error("save tool cache", "function", function, "error", err)
+	}
+	return res, false, nil
+}
+
+// cacheKey identifies a call by chat, function and arguments. Arguments are normalized
+// by JSON encoding, which sorts object keys, after dropping the null ones.
+func cacheKey(chatID, function string, args map[string]any) (string, error) {
+	normalized := make(map[string]any, len(args))
+	for k, v := range args {
+		if v != nil {
+			normalized[k] = v
+		}
+	}
+	b, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("encode arguments: %w", err)
+	}
+	h := sha256.New()
+	h.Write([]byte(chatID + "\x00" + function + "\x00"))
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var _ CacheStore = (*MemoryCache)(nil)
+
+// MemoryCache is a CacheStore keeping results in memory, up to a number of entries.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	result    []byte
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates a memory store of up to maxEntries results, a default number
+// when zero.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+	return &MemoryCache{maxEntries: maxEntries, entries: map[string]cacheEntry{}}
+}
+
+func (m *MemoryCache) GetResult(ctx context.Context, key string) (map[string]any, bool, error) {
+	m.mu.Lock()
+	e, ok := m.entries[key]
+	m.mu.Unlock()
+	if !ok || time.Now().After(e.expiresAt) {
+		return nil, false, nil
+	}
+	// Results are kept encoded so that callers can't alter the cached ones.
+	var res map[string]any
+	if err := json.Unmarshal(e.result, &res); err != nil {
+		return nil, false, err
+	}
+	return res, true, nil
+}
+
+func (m *MemoryCache) SaveResult(ctx context.Context, key string, result map[string]any, expiresAt time.Time) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[key]; !ok && len(m.entries) >= m.maxEntries {
+		m.evict()
+	}
+	m.entries[key] = cacheEntry{result: b, expiresAt: expiresAt}
+	return nil
+}
+
+// evict drops the expired entries, or the one expiring first when none is.
+func (m *MemoryCache) evict() {
+	now := time.Now()
+	var (
+		first   string
+		firstAt time.Time
+	)
+	for key, e := range m.entries {
+		if now.After(e.expiresAt) {
+			delete(m.entries, key)
+			continue
+		}
+		if first == "" || e.expiresAt.Before(firstAt) {
+			first, firstAt = key, e.expiresAt
+		}
+	}
+	if len(m.entries) >= m.maxEntries {
+		delete(m.entries, first)
+	}
+}
@@ -0,0 +1,61 @@
+package tool
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// cacheTestTool declares fs_read cacheable for a minute.
+type cacheTestTool struct{}
+
+func (cacheTestTool) Functions(context.Context) []Function {
+	return []Function{{ID: "fs_read", CacheTTL: time.Minute}, {ID: "fs_read_dir"}, {ID: "fs_write"}}
+}
+
+func (cacheTestTool) Call(context.Context, string, map[string]any) (map[string]any, error) {
+	return map[string]any{}, nil
+}
+
+func TestCacheReload(t *testing.T) {
+	var tool cacheTestTool
+	tb := ToolBelt{"fs_read": tool, "fs_read_dir": tool, "fs_write": tool}
+	tests := []struct {
+		name      string
+		functions map[string]Duration
+		want      map[string]time.Duration
+	}{
+		{
+			name: "declared",
+			want: map[string]time.Duration{"fs_read": time.Minute},
+		},
+		{
+			name:      "exact ID over a longer pattern",
+			functions: map[string]Duration{"fs_read": Duration(0), "fs_read*": Duration(time.Hour)},
+			want:      map[string]time.Duration{"fs_read_dir": time.Hour},
+		},
+		{
+			name:      "longer pattern over a shorter one",
+			functions: map[string]Duration{"fs_*": Duration(time.Second), "fs_read*": Duration(time.Hour)},
+			want:      map[string]time.Duration{"fs_read": time.Hour, "fs_read_dir": time.Hour, "fs_write": time.Second},
+		},
+		{
+			name:      "exact ID over a shorter pattern",
+			functions: map[string]Duration{"*": Duration(0), "fs_write": Duration(time.Second)},
+			want:      map[string]time.Duration{"fs_write": time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(nil, &CacheConfig{Functions: tt.functions}, tb)
+			if len(c.ttls) != len(tt.want) {
+				t.Errorf("TTLs = %v, want %v", c.ttls, tt.want)
+			}
+			for id, ttl := range tt.want {
+				if c.ttls[id] != ttl {
+					t.Errorf("TTL of %s = %v, want %v", id, c.ttls[id], ttl)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,598 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+	"github.com/jmoiron/sqlx"
+)
+
+var _ Tool = (*Data)(nil)
+
+const (
+	defaultDataMaxFileSize = 100 << 20
+	// dataMaxChats caps the number of chats whose datasets are kept in memory. The
+	// datasets of the least recently used chat are dropped first.
+	dataMaxChats = 8
+	// dataTopValues is the number of most frequent values reported by stats
+	dataTopValues = 5
+)
+
+// DataConfig lists the directories the data tool can load files from.
+type DataConfig struct {
+	// Roots are the directories data files are read from. Relative paths given by the
+	// model are resolved against the first one.
+	Roots []string `json:"roots"`
+	// MaxFileSize caps, in bytes, the size of the files loaded.
+	MaxFileSize int64 `json:"maxFileSize"`
+	// MaxRows caps the number of rows returned by a query.
+	MaxRows int `json:"maxRows"`
+	// Timeout bounds the execution time of a query.
+	Timeout Duration `json:"timeout"`
+}
+
+// Data loads CSV and JSON files into in-memory SQLite databases, one per chat, so the
+// model can analyze them with SQL.
+type Data struct {
+	roots       fsRoots
+	maxFileSize int64
+	maxRows     int
+	timeout     time.Duration
+
+	mu    sync.Mutex
+	chats map[string]*dataChat
+}
+
+// dataChat holds the datasets loaded in a chat.
+type dataChat struct {
+	db       *sqlx.DB
+	lastUsed time.Time
+}
+
+// NewData creates a data tool reading files from the configured roots.
+func NewData(cfg *DataConfig) (*Data, error) {
+	if cfg == nil || len(cfg.Roots) == 0 {
+		return nil, fmt.Errorf("at least one root directory is required")
+	}
+	d := &Data{
+		maxFileSize: cfg.MaxFileSize,
+		maxRows:     cfg.MaxRows,
+		timeout:     time.Duration(cfg.Timeout),
+		chats:       map[string]*dataChat{},
+	}
+	if d.maxFileSize <= 0 {
+		d.maxFileSize = defaultDataMaxFileSize
+	}
+	if d.maxRows <= 0 {
+		d.maxRows = defaultSQLMaxRows
+	}
+	if d.timeout <= 0 {
+		d.timeout = defaultSQLTimeout
+	}
+	roots, err := openRoots(cfg.Roots)
+	if err != nil {
+		return nil, err
+	}
+	d.roots = roots
+	return d, nil
+}
+
+// Close drops every dataset and releases the root directories.
+func (d *Data) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, c := range d.chats {
+		c.db.Close()
+		delete(d.chats, id)
+	}
+	return d.roots.Close()
+}
+
+func (d *Data) Functions(ctx context.Context) []Function {
+	table := jsonschema.JSONSchema{
+		Type:        "string",
+		Description: "The name of a loaded table",
+		Examples:    []any{"sales_2024"},
+	}
+	column := jsonschema.JSONSchema{
+		Type: "object",
+		Properties: map[string]jsonschema.JSONSchema{
+			"name": {Type: "string", Description: "The column name"},
+			"type": {Type: "string", Description: "The inferred type: INTEGER, REAL, BOOLEAN (stored as 0 or 1), DATE, DATETIME, JSON or TEXT. Dates are stored as ISO 8601 text."},
+		},
+	}
+
+	return []Function{
+		{
+			ID:          "data_load",
+			DisplayName: "Load Data File",
+			Description: "Loads a CSV or JSON file into a table of an in-memory SQLite database, inferring the column types. Use this function when the user asks questions about a data file, then query the table with data_query. Tables are kept for the rest of the chat. Files are read from: " + d.roots.paths() + ".",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for loading a data file",
+				Properties: map[string]jsonschema.JSONSchema{
+					"path": {
+						Type:        "string",
+						Description: "The path of the file, absolute or relative to " + d.roots[0].path + ". CSV files must start with a header row. JSON files hold an array of objects, an object with such an array, or one object per line.",
+						Examples:    []any{"exports/sales_2024.csv", "data/users.json"},
+					},
+					"table": {
+						Type:        "string",
+						Description: "The name of the table to create, replacing any table of the same name. Defaults to a name derived from the file name.",
+						Examples:    []any{"sales"},
+					},
+					"format": {
+						Type:        "string",
+						Description: "The file format, csv or json. Defaults to the one of the file extension.",
+						Examples:    []any{"csv", "json"},
+					},
+					"delimiter": {
+						Type:        "string",
+						Description: "The CSV field delimiter. Guessed from the header row by default.",
+						Examples:    []any{",", ";", "\t"},
+					},
+					"key": {
+						Type:        "string",
+						Description: "The key of the array of records when a JSON file holds an object. Defaults to the first non-empty array of the object.",
+						Examples:    []any{"items", "data"},
+					},
+				},
+				Required:         []string{"path"},
+				PropertyOrdering: []string{"path", "table", "format", "delimiter", "key"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The loaded table",
+				Properties: map[string]jsonschema.JSONSchema{
+					"table":   {Type: "string", Description: "The name of the table"},
+					"rows":    {Type: "integer", Description: "The number of rows loaded"},
+					"columns": {Type: "array", Description: "The columns of the table", Items: &column},
+				},
+			},
+		},
+		{
+			ID:          "data_query",
+			DisplayName: "Query Data",
+			Description: fmt.Sprintf("Runs a read-only SQLite query over the tables loaded with data_load and returns the results. Use aggregations rather than fetching raw rows, results are capped to %d rows.", d.maxRows),
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for querying loaded data",
+				Properties: map[string]jsonschema.JSONSchema{
+					"query": {
+						Type:        "string",
+						Description: "A single SELECT or WITH statement in SQLite syntax. Quote column names holding spaces or punctuation with double quotes.",
+						Examples:    []any{"SELECT region, SUM(amount) AS total FROM sales GROUP BY region ORDER BY total DESC", `SELECT strftime('%Y-%m', "order date") AS month, COUNT(*) FROM orders GROUP BY month`},
+					},
+				},
+				Required:         []string{"query"},
+				PropertyOrdering: []string{"query"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The query results",
+				Properties: map[string]jsonschema.JSONSchema{
+					"results":   {Type: "array", Description: "The rows returned by the query", Items: &jsonschema.JSONSchema{Type: "object"}},
+					"truncated": {Type: "boolean", Description: "True when the query returned more rows than included"},
+				},
+			},
+		},
+		{
+			ID:          "data_columns",
+			DisplayName: "List Data Columns",
+			Description: "Lists the tables loaded in this chat with their columns and row counts.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for listing columns",
+				Properties: map[string]jsonschema.JSONSchema{
+					"table": withDescription(table, "Only list the columns of this table. Defaults to every loaded table."),
+				},
+				PropertyOrdering: []string{"table"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The loaded tables",
+				Properties: map[string]jsonschema.JSONSchema{
+					"tables": {
+						Type: "array",
+						Items: &jsonschema.JSONSchema{
+							Type: "object",
+							Properties: map[string]jsonschema.JSONSchema{
+								"name":    {Type: "string", Description: "The name of the table"},
+								"rows":    {Type: "integer", Description: "The number of rows"},
+								"columns": {Type: "array", Description: "The columns of the table", Items: &column},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			ID:          "data_stats",
+			DisplayName: "Data Statistics",
+			Description: "Computes summary statistics for the columns of a loaded table: counts of values, missing values and distinct values, minimum, maximum, mean, sum and standard deviation of numeric columns, and the most frequent values of the others.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for computing statistics",
+				Properties: map[string]jsonschema.JSONSchema{
+					"table": table,
+					"columns": {
+						Type:        "array",
+						Description: "The columns to describe. Defaults to every column.",
+						Items:       &jsonschema.JSONSchema{Type: "string"},
+						Examples:    []any{[]any{"amount", "region"}},
+					},
+				},
+				Required:         []string{"table"},
+				PropertyOrdering: []string{"table", "columns"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The statistics of each column",
+				Properties: map[string]jsonschema.JSONSchema{
+					"table":   {Type: "string", Description: "The name of the table"},
+					"rows":    {Type: "integer", Description: "The number of rows"},
+					"columns": {Type: "array", Description: "The statistics of each column", Items: &jsonschema.JSONSchema{Type: "object"}},
+				},
+			},
+		},
+	}
+}
+
+func (d *Data) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	switch fn {
+	case "data_load":
+		path, ok := params["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("path parameter must be a string")
+		}
+		table, _ := params["table"].(string)
+		format, _ := params["format"].(string)
+		delimiter, _ := params["delimiter"].(string)
+		key, _ := params["key"].(string)
+		return d.load(ctx, path, table, format, delimiter, key)
+	case "data_query":
+		query, ok := params["query"].(string)
+		if !ok {
+			return nil, fmt.Errorf("query parameter must be a string")
+		}
+		return d.query(ctx, query)
+	case "data_columns":
+		table, _ := params["table"].(string)
+		return d.columns(ctx, table)
+	case "data_stats":
+		table, ok := params["table"].(string)
+		if !ok {
+			return nil, fmt.Errorf("table parameter must be a string")
+		}
+		var columns []string
+		if list, ok := params["columns"].([]any); ok {
+			for _, c := range list {
+				if s, ok := c.(string); ok {
+					columns = append(columns, s)
+				}
+			}
+		}
+		return d.stats(ctx, table, columns)
+	default:
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+}
+
+// db returns the database of the chat ctx is for, creating it when needed.
+func (d *Data) db(ctx context.Context) (*sqlx.DB, error) {
+	id := ChatID(ctx)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c, ok := d.chats[id]; ok {
+		c.lastUsed = time.Now()
+		return c.db, nil
+	}
+
+	if len(d.chats) >= dataMaxChats {
+		oldest := ""
+		for id, c := range d.chats {
+			if oldest == "" || c.lastUsed.Before(d.chats[oldest].lastUsed) {
+				oldest = id
+			}
+		}
+		d.chats[oldest].db.Close()
+		delete(d.chats, oldest)
+	}
+
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to :memory: opens a distinct database, so the one connection is
+	// kept for the lifetime of the chat.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	d.chats[id] = &dataChat{db: db, lastUsed: time.Now()}
+	return db, nil
+}
+
+// drop closes the database of a chat, unless it was already replaced.
+func (d *Data) drop(id string, db *sqlx.DB) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c, ok := d.chats[id]; ok && c.db == db {
+		delete(d.chats, id)
+	}
+	db.Close()
+}
+
+func (d *Data) load(ctx context.Context, path, table, format, delimiter, key string) (map[string]any, error) {
+	r, rel, err := d.roots.locate(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := r.root.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, d.maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > d.maxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", path, d.maxFileSize)
+	}
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(rel)), ".")
+	}
+	var ds *dataset
+	switch strings.ToLower(format) {
+	case "csv", "tsv", "txt":
+		var comma rune
+		if format == "tsv" {
+			comma = '\t'
+		}
+		if delimiter != "" {
+			comma = []rune(delimiter)[0]
+		}
+		ds, err = readCSV(content, comma)
+	case "json", "jsonl", "ndjson":
+		ds, err = readJSON(content, key)
+	default:
+		return nil, fmt.Errorf("unsupported format %q, use csv or json", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if table == "" {
+		table = tableName(rel)
+	}
+	db, err := d.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := storeDataset(ctx, db, table, ds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return map[string]any{"table": table, "rows": len(ds.rows), "columns": columns}, nil
+}
+
+func (d *Data) query(ctx context.Context, query string) (_ map[string]any, err error) {
+	keywords, err := statementKeywords(query)
+	if err != nil {
+		return nil, err
+	}
+	for _, keyword := range keywords {
+		if !slices.Contains(readStatements, keyword) {
+			return nil, fmt.Errorf("%s statements are not allowed, allowed statements are: %s", keyword, strings.Join(readStatements, ", "))
+		}
+	}
+	db, err := d.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+		return nil, err
+	}
+	// The connection is reused to load the next datasets. When it stays read-only, the
+	// chat starts over with a new database.
+	defer func() {
+		if _, resetErr := conn.ExecContext(context.Background(), "PRAGMA query_only = OFF"); resetErr != nil {
+			d.drop(ChatID(ctx), db)
+			err = fmt.Errorf("failed to reset the database, the loaded tables were dropped: %w", resetErr)
+		}
+	}()
+
+	rows, err := conn.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		results   []map[string]any
+		truncated bool
+	)
+	for rows.Next() {
+		if len(results) == d.maxRows {
+			truncated = true
+			break
+		}
+		row := make(map[string]any)
+		if err := rows.MapScan(row); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		for k, v := range row {
+			row[k] = sqlValue(v)
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return map[string]any{"results": results, "truncated": truncated}, nil
+}
+
+type dataColumn struct {
+	Name string `db:"name"`
+	Type string `db:"type"`
+}
+
+// tableColumns returns the columns of table, failing when it isn't loaded.
+func tableColumns(ctx context.Context, db *sqlx.DB, table string) ([]dataColumn, error) {
+	var columns []dataColumn
+	if err := db.SelectContext(ctx, &columns, "SELECT name, type FROM pragma_table_info(?)", table); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s is not loaded, load a file with data_load first", table)
+	}
+	return columns, nil
+}
+
+func (d *Data) columns(ctx context.Context, table string) (map[string]any, error) {
+	db, err := d.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tables := []string{table}
+	if table == "" {
+		tables = nil
+		if err := db.SelectContext(ctx, &tables, "SELECT name FROM sqlite_schema WHERE type = 'table' ORDER BY name"); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]map[string]any, 0, len(tables))
+	for _, t := range tables {
+		columns, err := tableColumns(ctx, db, t)
+		if err != nil {
+			return nil, err
+		}
+		var count int
+		if err := db.GetContext(ctx, &count, "SELECT COUNT(*) FROM "+quoteIdentifier(t)); err != nil {
+			return nil, err
+		}
+		cols := make([]map[string]any, len(columns))
+		for i, c := range columns {
+			cols[i] = map[string]any{"name": c.Name, "type": c.Type}
+		}
+		out = append(out, map[string]any{"name": t, "rows": count, "columns": cols})
+	}
+	return map[string]any{"tables": out}, nil
+}
+
+func (d *Data) stats(ctx context.Context, table string, only []string) (map[string]any, error) {
+	db, err := d.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	columns, err := tableColumns(ctx, db, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range only {
+		if !slices.ContainsFunc(columns, func(c dataColumn) bool { return c.Name == name }) {
+			return nil, fmt.Errorf("table %s has no column %s", table, name)
+		}
+	}
+
+	var count int
+	if err := db.GetContext(ctx, &count, "SELECT COUNT(*) FROM "+quoteIdentifier(table)); err != nil {
+		return nil, err
+	}
+	out := []map[string]any{}
+	for _, c := range columns {
+		if len(only) > 0 && !slices.Contains(only, c.Name) {
+			continue
+		}
+		s, err := columnStats(ctx, db, table, c)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.Name, err)
+		}
+		out = append(out, s)
+	}
+	return map[string]any{"table": table, "rows": count, "columns": out}, nil
+}
+
+func columnStats(ctx context.Context, db *sqlx.DB, table string, c dataColumn) (map[string]any, error) {
+	col, from := quoteIdentifier(c.Name), " FROM "+quoteIdentifier(table)
+	var counts struct {
+		Count    int `db:"count"`
+		Distinct int `db:"distinct_count"`
+	}
+	if err := db.GetContext(ctx, &counts, "SELECT COUNT("+col+") AS count, COUNT(DISTINCT "+col+") AS distinct_count"+from); err != nil {
+		return nil, err
+	}
+	var total int
+	if err := db.GetContext(ctx, &total, "SELECT COUNT(*)"+from); err != nil {
+		return nil, err
+	}
+	s := map[string]any{
+		"name":     c.Name,
+		"type":     c.Type,
+		"count":    counts.Count,
+		"missing":  total - counts.Count,
+		"distinct": counts.Distinct,
+	}
+	if counts.Count == 0 {
+		return s, nil
+	}
+
+	if c.Type == dataInteger || c.Type == dataReal {
+		row := db.QueryRowxContext(ctx, "SELECT MIN("+col+"), MAX("+col+"), AVG("+col+"), SUM("+col+"), AVG("+col+" * "+col+")"+from)
+		var minimum, maximum, sum any
+		var mean, meanSquares float64
+		if err := row.Scan(&minimum, &maximum, &mean, &sum, &meanSquares); err != nil {
+			return nil, err
+		}
+		s["min"], s["max"], s["sum"] = minimum, maximum, sum
+		s["mean"] = mean
+		s["stddev"] = math.Sqrt(math.Max(meanSquares-mean*mean, 0))
+		return s, nil
+	}
+
+	row := db.QueryRowxContext(ctx, "SELECT MIN("+col+"), MAX("+col+")"+from)
+	var minimum, maximum any
+	if err := row.Scan(&minimum, &maximum); err != nil {
+		return nil, err
+	}
+	s["min"], s["max"] = sqlValue(minimum), sqlValue(maximum)
+
+	rows, err := db.QueryxContext(ctx, fmt.Sprintf("SELECT %s AS value, COUNT(*) AS count%s WHERE %s IS NOT NULL GROUP BY %s ORDER BY count DESC, value LIMIT %d", col, from, col, col, dataTopValues))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var top []map[string]any
+	for rows.Next() {
+		var value any
+		var n int
+		if err := rows.Scan(&value, &n); err != nil {
+			return nil, err
+		}
+		top = append(top, map[string]any{"value": sqlValue(value), "count": n})
+	}
+	s["top"] = top
+	return s, rows.Err()
+}
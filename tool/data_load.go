@@ -0,0 +1,395 @@
+package tool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Column types inferred from the values of a dataset, from the most to the least
+// specific.
+const (
+	dataInteger  = "INTEGER"
+	dataReal     = "REAL"
+	dataBoolean  = "BOOLEAN"
+	dataDate     = "DATE"
+	dataDatetime = "DATETIME"
+	dataJSON     = "JSON"
+	dataText     = "TEXT"
+)
+
+// dataset is a table read from a file, with every value as text. Empty values are
+// missing ones.
+type dataset struct {
+	columns []string
+	rows    [][]string
+}
+
+// readCSV reads a CSV file whose first record holds the column names. The delimiter is
+// guessed from the first line when it is zero.
+func readCSV(data []byte, delimiter rune) (*dataset, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if delimiter == 0 {
+		delimiter = guessDelimiter(data)
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	ds := &dataset{columns: header}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Short records are padded and extra fields dropped.
+		row := make([]string, len(header))
+		copy(row, record)
+		ds.rows = append(ds.rows, row)
+	}
+	return ds, nil
+}
+
+// guessDelimiter returns the most frequent candidate delimiter of the first line.
+func guessDelimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	best, count := ',', 0
+	for _, d := range []rune{',', ';', '\t', '|'} {
+		if n := bytes.Count(line, []byte(string(d))); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+// readJSON reads an array of objects, an object holding such an array, or JSON lines.
+// The array of an object is the one under key, or its first non-empty array when key
+// is empty. Columns are the keys of the objects, in order of appearance. Nested values
+// are kept as JSON text.
+func readJSON(data []byte, key string) (*dataset, error) {
+	var records []json.RawMessage
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(trimmed, []byte("{")) && json.Valid(trimmed):
+		var err error
+		records, key, err = wrappedRecords(trimmed, key)
+		if err != nil {
+			return nil, err
+		}
+		if records == nil {
+			records = []json.RawMessage{trimmed}
+		}
+	default:
+		if key != "" {
+			return nil, fmt.Errorf("key %q requires a JSON object", key)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(nil, len(trimmed)+1)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				records = append(records, json.RawMessage(bytes.Clone(line)))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	ds := &dataset{}
+	index := map[string]int{}
+	for i, raw := range records {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			if key != "" {
+				return nil, fmt.Errorf("record %d of %q is not an object, set the key of another array: %w", i+1, key, err)
+			}
+			return nil, fmt.Errorf("record %d is not an object: %w", i+1, err)
+		}
+		row := make([]string, len(ds.columns), len(ds.columns)+len(record))
+		for _, key := range jsonKeys(raw) {
+			col, ok := index[key]
+			if !ok {
+				col = len(ds.columns)
+				index[key] = col
+				ds.columns = append(ds.columns, key)
+				row = append(row, "")
+			}
+			row[col] = jsonText(record[key])
+		}
+		ds.rows = append(ds.rows, row)
+	}
+	for i, row := range ds.rows {
+		for len(row) < len(ds.columns) {
+			row = append(row, "")
+		}
+		ds.rows[i] = row
+	}
+	if len(ds.columns) == 0 {
+		return nil, fmt.Errorf("no records found")
+	}
+	return ds, nil
+}
+
+// jsonKeys returns the keys of a JSON object in document order, which maps lose.
+// wrappedRecords returns the records of the array under key in a JSON object, or of
+// its first non-empty array in document order when key is empty, along with the key
+// they were read from. Records are nil when key is empty and the object holds no
+// non-empty array.
+func wrappedRecords(data []byte, key string) ([]json.RawMessage, string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, "", err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, "", err
+		}
+		name := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, "", err
+		}
+		if key != "" && name != key {
+			continue
+		}
+		if !bytes.HasPrefix(value, []byte("[")) {
+			if key != "" {
+				return nil, "", fmt.Errorf("the value of %q is not an array", key)
+			}
+			continue
+		}
+		var records []json.RawMessage
+		if err := json.Unmarshal(value, &records); err != nil {
+			return nil, "", err
+		}
+		if key != "" {
+			return records, key, nil
+		}
+		if len(records) > 0 {
+			return records, name, nil
+		}
+	}
+	if key != "" {
+		return nil, "", fmt.Errorf("the object has no %q key", key)
+	}
+	return nil, "", nil
+}
+
+func jsonKeys(raw json.RawMessage) []string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+func jsonText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// inferType returns the most specific type matching every non-empty value.
+func inferType(values []string) string {
+	candidates := []string{dataInteger, dataReal, dataBoolean, dataDate, dataDatetime, dataJSON}
+	seen := false
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		seen = true
+		kept := candidates[:0]
+		for _, typ := range candidates {
+			if _, ok := convertValue(typ, v); ok {
+				kept = append(kept, typ)
+			}
+		}
+		candidates = kept
+		if len(candidates) == 0 {
+			return dataText
+		}
+	}
+	if !seen {
+		return dataText
+	}
+	return candidates[0]
+}
+
+// convertValue converts v to the Go value stored for typ, reporting whether v is valid
+// for typ.
+func convertValue(typ, v string) (any, bool) {
+	switch typ {
+	case dataInteger:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case dataReal:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case dataBoolean:
+		switch strings.ToLower(v) {
+		case "true", "yes":
+			return true, true
+		case "false", "no":
+			return false, true
+		}
+		return nil, false
+	case dataDate:
+		_, err := time.Parse(time.DateOnly, v)
+		return v, err == nil
+	case dataDatetime:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04"} {
+			if _, err := time.Parse(layout, v); err == nil {
+				return v, true
+			}
+		}
+		return nil, false
+	case dataJSON:
+		return v, (strings.HasPrefix(v, "{") || strings.HasPrefix(v, "[")) && json.Valid([]byte(v))
+	default:
+		return v, true
+	}
+}
+
+// storeDataset creates table from ds, replacing any table of the same name, and
+// returns its columns.
+func storeDataset(ctx context.Context, db *sqlx.DB, table string, ds *dataset) ([]map[string]any, error) {
+	names := columnNames(ds.columns)
+	types := make([]string, len(names))
+	defs := make([]string, len(names))
+	values := make([]string, len(ds.rows))
+	for i, name := range names {
+		for r, row := range ds.rows {
+			values[r] = row[i]
+		}
+		types[i] = inferType(values)
+		defs[i] = quoteIdentifier(name) + " " + types[i]
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+quoteIdentifier(table)); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "CREATE TABLE "+quoteIdentifier(table)+" ("+strings.Join(defs, ", ")+")"); err != nil {
+		return nil, fmt.Errorf("create table: %w", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO "+quoteIdentifier(table)+" VALUES ("+strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")+")")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	args := make([]any, len(names))
+	for _, row := range ds.rows {
+		for i, v := range row {
+			args[i] = nil
+			if v != "" {
+				args[i], _ = convertValue(types[i], v)
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return nil, fmt.Errorf("insert row: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	columns := make([]map[string]any, len(names))
+	for i, name := range names {
+		columns[i] = map[string]any{"name": name, "type": types[i]}
+	}
+	return columns, nil
+}
+
+// columnNames makes unique, non-empty column names out of a header.
+func columnNames(header []string) []string {
+	names := make([]string, len(header))
+	seen := map[string]int{}
+	for i, h := range header {
+		name := strings.TrimSpace(h)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if n := seen[strings.ToLower(name)]; n > 0 {
+			seen[strings.ToLower(name)]++
+			name = fmt.Sprintf("%s_%d", name, n+1)
+		}
+		seen[strings.ToLower(name)]++
+		names[i] = name
+	}
+	return names
+}
+
+// tableName derives a table name from a file path, such as sales_2024 for
+// exports/Sales 2024.csv.
+func tableName(path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var b strings.Builder
+	for _, r := range strings.ToLower(base) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "_")
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "t_" + name
+	}
+	return name
+}
@@ -0,0 +1,78 @@
+package tool
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		key     string
+		want    *dataset
+		wantErr string
+	}{
+		{
+			name: "array",
+			data: `[{"b": 1, "a": "x"}, {"a": "y", "c": {"d": true}}]`,
+			want: &dataset{columns: []string{"b", "a", "c"}, rows: [][]string{{"1", "x", ""}, {"", "y", `{"d":true}`}}},
+		},
+		{
+			name: "lines",
+			data: "{\"a\": 1}\n\n{\"a\": 2.5}\n",
+			want: &dataset{columns: []string{"a"}, rows: [][]string{{"1"}, {"2.5"}}},
+		},
+		{
+			name: "first non-empty array",
+			data: `{"total": 2, "errors": [], "items": [{"id": 1}, {"id": 2}], "links": [{"href": "/next"}]}`,
+			want: &dataset{columns: []string{"id"}, rows: [][]string{{"1"}, {"2"}}},
+		},
+		{
+			name: "array under key",
+			data: `{"items": [{"id": 1}], "links": [{"href": "/next"}]}`,
+			key:  "links",
+			want: &dataset{columns: []string{"href"}, rows: [][]string{{"/next"}}},
+		},
+		{
+			name: "object without array",
+			data: `{"id": 1, "tags": []}`,
+			want: &dataset{columns: []string{"id", "tags"}, rows: [][]string{{"1", "[]"}}},
+		},
+		{
+			name:    "array of values",
+			data:    `{"tags": ["a", "b"], "items": [{"id": 1}]}`,
+			wantErr: `record 1 of "tags" is not an object, set the key of another array`,
+		},
+		{
+			name:    "missing key",
+			data:    `{"items": [{"id": 1}]}`,
+			key:     "data",
+			wantErr: `the object has no "data" key`,
+		},
+		{
+			name:    "key of a value",
+			data:    `{"items": [{"id": 1}], "total": 1}`,
+			key:     "total",
+			wantErr: `the value of "total" is not an array`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readJSON([]byte(tt.data), tt.key)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readJSON() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+)
+
+var _ Tool = (*Declared)(nil)
+
+const (
+	defaultDeclaredTimeout   = 30 * time.Second
+	defaultDeclaredMaxLength = 100_000
+)
+
+// DeclaredConfig defines a tool without Go code: a single function running a command or
+// an HTTP request built from templates. Templates use the text/template syntax, with
+// the function arguments as data, such as {{.city}}. The json and env functions encode
+// a value as JSON and read an environment variable.
+type DeclaredConfig struct {
+	Name        string                `json:"-"`
+	DisplayName string                `json:"displayName"`
+	Description string                `json:"description"`
+	Parameters  jsonschema.JSONSchema `json:"parameters"`
+	Response    jsonschema.JSONSchema `json:"response"`
+	// Command runs a command, without a shell. Either Command or HTTP must be set.
+	Command *DeclaredCommand `json:"command"`
+	// HTTP sends an HTTP request.
+	HTTP *DeclaredHTTP `json:"http"`
+	// Result maps the output to the function result.
+	Result DeclaredResult `json:"result"`
+	// Timeout bounds the execution time of the command or request.
+	Timeout Duration `json:"timeout"`
+}
+
+// DeclaredCommand is a command template. Each argument is a template.
+type DeclaredCommand struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args"`
+	Dir     string            `json:"dir"`
+	Env     map[string]string `json:"env"`
+	// Stdin is a template of the command input.
+	Stdin string `json:"stdin"`
+}
+
+// DeclaredHTTP is an HTTP request template. The URL, header values and body are
+// templates.
+type DeclaredHTTP struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// DeclaredResult maps the output of a declared tool to its result. JSON outputs are
+// decoded, other outputs are returned as text under "result".
+type DeclaredResult struct {
+	// Path selects the part of a JSON output to return, as dot separated keys and array
+	// indexes, such as "data.items" or "results.0.name".
+	Path string `json:"path"`
+	// Fields builds the result from parts of a JSON output, mapping result keys to paths.
+	Fields map[string]string `json:"fields"`
+	// MaxLength caps, in characters, the length of text outputs.
+	MaxLength int `json:"maxLength"`
+}
+
+type Declared struct {
+	cfg     DeclaredConfig
+	timeout time.Duration
+	args    []*template.Template
+	stdin   *template.Template
+	url     *template.Template
+	headers map[string]*template.Template
+	body    *template.Template
+	client  *http.Client
+}
+
+// NewDeclared creates the tool defined by cfg. Templates are parsed upfront so that
+// mistakes are reported at startup.
+func NewDeclared(cfg *DeclaredConfig) (*Declared, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("missing tool definition")
+	}
+	if (cfg.Command == nil) == (cfg.HTTP == nil) {
+		return nil, fmt.Errorf("tool %s must define either a command or an http request", cfg.Name)
+	}
+	d := &Declared{cfg: *cfg, timeout: time.Duration(cfg.Timeout)}
+	if d.timeout <= 0 {
+		d.timeout = defaultDeclaredTimeout
+	}
+	if d.cfg.Result.MaxLength <= 0 {
+		d.cfg.Result.MaxLength = defaultDeclaredMaxLength
+	}
+	if d.cfg.Parameters.Type == "" {
+		d.cfg.Parameters.Type = "object"
+	}
+
+	var err error
+	parse := func(name, text string) *template.Template {
+		if err != nil {
+			return nil
+		}
+		var t *template.Template
+		t, err = template.New(name).Funcs(declaredFuncs).Parse(text)
+		if err != nil {
+			err = fmt.Errorf("tool %s: %w", cfg.Name, err)
+		}
+		return t
+	}
+	switch {
+	case cfg.Command != nil:
+		if cfg.Command.Command == "" {
+			return nil, fmt.Errorf("tool %s has an empty command", cfg.Name)
+		}
+		for i, arg := range cfg.Command.Args {
+			d.args = append(d.args, parse("arg "+strconv.Itoa(i+1), arg))
+		}
+		d.stdin = parse("stdin", cfg.Command.Stdin)
+	default:
+		if cfg.HTTP.URL == "" {
+			return nil, fmt.Errorf("tool %s has an empty url", cfg.Name)
+		}
+		d.url = parse("url", cfg.HTTP.URL)
+		d.body = parse("body", cfg.HTTP.Body)
+		d.headers = map[string]*template.Template{}
+		for k, v := range cfg.HTTP.Headers {
+			d.headers[k] = parse("header "+k, v)
+		}
+		d.client = &http.Client{Timeout: d.timeout}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+var declaredFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"env": os.Getenv,
+}
+
+// Name returns the name of the tool, which is also the ID of its function.
+func (d *Declared) Name() string {
+	return d.cfg.Name
+}
+
+func (d *Declared) Functions(ctx context.Context) []Function {
+	return []Function{
+		{
+			ID:          d.cfg.Name,
+			DisplayName: d.cfg.DisplayName,
+			Description: d.cfg.Description,
+			Parameters:  d.cfg.Parameters,
+			Response:    d.cfg.Response,
+		},
+	}
+}
+
+func (d *Declared) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	if fn != d.cfg.Name {
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+	// Optional parameters the model left out render as empty strings.
+	data := make(map[string]any, len(d.cfg.Parameters.Properties)+len(params))
+	for name := range d.cfg.Parameters.Properties {
+		data[name] = ""
+	}
+	for k, v := range params {
+		data[k] = v
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	var (
+		out []byte
+		err error
+	)
+	if d.cfg.Command != nil {
+		out, err = d.runCommand(ctx, data)
+	} else {
+		out, err = d.sendRequest(ctx, data)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%s timed out after %s", d.cfg.Name, d.timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.result(out)
+}
+
+func (d *Declared) runCommand(ctx context.Context, data map[string]any) ([]byte, error) {
+	args := make([]string, len(d.args))
+	for i, t := range d.args {
+		arg, err := render(t, data)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+	stdin, err := render(d.stdin, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, d.cfg.Command.Command, args...)
+	cmd.Dir = d.cfg.Command.Dir
+	cmd.Env = os.Environ()
+	for k, v := range d.cfg.Command.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return nil, fmt.Errorf("%s failed with exit code %d: %s", d.cfg.Name, exitErr.ExitCode(), d.truncate(msg))
+	case err != nil:
+		return nil, fmt.Errorf("run %s: %w", d.cfg.Name, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+func (d *Declared) sendRequest(ctx context.Context, data map[string]any) ([]byte, error) {
+	url, err := render(d.url, data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := render(d.body, data)
+	if err != nil {
+		return nil, err
+	}
+	method := strings.ToUpper(d.cfg.HTTP.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid request: %w", d.cfg.Name, err)
+	}
+	for k, t := range d.headers {
+		v, err := render(t, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, v)
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", d.cfg.Name, err)
+	}
+	defer res.Body.Close()
+	out, err := io.ReadAll(io.LimitReader(res.Body, defaultHTTPMaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to read response: %w", d.cfg.Name, err)
+	}
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s failed with status %s: %s", d.cfg.Name, res.Status, d.truncate(strings.TrimSpace(string(out))))
+	}
+	return out, nil
+}
+
+// result maps the output of the command or request to the function result.
+func (d *Declared) result(out []byte) (map[string]any, error) {
+	var decoded any
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		if d.cfg.Result.Path != "" || len(d.cfg.Result.Fields) > 0 {
+			return nil, fmt.Errorf("%s returned invalid JSON: %w", d.cfg.Name, err)
+		}
+		return map[string]any{"result": d.truncate(strings.TrimSpace(string(out)))}, nil
+	}
+
+	if len(d.cfg.Result.Fields) > 0 {
+		result := make(map[string]any, len(d.cfg.Result.Fields))
+		for key, path := range d.cfg.Result.Fields {
+			result[key], _ = lookupPath(decoded, path)
+		}
+		return result, nil
+	}
+	if d.cfg.Result.Path != "" {
+		v, ok := lookupPath(decoded, d.cfg.Result.Path)
+		if !ok {
+			return nil, fmt.Errorf("%s returned no value at %s", d.cfg.Name, d.cfg.Result.Path)
+		}
+		decoded = v
+	}
+	if m, ok := decoded.(map[string]any); ok {
+		return m, nil
+	}
+	return map[string]any{"result": decoded}, nil
+}
+
+func (d *Declared) truncate(s string) string {
+	if len(s) > d.cfg.Result.MaxLength {
+		return strings.ToValidUTF8(s[:d.cfg.Result.MaxLength], "") + "..."
+	}
+	return s
+}
+
+// render executes t with data, an empty string for a nil template.
+func render(t *template.Template, data map[string]any) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// lookupPath returns the value at a dot separated path of object keys and array
+// indexes.
+func lookupPath(v any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
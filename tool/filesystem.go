@@ -0,0 +1,714 @@
+package tool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+)
+
+var _ Tool = (*FileSystem)(nil)
+
+const (
+	defaultFSMaxFileSize = 1 << 20
+	defaultFSMaxResults  = 200
+	// fsSniffSize is the number of bytes read to tell binary files from text files
+	fsSniffSize = 8000
+	// fsMaxLineLength truncates the lines returned by grep
+	fsMaxLineLength = 500
+)
+
+// FileSystemConfig lists the directories the file system tool can access.
+type FileSystemConfig struct {
+	// Roots are the directories the tool is confined to. Relative paths given by the
+	// model are resolved against the first one.
+	Roots []string `json:"roots"`
+	// AllowWrites exposes the write and move functions.
+	AllowWrites bool `json:"allowWrites"`
+	// MaxFileSize caps, in bytes, the size of the files read, written or searched.
+	MaxFileSize int64 `json:"maxFileSize"`
+	// MaxResults caps the number of entries, matches or lines returned by a call.
+	MaxResults int `json:"maxResults"`
+}
+
+type fsRoot struct {
+	path string
+	root *os.Root
+}
+
+// fsRoots are the directories a tool is confined to.
+type fsRoots []*fsRoot
+
+// openRoots opens dirs as roots. Symbolic links are followed as long as they don't
+// lead outside of their root.
+func openRoots(dirs []string) (fsRoots, error) {
+	var roots fsRoots
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			roots.Close()
+			return nil, fmt.Errorf("resolve root %s: %w", dir, err)
+		}
+		if abs, err = filepath.EvalSymlinks(abs); err != nil {
+			roots.Close()
+			return nil, fmt.Errorf("resolve root %s: %w", dir, err)
+		}
+		root, err := os.OpenRoot(abs)
+		if err != nil {
+			roots.Close()
+			return nil, fmt.Errorf("open root %s: %w", dir, err)
+		}
+		roots = append(roots, &fsRoot{path: abs, root: root})
+	}
+	return roots, nil
+}
+
+// Close releases the root directories.
+func (rs fsRoots) Close() error {
+	var errs []error
+	for _, r := range rs {
+		errs = append(errs, r.root.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (rs fsRoots) paths() string {
+	paths := make([]string, len(rs))
+	for i, r := range rs {
+		paths[i] = r.path
+	}
+	return strings.Join(paths, ", ")
+}
+
+// locate returns the root holding p, and p relative to that root. Relative paths are
+// resolved against the first root.
+func (rs fsRoots) locate(p string) (*fsRoot, string, error) {
+	if p == "" {
+		p = "."
+	}
+	if !filepath.IsAbs(p) {
+		rel := filepath.Clean(p)
+		if !filepath.IsLocal(rel) {
+			return nil, "", fmt.Errorf("path %s is outside of the allowed directories: %s", p, rs.paths())
+		}
+		return rs[0], rel, nil
+	}
+	for _, r := range rs {
+		rel, err := filepath.Rel(r.path, p)
+		if err == nil && filepath.IsLocal(rel) {
+			return r, rel, nil
+		}
+	}
+	return nil, "", fmt.Errorf("path %s is outside of the allowed directories: %s", p, rs.paths())
+}
+
+type FileSystem struct {
+	roots       fsRoots
+	allowWrites bool
+	maxFileSize int64
+	maxResults  int
+}
+
+// NewFileSystem creates a file system tool confined to the configured roots. Symbolic
+// links are followed as long as they don't lead outside of their root.
+func NewFileSystem(cfg *FileSystemConfig) (*FileSystem, error) {
+	if cfg == nil || len(cfg.Roots) == 0 {
+		return nil, fmt.Errorf("at least one root directory is required")
+	}
+	f := &FileSystem{
+		allowWrites: cfg.AllowWrites,
+		maxFileSize: cfg.MaxFileSize,
+		maxResults:  cfg.MaxResults,
+	}
+	if f.maxFileSize <= 0 {
+		f.maxFileSize = defaultFSMaxFileSize
+	}
+	if f.maxResults <= 0 {
+		f.maxResults = defaultFSMaxResults
+	}
+
+	roots, err := openRoots(cfg.Roots)
+	if err != nil {
+		return nil, err
+	}
+	f.roots = roots
+	return f, nil
+}
+
+// Close releases the root directories.
+func (f *FileSystem) Close() error {
+	return f.roots.Close()
+}
+
+func (f *FileSystem) Functions(ctx context.Context) []Function {
+	location := "an absolute path inside one of the allowed directories (" + f.roots.paths() + "), or a path relative to " + f.roots[0].path
+	pathParameter := jsonschema.JSONSchema{
+		Type:        "string",
+		Description: "The file path, " + location + ".",
+		Examples:    []any{"README.md", filepath.Join(f.roots[0].path, "go.mod")},
+	}
+	dirParameter := jsonschema.JSONSchema{
+		Type:        "string",
+		Description: "The directory path, " + location + ". Defaults to " + f.roots[0].path + ".",
+		Examples:    []any{".", "cmd"},
+	}
+
+	functions := []Function{
+		{
+			ID:          "fs_read",
+			DisplayName: "Read File",
+			Description: fmt.Sprintf("Reads a text file. Use this function to look at the content of a file. Binary files can't be read and files larger than %d bytes are truncated.", f.maxFileSize),
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for reading a file",
+				Properties: map[string]jsonschema.JSONSchema{
+					"path": pathParameter,
+				},
+				Required:         []string{"path"},
+				PropertyOrdering: []string{"path"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The content of the file",
+				Properties: map[string]jsonschema.JSONSchema{
+					"path":      {Type: "string", Description: "The absolute path of the file"},
+					"content":   {Type: "string", Description: "The content of the file"},
+					"size":      {Type: "integer", Description: "The size of the file in bytes"},
+					"truncated": {Type: "boolean", Description: "True when only the beginning of the file is returned"},
+				},
+			},
+		},
+		{
+			ID:          "fs_list",
+			DisplayName: "List Directory",
+			Description: "Lists the entries of a directory. Use this function to explore the files available.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for listing a directory",
+				Properties: map[string]jsonschema.JSONSchema{
+					"path": dirParameter,
+				},
+				PropertyOrdering: []string{"path"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The entries of the directory",
+				Properties: map[string]jsonschema.JSONSchema{
+					"entries": {
+						Type:        "array",
+						Description: "The entries of the directory, sorted by name",
+						Items: &jsonschema.JSONSchema{
+							Type:        "object",
+							Description: "A directory entry",
+							Properties: map[string]jsonschema.JSONSchema{
+								"name":     {Type: "string", Description: "The entry name"},
+								"type":     {Type: "string", Description: "One of 'file', 'dir' or 'symlink'"},
+								"size":     {Type: "integer", Description: "The size of the entry in bytes"},
+								"modified": {Type: "string", Description: "The last modification time, RFC 3339 formatted"},
+							},
+						},
+					},
+					"truncated": {Type: "boolean", Description: "True when the directory holds more entries than returned"},
+				},
+			},
+		},
+		{
+			ID:          "fs_glob",
+			DisplayName: "Find Files",
+			Description: "Finds the files whose path matches a glob pattern. Use this function to locate files by name.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for finding files",
+				Properties: map[string]jsonschema.JSONSchema{
+					"pattern": {
+						Type:        "string",
+						Description: "A glob pattern matched against paths relative to the searched directory, using / as separator. * matches any sequence of characters but /, ? any single character, and ** any number of directories.",
+						Examples:    []any{"*.go", "**/*_test.go", "docs/**/*.md"},
+					},
+					"path": dirParameter,
+				},
+				Required:         []string{"pattern"},
+				PropertyOrdering: []string{"pattern", "path"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The matching files",
+				Properties: map[string]jsonschema.JSONSchema{
+					"paths":     {Type: "array", Description: "The absolute paths of the matching files", Items: &jsonschema.JSONSchema{Type: "string"}},
+					"truncated": {Type: "boolean", Description: "True when more files match than returned"},
+				},
+			},
+		},
+		{
+			ID:          "fs_grep",
+			DisplayName: "Search Files",
+			Description: "Searches the lines of text files matching a regular expression. Use this function to find where something is mentioned. Binary and oversized files are skipped.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for searching files",
+				Properties: map[string]jsonschema.JSONSchema{
+					"pattern": {
+						Type:        "string",
+						Description: "A regular expression, in Go RE2 syntax, matched against each line",
+						Examples:    []any{"func main", "(?i)todo", `\bNewSQL\(`},
+					},
+					"path": {
+						Type:        "string",
+						Description: "The file or directory to search, " + location + ". Defaults to " + f.roots[0].path + ".",
+						Examples:    []any{".", "tool/sql.go"},
+					},
+					"include": {
+						Type:        "string",
+						Description: "A glob pattern restricting the searched files, as in fs_glob",
+						Examples:    []any{"**/*.go"},
+					},
+				},
+				Required:         []string{"pattern"},
+				PropertyOrdering: []string{"pattern", "path", "include"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The matching lines",
+				Properties: map[string]jsonschema.JSONSchema{
+					"matches": {
+						Type:        "array",
+						Description: "The matching lines",
+						Items: &jsonschema.JSONSchema{
+							Type:        "object",
+							Description: "A matching line",
+							Properties: map[string]jsonschema.JSONSchema{
+								"path": {Type: "string", Description: "The absolute path of the file"},
+								"line": {Type: "integer", Description: "The line number, starting at 1"},
+								"text": {Type: "string", Description: "The line content"},
+							},
+						},
+					},
+					"truncated": {Type: "boolean", Description: "True when more lines match than returned"},
+				},
+			},
+		},
+	}
+	if !f.allowWrites {
+		return functions
+	}
+
+	return append(functions,
+		Function{
+			ID:          "fs_write",
+			DisplayName: "Write File",
+			Description: "Writes a text file, replacing its content if it exists and creating missing parent directories. Use this function only when the user asks to create or modify a file.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for writing a file",
+				Properties: map[string]jsonschema.JSONSchema{
+					"path":    pathParameter,
+					"content": {Type: "string", Description: "The new content of the file"},
+				},
+				Required:         []string{"path", "content"},
+				PropertyOrdering: []string{"path", "content"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The written file",
+				Properties: map[string]jsonschema.JSONSchema{
+					"path": {Type: "string", Description: "The absolute path of the file"},
+					"size": {Type: "integer", Description: "The number of bytes written"},
+				},
+			},
+		},
+		Function{
+			ID:          "fs_move",
+			DisplayName: "Move File",
+			Description: "Moves or renames a file or directory. Use this function only when the user asks to move or rename a file.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for moving a file",
+				Properties: map[string]jsonschema.JSONSchema{
+					"source":      pathParameter,
+					"destination": pathParameter,
+				},
+				Required:         []string{"source", "destination"},
+				PropertyOrdering: []string{"source", "destination"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The moved file",
+				Properties: map[string]jsonschema.JSONSchema{
+					"path": {Type: "string", Description: "The new absolute path of the file"},
+				},
+			},
+		},
+	)
+}
+
+func (f *FileSystem) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	p, _ := params["path"].(string)
+	switch fn {
+	case "fs_read":
+		return f.read(p)
+	case "fs_list":
+		return f.list(p)
+	case "fs_glob":
+		pattern, ok := params["pattern"].(string)
+		if !ok {
+			return nil, fmt.Errorf("pattern parameter must be a string")
+		}
+		return f.glob(ctx, p, pattern)
+	case "fs_grep":
+		pattern, ok := params["pattern"].(string)
+		if !ok {
+			return nil, fmt.Errorf("pattern parameter must be a string")
+		}
+		include, _ := params["include"].(string)
+		return f.grep(ctx, p, pattern, include)
+	case "fs_write", "fs_move":
+		if !f.allowWrites {
+			return nil, fmt.Errorf("writing files is not allowed")
+		}
+		if fn == "fs_move" {
+			src, _ := params["source"].(string)
+			dst, _ := params["destination"].(string)
+			return f.move(src, dst)
+		}
+		content, ok := params["content"].(string)
+		if !ok {
+			return nil, fmt.Errorf("content parameter must be a string")
+		}
+		return f.write(p, content)
+	default:
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+}
+
+func (f *FileSystem) read(p string) (map[string]any, error) {
+	r, rel, err := f.roots.locate(p)
+	if err != nil {
+		return nil, err
+	}
+	file, err := r.root.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory, use fs_list to see its entries", p)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, f.maxFileSize))
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(content) {
+		return nil, fmt.Errorf("%s is a binary file of %d bytes", p, info.Size())
+	}
+	return map[string]any{
+		"path":      filepath.Join(r.path, rel),
+		"content":   string(content),
+		"size":      info.Size(),
+		"truncated": info.Size() > f.maxFileSize,
+	}, nil
+}
+
+func (f *FileSystem) list(p string) (map[string]any, error) {
+	r, rel, err := f.roots.locate(p)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(r.root.FS(), filepath.ToSlash(rel))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]map[string]any, 0, min(len(entries), f.maxResults))
+	for _, e := range entries[:min(len(entries), f.maxResults)] {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		typ := "file"
+		switch {
+		case e.IsDir():
+			typ = "dir"
+		case e.Type()&fs.ModeSymlink != 0:
+			typ = "symlink"
+		}
+		out = append(out, map[string]any{
+			"name":     e.Name(),
+			"type":     typ,
+			"size":     info.Size(),
+			"modified": info.ModTime().Format(time.RFC3339),
+		})
+	}
+	return map[string]any{"entries": out, "truncated": len(entries) > f.maxResults}, nil
+}
+
+// walk calls fn with the path, relative to dir, of every regular file under dir.
+// Symbolic links to directories are not followed.
+func (f *FileSystem) walk(ctx context.Context, r *fsRoot, dir string, fn func(rel string, d fs.DirEntry) (stop bool)) error {
+	return fs.WalkDir(r.root.FS(), filepath.ToSlash(dir), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable entries rather than failing the whole search.
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, filepath.ToSlash(dir)), "/")
+		if dir == "." {
+			rel = p
+		}
+		if fn(rel, d) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+}
+
+func (f *FileSystem) glob(ctx context.Context, dir, pattern string) (map[string]any, error) {
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	r, rel, err := f.roots.locate(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		paths     []string
+		truncated bool
+	)
+	err = f.walk(ctx, r, rel, func(p string, _ fs.DirEntry) bool {
+		if !matchGlob(pattern, p) {
+			return false
+		}
+		if len(paths) == f.maxResults {
+			truncated = true
+			return true
+		}
+		paths = append(paths, filepath.Join(r.path, rel, filepath.FromSlash(p)))
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"paths": paths, "truncated": truncated}, nil
+}
+
+func (f *FileSystem) grep(ctx context.Context, p, pattern, include string) (map[string]any, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	r, rel, err := f.roots.locate(p)
+	if err != nil {
+		return nil, err
+	}
+	info, err := r.root.Stat(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		matches   []map[string]any
+		truncated bool
+	)
+	search := func(file string) bool {
+		err := f.grepFile(r, file, re, func(line int, text string) bool {
+			if len(matches) == f.maxResults {
+				truncated = true
+				return true
+			}
+			if len(text) > fsMaxLineLength {
+				text = text[:fsMaxLineLength] + "..."
+			}
+			matches = append(matches, map[string]any{
+				"path": filepath.Join(r.path, file),
+				"line": line,
+				"text": text,
+			})
+			return false
+		})
+		return err == nil && truncated
+	}
+
+	if !info.IsDir() {
+		search(rel)
+	} else {
+		err = f.walk(ctx, r, rel, func(file string, d fs.DirEntry) bool {
+			if include != "" && !matchGlob(include, file) {
+				return false
+			}
+			return search(filepath.Join(rel, filepath.FromSlash(file)))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return map[string]any{"matches": matches, "truncated": truncated}, nil
+}
+
+// grepFile calls match with every line of file matching re, until it returns true.
+// Binary and oversized files are skipped.
+func (f *FileSystem) grepFile(r *fsRoot, file string, re *regexp.Regexp, match func(line int, text string) (stop bool)) error {
+	fd, err := r.root.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Size() > f.maxFileSize {
+		return nil
+	}
+
+	br := bufio.NewReader(fd)
+	head, _ := br.Peek(fsSniffSize)
+	if isBinary(head) {
+		return nil
+	}
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 0, 64*1024), int(f.maxFileSize))
+	for line := 1; scanner.Scan(); line++ {
+		if re.Match(scanner.Bytes()) && match(line, scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func (f *FileSystem) write(p, content string) (map[string]any, error) {
+	if int64(len(content)) > f.maxFileSize {
+		return nil, fmt.Errorf("content of %d bytes exceeds the %d bytes limit", len(content), f.maxFileSize)
+	}
+	r, rel, err := f.roots.locate(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := mkdirAll(r.root, filepath.Dir(rel)); err != nil {
+		return nil, err
+	}
+	file, err := r.root.OpenFile(rel, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+	return map[string]any{"path": filepath.Join(r.path, rel), "size": len(content)}, nil
+}
+
+// move renames src to dst. os.Root can't rename files, so both paths are first checked
+// to resolve inside their root.
+func (f *FileSystem) move(src, dst string) (map[string]any, error) {
+	sr, srel, err := f.roots.locate(src)
+	if err != nil {
+		return nil, err
+	}
+	dr, drel, err := f.roots.locate(dst)
+	if err != nil {
+		return nil, err
+	}
+	if srel == "." {
+		return nil, fmt.Errorf("cannot move an allowed directory")
+	}
+	if _, err := sr.root.Lstat(srel); err != nil {
+		return nil, err
+	}
+	if _, err := dr.root.Lstat(drel); err == nil {
+		return nil, fmt.Errorf("%s already exists", dst)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err := mkdirAll(dr.root, filepath.Dir(drel)); err != nil {
+		return nil, err
+	}
+	// Stat fails if the destination directory is a link leading outside of the root.
+	if _, err := dr.root.Stat(filepath.Dir(drel)); err != nil {
+		return nil, err
+	}
+	to := filepath.Join(dr.path, drel)
+	if err := os.Rename(filepath.Join(sr.path, srel), to); err != nil {
+		return nil, err
+	}
+	return map[string]any{"path": to}, nil
+}
+
+// mkdirAll creates dir and its missing parents inside root.
+func mkdirAll(root *os.Root, dir string) error {
+	if dir == "." {
+		return nil
+	}
+	if err := mkdirAll(root, filepath.Dir(dir)); err != nil {
+		return err
+	}
+	err := root.Mkdir(dir, 0o755)
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// isBinary reports whether data looks like the beginning of a binary file.
+func isBinary(data []byte) bool {
+	head := data[:min(len(data), fsSniffSize)]
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	// The sniffed bytes may end in the middle of a multi-byte character.
+	for i := 0; i < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	return !utf8.Valid(head)
+}
+
+// matchGlob reports whether the slash-separated name matches pattern, where **
+// matches any number of path segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
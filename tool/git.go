@@ -0,0 +1,679 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+)
+
+var _ Tool = (*Git)(nil)
+
+const (
+	defaultGitTimeout  = 30 * time.Second
+	defaultGitPageSize = 20
+	defaultGitMaxLines = 500
+)
+
+// GitConfig lists the repositories the git tool can inspect.
+type GitConfig struct {
+	// Repositories maps the names used by the model to the paths of the repositories.
+	Repositories map[string]string `json:"repositories"`
+	// Timeout bounds the execution time of a git command.
+	Timeout Duration `json:"timeout"`
+	// PageSize caps the number of commits, changed files or branches returned by a call.
+	PageSize int `json:"pageSize"`
+	// MaxLines caps the number of lines returned when reading or blaming a file, and the
+	// number of changed lines returned for each file of a commit or diff.
+	MaxLines int `json:"maxLines"`
+}
+
+type Git struct {
+	repos    map[string]string
+	names    []string
+	timeout  time.Duration
+	pageSize int
+	maxLines int
+}
+
+// NewGit creates a git tool inspecting the configured repositories with the git
+// command, which must be installed.
+func NewGit(ctx context.Context, cfg *GitConfig) (*Git, error) {
+	if cfg == nil || len(cfg.Repositories) == 0 {
+		return nil, fmt.Errorf("at least one repository is required")
+	}
+	g := &Git{
+		repos:    make(map[string]string, len(cfg.Repositories)),
+		timeout:  time.Duration(cfg.Timeout),
+		pageSize: cfg.PageSize,
+		maxLines: cfg.MaxLines,
+	}
+	if g.timeout <= 0 {
+		g.timeout = defaultGitTimeout
+	}
+	if g.pageSize <= 0 {
+		g.pageSize = defaultGitPageSize
+	}
+	if g.maxLines <= 0 {
+		g.maxLines = defaultGitMaxLines
+	}
+
+	for name, dir := range cfg.Repositories {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("resolve repository %s: %w", name, err)
+		}
+		out, err := g.git(ctx, abs, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return nil, fmt.Errorf("open repository %s: %w", name, err)
+		}
+		g.repos[name] = strings.TrimSpace(string(out))
+		g.names = append(g.names, name)
+	}
+	slices.Sort(g.names)
+	return g, nil
+}
+
+func (g *Git) Functions(ctx context.Context) []Function {
+	repos := make([]string, len(g.names))
+	for i, name := range g.names {
+		repos[i] = name + " (" + g.repos[name] + ")"
+	}
+	available := " Available repositories: " + strings.Join(repos, ", ") + "."
+
+	repository := jsonschema.JSONSchema{
+		Type:        "string",
+		Description: "The name of the repository, one of: " + strings.Join(g.names, ", ") + ".",
+		Examples:    []any{g.names[0]},
+	}
+	if len(g.names) == 1 {
+		repository.Description += " Defaults to " + g.names[0] + "."
+	}
+	path := func(description string) jsonschema.JSONSchema {
+		return jsonschema.JSONSchema{
+			Type:        "string",
+			Description: description + ", relative to the root of the repository",
+			Examples:    []any{"README.md", "cmd/term/main.go"},
+		}
+	}
+	offset := jsonschema.JSONSchema{
+		Type:        "integer",
+		Description: "The number of results to skip, used to fetch the next page with the next_offset of the previous call. Defaults to 0.",
+		Examples:    []any{0, g.pageSize},
+	}
+	limit := jsonschema.JSONSchema{
+		Type:        "integer",
+		Description: fmt.Sprintf("The maximum number of results to return, at most %d. Defaults to %d.", g.pageSize, g.pageSize),
+		Examples:    []any{5},
+	}
+	startLine := jsonschema.JSONSchema{
+		Type:        "integer",
+		Description: "The first line to return, starting at 1. Defaults to 1.",
+		Examples:    []any{1, 120},
+	}
+	lineLimit := jsonschema.JSONSchema{
+		Type:        "integer",
+		Description: fmt.Sprintf("The maximum number of lines to return, at most %d. Defaults to %d.", g.maxLines, g.maxLines),
+		Examples:    []any{50},
+	}
+	revision := jsonschema.JSONSchema{
+		Type:        "string",
+		Description: "A commit hash, branch, tag or revision expression. Defaults to HEAD.",
+		Examples:    []any{"HEAD", "main", "v1.2.0", "HEAD~3", "a1b2c3d"},
+	}
+	page := map[string]jsonschema.JSONSchema{
+		"has_more":    {Type: "boolean", Description: "True when more results are available"},
+		"next_offset": {Type: "integer", Description: "The offset to pass to fetch the next page, when more results are available"},
+	}
+	commit := jsonschema.JSONSchema{
+		Type:        "object",
+		Description: "A commit",
+		Properties: map[string]jsonschema.JSONSchema{
+			"hash":       {Type: "string", Description: "The full hash of the commit"},
+			"short_hash": {Type: "string", Description: "The abbreviated hash of the commit"},
+			"author":     {Type: "string", Description: "The name of the author"},
+			"email":      {Type: "string", Description: "The email of the author"},
+			"date":       {Type: "string", Description: "The author date, in RFC 3339 format"},
+			"parents":    {Type: "array", Description: "The hashes of the parent commits", Items: &jsonschema.JSONSchema{Type: "string"}},
+			"subject":    {Type: "string", Description: "The first line of the commit message"},
+			"body":       {Type: "string", Description: "The rest of the commit message"},
+		},
+	}
+	files := jsonschema.JSONSchema{
+		Type:        "array",
+		Description: "The changed files",
+		Items: &jsonschema.JSONSchema{
+			Type: "object",
+			Properties: map[string]jsonschema.JSONSchema{
+				"path":      {Type: "string", Description: "The path of the file"},
+				"old_path":  {Type: "string", Description: "The previous path of renamed or copied files"},
+				"status":    {Type: "string", Description: "One of added, deleted, modified, renamed or copied"},
+				"binary":    {Type: "boolean", Description: "True for binary files, which have no hunks"},
+				"additions": {Type: "integer", Description: "The number of added lines"},
+				"deletions": {Type: "integer", Description: "The number of deleted lines"},
+				"hunks": {
+					Type:        "array",
+					Description: "The changed regions of the file",
+					Items: &jsonschema.JSONSchema{
+						Type: "object",
+						Properties: map[string]jsonschema.JSONSchema{
+							"old_start": {Type: "integer", Description: "The first line of the region before the change"},
+							"old_lines": {Type: "integer", Description: "The number of lines of the region before the change"},
+							"new_start": {Type: "integer", Description: "The first line of the region after the change"},
+							"new_lines": {Type: "integer", Description: "The number of lines of the region after the change"},
+							"section":   {Type: "string", Description: "The enclosing function or section, when known"},
+							"lines":     {Type: "string", Description: "The lines of the region in unified diff format, prefixed with +, - or a space"},
+						},
+					},
+				},
+				"truncated": {Type: "boolean", Description: fmt.Sprintf("True when only the first lines of the changes are returned, at most %d per file. The additions and deletions still count every line.", g.maxLines)},
+			},
+		},
+	}
+
+	return []Function{
+		{
+			ID:          "git_log",
+			DisplayName: "Git Log",
+			Description: "Lists the commits of a repository, most recent first. Use this function to look at the history of a branch, a file or a directory." + available,
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for listing commits",
+				Properties: map[string]jsonschema.JSONSchema{
+					"repository": repository,
+					"revision":   revision,
+					"path":       path("Only list the commits changing this file or directory"),
+					"author": {
+						Type:        "string",
+						Description: "Only list the commits whose author name or email matches this pattern",
+						Examples:    []any{"alice", "@example.com"},
+					},
+					"since": {
+						Type:        "string",
+						Description: "Only list the commits more recent than this date",
+						Examples:    []any{"2024-01-31", "2 weeks ago"},
+					},
+					"until": {
+						Type:        "string",
+						Description: "Only list the commits older than this date",
+						Examples:    []any{"2024-06-30", "yesterday"},
+					},
+					"offset": offset,
+					"limit":  limit,
+				},
+				PropertyOrdering: []string{"repository", "revision", "path", "author", "since", "until", "offset", "limit"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "A page of commits",
+				Properties: withPage(page, map[string]jsonschema.JSONSchema{
+					"commits": {Type: "array", Description: "The commits", Items: &commit},
+				}),
+			},
+		},
+		{
+			ID:          "git_show",
+			DisplayName: "Git Show",
+			Description: "Shows a commit with the changes it made, compared to its first parent. Use this function to understand what a commit did. Changed files are paginated." + available,
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for showing a commit",
+				Properties: map[string]jsonschema.JSONSchema{
+					"repository": repository,
+					"revision":   revision,
+					"path":       path("Only show the changes of this file or directory"),
+					"offset":     offset,
+					"limit":      limit,
+				},
+				PropertyOrdering: []string{"repository", "revision", "path", "offset", "limit"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The commit and a page of its changed files",
+				Properties: withPage(page, map[string]jsonschema.JSONSchema{
+					"commit":      commit,
+					"files":       files,
+					"total_files": {Type: "integer", Description: "The number of files changed by the commit"},
+				}),
+			},
+		},
+		{
+			ID:          "git_diff",
+			DisplayName: "Git Diff",
+			Description: "Compares two revisions, or a revision and the working tree. Use this function to review the changes between branches, tags or commits. Changed files are paginated." + available,
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for comparing revisions",
+				Properties: map[string]jsonschema.JSONSchema{
+					"repository": repository,
+					"from": {
+						Type:        "string",
+						Description: "The revision to compare from. main...feature compares feature with its merge base with main.",
+						Examples:    []any{"main", "v1.0.0", "HEAD~5", "main...feature"},
+					},
+					"to": {
+						Type:        "string",
+						Description: "The revision to compare to. Defaults to the working tree.",
+						Examples:    []any{"HEAD", "feature"},
+					},
+					"path":   path("Only compare this file or directory"),
+					"offset": offset,
+					"limit":  limit,
+				},
+				Required:         []string{"from"},
+				PropertyOrdering: []string{"repository", "from", "to", "path", "offset", "limit"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "A page of the changed files",
+				Properties: withPage(page, map[string]jsonschema.JSONSchema{
+					"files":       files,
+					"total_files": {Type: "integer", Description: "The number of changed files"},
+				}),
+			},
+		},
+		{
+			ID:          "git_blame",
+			DisplayName: "Git Blame",
+			Description: "Shows the commit that last changed each line of a file. Use this function to find out who changed some code, when and why. Consecutive lines changed by the same commit are grouped." + available,
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for blaming a file",
+				Properties: map[string]jsonschema.JSONSchema{
+					"repository": repository,
+					"path":       path("The file to blame"),
+					"revision":   revision,
+					"start_line": startLine,
+					"limit":      lineLimit,
+				},
+				Required:         []string{"path"},
+				PropertyOrdering: []string{"repository", "path", "revision", "start_line", "limit"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The blamed lines",
+				Properties: map[string]jsonschema.JSONSchema{
+					"ranges": {
+						Type:        "array",
+						Description: "The groups of consecutive lines last changed by the same commit",
+						Items: &jsonschema.JSONSchema{
+							Type: "object",
+							Properties: map[string]jsonschema.JSONSchema{
+								"start_line": {Type: "integer", Description: "The first line of the group"},
+								"end_line":   {Type: "integer", Description: "The last line of the group"},
+								"hash":       {Type: "string", Description: "The hash of the commit"},
+								"author":     {Type: "string", Description: "The author of the commit"},
+								"date":       {Type: "string", Description: "The author date, in RFC 3339 format"},
+								"subject":    {Type: "string", Description: "The first line of the commit message"},
+								"lines":      {Type: "string", Description: "The content of the lines"},
+							},
+						},
+					},
+					"has_more":        {Type: "boolean", Description: "True when the file has more lines"},
+					"next_start_line": {Type: "integer", Description: "The start_line to pass to blame the following lines, when the file has more lines"},
+				},
+			},
+		},
+		{
+			ID:          "git_branches",
+			DisplayName: "Git Branches",
+			Description: "Lists the branches of a repository, most recently updated first." + available,
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for listing branches",
+				Properties: map[string]jsonschema.JSONSchema{
+					"repository": repository,
+					"remote": {
+						Type:        "boolean",
+						Description: "Also list remote-tracking branches. Defaults to false.",
+					},
+					"offset": offset,
+					"limit":  limit,
+				},
+				PropertyOrdering: []string{"repository", "remote", "offset", "limit"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "A page of branches",
+				Properties: withPage(page, map[string]jsonschema.JSONSchema{
+					"branches": {
+						Type:        "array",
+						Description: "The branches",
+						Items: &jsonschema.JSONSchema{
+							Type: "object",
+							Properties: map[string]jsonschema.JSONSchema{
+								"name":     {Type: "string", Description: "The name of the branch"},
+								"hash":     {Type: "string", Description: "The abbreviated hash of the last commit"},
+								"current":  {Type: "boolean", Description: "True for the checked out branch"},
+								"upstream": {Type: "string", Description: "The remote branch it tracks"},
+								"date":     {Type: "string", Description: "The date of the last commit, in RFC 3339 format"},
+								"subject":  {Type: "string", Description: "The subject of the last commit"},
+							},
+						},
+					},
+				}),
+			},
+		},
+		{
+			ID:          "git_read_file",
+			DisplayName: "Git Read File",
+			Description: "Reads a file as it was at a given revision. Use this function to look at an older version of a file or at a file of another branch." + available,
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for reading a file at a revision",
+				Properties: map[string]jsonschema.JSONSchema{
+					"repository": repository,
+					"path":       path("The file to read"),
+					"revision":   revision,
+					"start_line": startLine,
+					"limit":      lineLimit,
+				},
+				Required:         []string{"path"},
+				PropertyOrdering: []string{"repository", "path", "revision", "start_line", "limit"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The lines of the file",
+				Properties: map[string]jsonschema.JSONSchema{
+					"content":         {Type: "string", Description: "The requested lines of the file"},
+					"start_line":      {Type: "integer", Description: "The first returned line"},
+					"end_line":        {Type: "integer", Description: "The last returned line"},
+					"total_lines":     {Type: "integer", Description: "The number of lines of the file"},
+					"has_more":        {Type: "boolean", Description: "True when the file has more lines"},
+					"next_start_line": {Type: "integer", Description: "The start_line to pass to read the following lines, when the file has more lines"},
+				},
+			},
+		},
+	}
+}
+
+func withPage(page, properties map[string]jsonschema.JSONSchema) map[string]jsonschema.JSONSchema {
+	for k, v := range page {
+		properties[k] = v
+	}
+	return properties
+}
+
+func (g *Git) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	repo, err := g.repository(params)
+	if err != nil {
+		return nil, err
+	}
+	revision, _ := params["revision"].(string)
+	if revision == "" {
+		revision = "HEAD"
+	}
+	path, _ := params["path"].(string)
+	offset := max(intParam(params, "offset", 0), 0)
+	limit := min(max(intParam(params, "limit", g.pageSize), 1), g.pageSize)
+	startLine := max(intParam(params, "start_line", 1), 1)
+	lineLimit := min(max(intParam(params, "limit", g.maxLines), 1), g.maxLines)
+
+	switch fn {
+	case "git_log":
+		author, _ := params["author"].(string)
+		since, _ := params["since"].(string)
+		until, _ := params["until"].(string)
+		return g.log(ctx, repo, revision, path, author, since, until, offset, limit)
+	case "git_show":
+		return g.show(ctx, repo, revision, path, offset, limit)
+	case "git_diff":
+		from, ok := params["from"].(string)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("from parameter must be a revision")
+		}
+		to, _ := params["to"].(string)
+		return g.diff(ctx, repo, from, to, path, offset, limit)
+	case "git_blame":
+		if path == "" {
+			return nil, fmt.Errorf("path parameter must be a file path")
+		}
+		return g.blame(ctx, repo, revision, path, startLine, lineLimit)
+	case "git_branches":
+		remote, _ := params["remote"].(bool)
+		return g.branches(ctx, repo, remote, offset, limit)
+	case "git_read_file":
+		if path == "" {
+			return nil, fmt.Errorf("path parameter must be a file path")
+		}
+		return g.readFile(ctx, repo, revision, path, startLine, lineLimit)
+	default:
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+}
+
+// repository returns the path of the repository named by the repository parameter.
+func (g *Git) repository(params map[string]any) (string, error) {
+	name, _ := params["repository"].(string)
+	if name == "" && len(g.names) == 1 {
+		name = g.names[0]
+	}
+	repo, ok := g.repos[name]
+	if !ok {
+		return "", fmt.Errorf("unknown repository %q, available repositories are: %s", name, strings.Join(g.names, ", "))
+	}
+	return repo, nil
+}
+
+func (g *Git) log(ctx context.Context, repo, revision, path, author, since, until string, offset, limit int) (map[string]any, error) {
+	if err := checkRevision(revision); err != nil {
+		return nil, err
+	}
+	args := []string{"log", "--format=" + gitCommitFormat + "%x1e", fmt.Sprintf("--skip=%d", offset), fmt.Sprintf("--max-count=%d", limit+1)}
+	if author != "" {
+		args = append(args, "--author="+author)
+	}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	if until != "" {
+		args = append(args, "--until="+until)
+	}
+	args = append(args, revision, "--")
+	if path != "" {
+		args = append(args, path)
+	}
+	out, err := g.git(ctx, repo, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []map[string]any
+	for _, record := range strings.Split(string(out), "\x1e") {
+		if record = strings.TrimLeft(record, "\n"); record != "" {
+			commits = append(commits, parseCommit(record))
+		}
+	}
+	return page(map[string]any{}, "commits", commits, offset, limit), nil
+}
+
+func (g *Git) show(ctx context.Context, repo, revision, path string, offset, limit int) (map[string]any, error) {
+	if err := checkRevision(revision); err != nil {
+		return nil, err
+	}
+	args := []string{"show", "--format=" + gitCommitFormat + "%x1e", "--patch", "--find-renames", "--diff-merges=first-parent", "--no-color", "--no-ext-diff", "--no-textconv", revision, "--"}
+	if path != "" {
+		args = append(args, path)
+	}
+	out, err := g.git(ctx, repo, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	record, patch, _ := strings.Cut(string(out), "\x1e")
+	files := parseDiff(patch, g.maxLines)
+	return page(map[string]any{
+		"commit":      parseCommit(record),
+		"total_files": len(files),
+	}, "files", files[min(offset, len(files)):], offset, limit), nil
+}
+
+func (g *Git) diff(ctx context.Context, repo, from, to, path string, offset, limit int) (map[string]any, error) {
+	args := []string{"diff", "--find-renames", "--no-color", "--no-ext-diff", "--no-textconv"}
+	for _, rev := range []string{from, to} {
+		if rev == "" {
+			continue
+		}
+		if err := checkRevision(rev); err != nil {
+			return nil, err
+		}
+		args = append(args, rev)
+	}
+	args = append(args, "--")
+	if path != "" {
+		args = append(args, path)
+	}
+	out, err := g.git(ctx, repo, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	files := parseDiff(string(out), g.maxLines)
+	return page(map[string]any{"total_files": len(files)}, "files", files[min(offset, len(files)):], offset, limit), nil
+}
+
+func (g *Git) blame(ctx context.Context, repo, revision, path string, startLine, limit int) (map[string]any, error) {
+	if err := checkRevision(revision); err != nil {
+		return nil, err
+	}
+	// One more line than requested tells whether the file goes on.
+	out, err := g.git(ctx, repo, "blame", "--porcelain", fmt.Sprintf("-L%d,+%d", startLine, limit+1), revision, "--", path)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges, lines := parseBlame(string(out), startLine+limit-1)
+	result := map[string]any{"ranges": ranges, "has_more": lines > limit}
+	if lines > limit {
+		result["next_start_line"] = startLine + limit
+	}
+	return result, nil
+}
+
+func (g *Git) branches(ctx context.Context, repo string, remote bool, offset, limit int) (map[string]any, error) {
+	args := []string{"for-each-ref", "--sort=-committerdate", "--format=%(refname:short)%1f%(objectname:short)%1f%(HEAD)%1f%(upstream:short)%1f%(committerdate:iso-strict)%1f%(contents:subject)", "refs/heads"}
+	if remote {
+		args = append(args, "refs/remotes")
+	}
+	out, err := g.git(ctx, repo, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 6 || strings.HasSuffix(fields[0], "/HEAD") {
+			continue
+		}
+		branches = append(branches, map[string]any{
+			"name":     fields[0],
+			"hash":     fields[1],
+			"current":  fields[2] == "*",
+			"upstream": fields[3],
+			"date":     fields[4],
+			"subject":  fields[5],
+		})
+	}
+	return page(map[string]any{}, "branches", branches[min(offset, len(branches)):], offset, limit), nil
+}
+
+func (g *Git) readFile(ctx context.Context, repo, revision, path string, startLine, limit int) (map[string]any, error) {
+	if err := checkRevision(revision); err != nil {
+		return nil, err
+	}
+	out, err := g.git(ctx, repo, "show", "--no-textconv", revision+":"+strings.TrimPrefix(filepath.ToSlash(path), "/"))
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(out) {
+		return nil, fmt.Errorf("%s is a binary file of %d bytes at %s", path, len(out), revision)
+	}
+
+	lines := strings.SplitAfter(string(out), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if startLine > len(lines) && len(lines) > 0 {
+		return nil, fmt.Errorf("%s has only %d lines at %s", path, len(lines), revision)
+	}
+	first := min(startLine-1, len(lines))
+	last := min(first+limit, len(lines))
+	result := map[string]any{
+		"content":     strings.Join(lines[first:last], ""),
+		"start_line":  first + 1,
+		"end_line":    last,
+		"total_lines": len(lines),
+		"has_more":    last < len(lines),
+	}
+	if last < len(lines) {
+		result["next_start_line"] = last + 1
+	}
+	return result, nil
+}
+
+// git runs a git command in repo and returns its output.
+func (g *Git) git(ctx context.Context, repo string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repo, "-c", "core.quotePath=false", "--no-pager"}, args...)...)
+	// Inspecting a repository must never prompt for credentials or write lock files.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_OPTIONAL_LOCKS=0")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// checkRevision rejects revisions that git would take for options.
+func checkRevision(revision string) error {
+	if strings.HasPrefix(revision, "-") {
+		return fmt.Errorf("invalid revision %q", revision)
+	}
+	return nil
+}
+
+// page sets key to the first limit items, which start at offset, along with the
+// pagination fields.
+func page[T any](result map[string]any, key string, items []T, offset, limit int) map[string]any {
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	if items == nil {
+		items = []T{}
+	}
+	result[key] = items
+	result["has_more"] = more
+	if more {
+		result["next_offset"] = offset + limit
+	}
+	return result
+}
+
+// intParam returns the integer parameter key, or def when it is missing. JSON numbers
+// are decoded as float64.
+func intParam(params map[string]any, key string, def int) int {
+	switch v := params[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return def
+	}
+}
@@ -0,0 +1,230 @@
+package tool
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitCommitFormat prints the fields read by parseCommit, separated by unit separators.
+const gitCommitFormat = "%H%x1f%h%x1f%an%x1f%ae%x1f%aI%x1f%P%x1f%s%x1f%b"
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+func parseCommit(record string) map[string]any {
+	fields := strings.SplitN(record, "\x1f", 8)
+	for len(fields) < 8 {
+		fields = append(fields, "")
+	}
+	parents := strings.Fields(fields[5])
+	if parents == nil {
+		parents = []string{}
+	}
+	return map[string]any{
+		"hash":       fields[0],
+		"short_hash": fields[1],
+		"author":     fields[2],
+		"email":      fields[3],
+		"date":       fields[4],
+		"parents":    parents,
+		"subject":    fields[6],
+		"body":       strings.TrimSpace(fields[7]),
+	}
+}
+
+// gitMaxPatchBytes caps the size of the hunk lines returned for a file, which minified
+// or generated files can make huge in few lines.
+const gitMaxPatchBytes = 100_000
+
+// parseDiff splits a unified diff into files and hunks. The hunk lines of a file stop
+// after maxLines lines or gitMaxPatchBytes bytes, the file being marked truncated.
+func parseDiff(patch string, maxLines int) []map[string]any {
+	var (
+		files []map[string]any
+		file  map[string]any
+		hunk  map[string]any
+		lines strings.Builder
+		// fileLines and fileBytes measure the hunk lines kept for file.
+		fileLines, fileBytes int
+	)
+	flushHunk := func() {
+		if hunk == nil {
+			return
+		}
+		// The hunks following the truncation are left out.
+		if lines.Len() > 0 || file["truncated"] == false {
+			hunk["lines"] = lines.String()
+			file["hunks"] = append(file["hunks"].([]map[string]any), hunk)
+		}
+		hunk = nil
+		lines.Reset()
+	}
+
+	for _, line := range strings.Split(patch, "\n") {
+		if hunk != nil && line != "" && strings.IndexByte("+- \\", line[0]) >= 0 {
+			switch line[0] {
+			case '+':
+				file["additions"] = file["additions"].(int) + 1
+			case '-':
+				file["deletions"] = file["deletions"].(int) + 1
+			}
+			if file["truncated"] == true || fileLines >= maxLines || fileBytes+len(line)+1 > gitMaxPatchBytes {
+				file["truncated"] = true
+				continue
+			}
+			fileLines++
+			fileBytes += len(line) + 1
+			lines.WriteString(line)
+			lines.WriteByte('\n')
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flushHunk()
+			names := strings.TrimPrefix(line, "diff --git ")
+			path := names
+			if i := strings.Index(names, " b/"); i >= 0 {
+				path = names[i+3:]
+			}
+			file = map[string]any{
+				"path":      path,
+				"status":    "modified",
+				"binary":    false,
+				"additions": 0,
+				"deletions": 0,
+				"hunks":     []map[string]any{},
+				"truncated": false,
+			}
+			fileLines, fileBytes = 0, 0
+			files = append(files, file)
+		case file == nil:
+		case strings.HasPrefix(line, "@@ "):
+			flushHunk()
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			hunk = map[string]any{
+				"old_start": atoiDefault(m[1], 0),
+				"old_lines": atoiDefault(m[2], 1),
+				"new_start": atoiDefault(m[3], 0),
+				"new_lines": atoiDefault(m[4], 1),
+				"section":   m[5],
+			}
+		case strings.HasPrefix(line, "new file mode"):
+			file["status"] = "added"
+		case strings.HasPrefix(line, "deleted file mode"):
+			file["status"] = "deleted"
+		case strings.HasPrefix(line, "rename from "):
+			file["status"] = "renamed"
+			file["old_path"] = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			file["path"] = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "copy from "):
+			file["status"] = "copied"
+			file["old_path"] = strings.TrimPrefix(line, "copy from ")
+		case strings.HasPrefix(line, "copy to "):
+			file["path"] = strings.TrimPrefix(line, "copy to ")
+		case strings.HasPrefix(line, "Binary files "):
+			file["binary"] = true
+		}
+	}
+	flushHunk()
+	if files == nil {
+		files = []map[string]any{}
+	}
+	return files
+}
+
+type blameCommit struct {
+	author  string
+	date    string
+	summary string
+}
+
+// parseBlame groups the lines of a porcelain blame into ranges of consecutive lines
+// changed by the same commit. Lines after lastLine are counted but left out.
+func parseBlame(out string, lastLine int) ([]map[string]any, int) {
+	var (
+		ranges  = []map[string]any{}
+		commits = map[string]*blameCommit{}
+		current *blameCommit
+		hash    string
+		number  int
+		count   int
+		authorT int64
+		authorZ string
+	)
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			count++
+			if number > lastLine {
+				continue
+			}
+			content := line[1:] + "\n"
+			if n := len(ranges); n > 0 && ranges[n-1]["hash"] == hash && ranges[n-1]["end_line"] == number-1 {
+				ranges[n-1]["end_line"] = number
+				ranges[n-1]["lines"] = ranges[n-1]["lines"].(string) + content
+				continue
+			}
+			ranges = append(ranges, map[string]any{
+				"start_line": number,
+				"end_line":   number,
+				"hash":       hash,
+				"author":     current.author,
+				"date":       current.date,
+				"subject":    current.summary,
+				"lines":      content,
+			})
+		case strings.HasPrefix(line, "author "):
+			current.author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-time "):
+			authorT, _ = strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64)
+		case strings.HasPrefix(line, "author-tz "):
+			authorZ = strings.TrimPrefix(line, "author-tz ")
+			current.date = blameDate(authorT, authorZ)
+		case strings.HasPrefix(line, "summary "):
+			current.summary = strings.TrimPrefix(line, "summary ")
+		default:
+			// Headers start with the commit hash followed by the original and final
+			// line numbers.
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(fields[0]) < 40 {
+				continue
+			}
+			hash = fields[0]
+			number = atoiDefault(fields[2], 0)
+			if current = commits[hash]; current == nil {
+				current = &blameCommit{}
+				commits[hash] = current
+			}
+		}
+	}
+	return ranges, count
+}
+
+// blameDate formats a unix time in the +hhmm zone of the author.
+func blameDate(unix int64, zone string) string {
+	t := time.Unix(unix, 0).UTC()
+	if len(zone) == 5 {
+		hours, _ := strconv.Atoi(zone[1:3])
+		minutes, _ := strconv.Atoi(zone[3:5])
+		offset := hours*3600 + minutes*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		t = t.In(time.FixedZone(zone, offset))
+	}
+	return t.Format(time.RFC3339)
+}
+
+func atoiDefault(s string, def int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,196 @@
+package tool
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPatch is a diff of a modified, a renamed, a binary and a deleted file. Blank
+// lines are quoted, since editors strip trailing whitespace.
+const testPatch = `diff --git a/main.go b/main.go
+index 3b18e51..a9c2f3d 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,5 @@ package main
+ package main
+` + " \n" + `-import "fmt"
++import (
++	"fmt"
++)
+@@ -10 +11 @@ func main() {
+-	fmt.Println("hello")
++	fmt.Println("hello, world")
+diff --git a/README.md b/docs/README.md
+similarity index 90%
+rename from README.md
+rename to docs/README.md
+diff --git a/logo.png b/logo.png
+new file mode 100644
+index 0000000..e69de29
+Binary files /dev/null and b/logo.png differ
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+index 8baef1b..0000000
+--- a/old.txt
++++ /dev/null
+@@ -1,2 +0,0 @@
+-first
+-second
+\ No newline at end of file
+`
+
+func TestParseDiff(t *testing.T) {
+	want := []map[string]any{
+		{
+			"path":      "main.go",
+			"status":    "modified",
+			"binary":    false,
+			"additions": 4,
+			"deletions": 2,
+			"truncated": false,
+			"hunks": []map[string]any{
+				{
+					"old_start": 1, "old_lines": 4, "new_start": 1, "new_lines": 5, "section": "package main",
+					"lines": " package main\n \n-import \"fmt\"\n+import (\n+\t\"fmt\"\n+)\n",
+				},
+				{
+					"old_start": 10, "old_lines": 1, "new_start": 11, "new_lines": 1, "section": "func main() {",
+					"lines": "-\tfmt.Println(\"hello\")\n+\tfmt.Println(\"hello, world\")\n",
+				},
+			},
+		},
+		{
+			"path":      "docs/README.md",
+			"old_path":  "README.md",
+			"status":    "renamed",
+			"binary":    false,
+			"additions": 0,
+			"deletions": 0,
+			"truncated": false,
+			"hunks":     []map[string]any{},
+		},
+		{
+			"path":      "logo.png",
+			"status":    "added",
+			"binary":    true,
+			"additions": 0,
+			"deletions": 0,
+			"truncated": false,
+			"hunks":     []map[string]any{},
+		},
+		{
+			"path":      "old.txt",
+			"status":    "deleted",
+			"binary":    false,
+			"additions": 0,
+			"deletions": 2,
+			"truncated": false,
+			"hunks": []map[string]any{
+				{
+					"old_start": 1, "old_lines": 2, "new_start": 0, "new_lines": 0, "section": "",
+					"lines": "-first\n-second\n\\ No newline at end of file\n",
+				},
+			},
+		},
+	}
+	got := parseDiff(testPatch, 100)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDiff() = %v\nwant %v", got, want)
+	}
+
+	if got := parseDiff("", 100); got == nil || len(got) != 0 {
+		t.Errorf("parseDiff of an empty patch = %#v, want no files", got)
+	}
+}
+
+func TestParseDiffTruncation(t *testing.T) {
+	// The lines of main.go stop after 3 lines, dropping its second hunk, while the
+	// other files keep theirs.
+	files := parseDiff(testPatch, 3)
+	main := files[0]
+	if main["truncated"] != true {
+		t.Errorf("main.go is not truncated")
+	}
+	hunks := main["hunks"].([]map[string]any)
+	if len(hunks) != 1 || hunks[0]["lines"] != " package main\n \n-import \"fmt\"\n" {
+		t.Errorf("hunks of main.go = %v, want the first 3 lines of the first hunk", hunks)
+	}
+	// Changes are counted even once the lines are cut.
+	if main["additions"] != 4 || main["deletions"] != 2 {
+		t.Errorf("main.go has %v additions and %v deletions, want 4 and 2", main["additions"], main["deletions"])
+	}
+	if old := files[3]; old["truncated"] != false || len(old["hunks"].([]map[string]any)) != 1 {
+		t.Errorf("old.txt = %v, want its hunk kept", old)
+	}
+
+	// A huge line stops the lines of its file by size.
+	long := "+" + strings.Repeat("x", gitMaxPatchBytes)
+	files = parseDiff("diff --git a/min.js b/min.js\n@@ -0,0 +1,2 @@\n+short\n"+long+"\n", 100)
+	hunks = files[0]["hunks"].([]map[string]any)
+	if files[0]["truncated"] != true || hunks[0]["lines"] != "+short\n" || files[0]["additions"] != 2 {
+		t.Errorf("min.js = truncated %v with lines %.20q, want its long line cut", files[0]["truncated"], hunks[0]["lines"])
+	}
+}
+
+// testBlame is a porcelain blame of 5 lines, the second one blank.
+const testBlame = `1111111111111111111111111111111111111111 1 1 2
+author Ada Lovelace
+author-mail <ada@example.com>
+author-time 1700000000
+author-tz +0100
+committer Ada Lovelace
+committer-time 1700000000
+committer-tz +0100
+summary Add the engine
+filename engine.go
+	package engine
+1111111111111111111111111111111111111111 2 2
+` + "\t\n" + `2222222222222222222222222222222222222222 3 3 1
+author Charles Babbage
+author-mail <charles@example.com>
+author-time 1700086400
+author-tz -0530
+summary Document the engine
+previous 1111111111111111111111111111111111111111 engine.go
+filename engine.go
+	// Engine computes.
+1111111111111111111111111111111111111111 4 4 1
+	type Engine struct{}
+1111111111111111111111111111111111111111 5 5 1
+	}
+`
+
+func TestParseBlame(t *testing.T) {
+	ada := func(start, end int, lines string) map[string]any {
+		return map[string]any{
+			"start_line": start, "end_line": end,
+			"hash":    "1111111111111111111111111111111111111111",
+			"author":  "Ada Lovelace",
+			"date":    "2023-11-14T23:13:20+01:00",
+			"subject": "Add the engine",
+			"lines":   lines,
+		}
+	}
+	charles := map[string]any{
+		"start_line": 3, "end_line": 3,
+		"hash":    "2222222222222222222222222222222222222222",
+		"author":  "Charles Babbage",
+		"date":    "2023-11-15T16:43:20-05:30",
+		"subject": "Document the engine",
+		"lines":   "// Engine computes.\n",
+	}
+
+	ranges, count := parseBlame(testBlame, 100)
+	want := []map[string]any{ada(1, 2, "package engine\n\n"), charles, ada(4, 5, "type Engine struct{}\n}\n")}
+	if !reflect.DeepEqual(ranges, want) || count != 5 {
+		t.Errorf("parseBlame() = %v, %d\nwant %v, 5", ranges, count, want)
+	}
+
+	// Lines after the last line are counted but left out.
+	ranges, count = parseBlame(testBlame, 4)
+	want = []map[string]any{ada(1, 2, "package engine\n\n"), charles, ada(4, 4, "type Engine struct{}\n")}
+	if !reflect.DeepEqual(ranges, want) || count != 5 {
+		t.Errorf("parseBlame() up to line 4 = %v, %d\nwant %v, 5", ranges, count, want)
+	}
+}
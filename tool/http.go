@@ -0,0 +1,290 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+	"github.com/aliphe/skipery/pkg/markdown"
+	"golang.org/x/net/html/charset"
+)
+
+var _ Tool = (*HTTP)(nil)
+
+const (
+	defaultHTTPTimeout      = 30 * time.Second
+	defaultHTTPMaxSize      = 2 << 20
+	defaultHTTPMaxRedirects = 5
+	defaultHTTPMaxLength    = 100_000
+)
+
+// HTTPConfig restricts the pages the HTTP tool can fetch.
+type HTTPConfig struct {
+	// Allow lists the domains that can be fetched, any domain when empty. A domain also
+	// allows its subdomains.
+	Allow []string `json:"allow"`
+	// Deny lists the domains that can't be fetched, even when allowed.
+	Deny []string `json:"deny"`
+	// AllowPrivate lets the tool reach loopback and private network addresses.
+	AllowPrivate bool `json:"allowPrivate"`
+	// Timeout bounds the time taken by a fetch, redirects included.
+	Timeout Duration `json:"timeout"`
+	// MaxSize caps, in bytes, the size of the response bodies read.
+	MaxSize int64 `json:"maxSize"`
+	// MaxRedirects caps the number of redirects followed.
+	MaxRedirects int `json:"maxRedirects"`
+	// MaxLength caps, in characters, the length of the text returned to the model.
+	MaxLength int `json:"maxLength"`
+}
+
+type HTTP struct {
+	client    *http.Client
+	allow     []string
+	deny      []string
+	maxSize   int64
+	maxLength int
+}
+
+// NewHTTP creates an HTTP tool fetching the pages allowed by cfg. A nil cfg uses the
+// defaults: any public address can be fetched.
+func NewHTTP(cfg *HTTPConfig) *HTTP {
+	var c HTTPConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = Duration(defaultHTTPTimeout)
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = defaultHTTPMaxSize
+	}
+	if c.MaxRedirects <= 0 {
+		c.MaxRedirects = defaultHTTPMaxRedirects
+	}
+	if c.MaxLength <= 0 {
+		c.MaxLength = defaultHTTPMaxLength
+	}
+
+	h := &HTTP{
+		allow:     normalizeDomains(c.Allow),
+		deny:      normalizeDomains(c.Deny),
+		maxSize:   c.MaxSize,
+		maxLength: c.MaxLength,
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !c.AllowPrivate {
+		// Checking addresses once resolved also covers public names pointing to private
+		// addresses.
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+				return fmt.Errorf("address %s is not public", host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	h.client = &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(c.Timeout),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > c.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", c.MaxRedirects)
+			}
+			return h.check(req.URL)
+		},
+	}
+	return h
+}
+
+func (h *HTTP) Functions(ctx context.Context) []Function {
+	description := "Fetches a web page or an API endpoint and returns its content. Use this function when the user shares a URL or asks about the content of a web page. HTML pages are converted to markdown and JSON responses are returned as structured data."
+	if len(h.allow) > 0 {
+		description += " Only these domains can be fetched: " + strings.Join(h.allow, ", ") + "."
+	}
+	return []Function{
+		{
+			ID:          "http_fetch",
+			DisplayName: "Fetch URL",
+			Description: description,
+			CacheTTL:    5 * time.Minute,
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for fetching a URL",
+				Properties: map[string]jsonschema.JSONSchema{
+					"url": {
+						Type:        "string",
+						Description: "The absolute http or https URL to fetch",
+						Examples:    []any{"https://go.dev/doc/effective_go", "https://api.github.com/repos/golang/go"},
+					},
+				},
+				Required:         []string{"url"},
+				PropertyOrdering: []string{"url"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The fetched content",
+				Properties: map[string]jsonschema.JSONSchema{
+					"url":          {Type: "string", Description: "The URL of the content, after redirects"},
+					"status":       {Type: "integer", Description: "The HTTP status code"},
+					"content_type": {Type: "string", Description: "The media type of the content"},
+					"title":        {Type: "string", Description: "The title of HTML pages"},
+					"content":      {Type: "string", Description: "The page converted to markdown, or the raw text of other text responses"},
+					"data":         {Description: "The decoded body of JSON responses, an object, an array or a single value"},
+					"truncated":    {Type: "boolean", Description: "True when only the beginning of the content is returned"},
+				},
+			},
+		},
+	}
+}
+
+func (h *HTTP) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	switch fn {
+	case "http_fetch":
+		rawURL, ok := params["url"].(string)
+		if !ok {
+			return nil, fmt.Errorf("url parameter must be a string")
+		}
+		return h.fetch(ctx, rawURL)
+	default:
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+}
+
+func (h *HTTP) fetch(ctx context.Context, rawURL string) (map[string]any, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if err := h.check(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html, application/json;q=0.9, text/*;q=0.8")
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, h.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	truncated := int64(len(body)) > h.maxSize
+	if truncated {
+		body = body[:h.maxSize]
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	out := map[string]any{
+		"url":          res.Request.URL.String(),
+		"status":       res.StatusCode,
+		"content_type": mediaType,
+	}
+
+	var text string
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var data any
+		if err := json.Unmarshal(body, &data); err == nil {
+			out["data"] = data
+			return out, nil
+		}
+		// Truncated or invalid JSON is returned as text.
+		text = string(body)
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		r, err := charset.NewReader(strings.NewReader(string(body)), contentType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode page: %w", err)
+		}
+		doc, err := markdown.FromHTML(r, res.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse page: %w", err)
+		}
+		out["title"] = doc.Title
+		text = doc.Text
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "" && utf8.Valid(body):
+		r, err := charset.NewReader(strings.NewReader(string(body)), contentType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode content: %w", err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode content: %w", err)
+		}
+		text = string(b)
+	default:
+		return nil, fmt.Errorf("unsupported content type %s (%d bytes)", mediaType, len(body))
+	}
+
+	if len(text) > h.maxLength {
+		text = strings.ToValidUTF8(text[:h.maxLength], "")
+		truncated = true
+	}
+	out["content"] = text
+	out["truncated"] = truncated
+	return out, nil
+}
+
+// check returns an error when u can't be fetched.
+func (h *HTTP) check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q, only http and https URLs can be fetched", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("url %s has no host", u)
+	}
+	if matchDomain(h.deny, host) {
+		return fmt.Errorf("domain %s is denied", host)
+	}
+	if len(h.allow) > 0 && !matchDomain(h.allow, host) {
+		return fmt.Errorf("domain %s is not allowed, allowed domains are: %s", host, strings.Join(h.allow, ", "))
+	}
+	return nil
+}
+
+// matchDomain reports whether host is one of domains or one of their subdomains.
+func matchDomain(domains []string, host string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDomains(domains []string) []string {
+	out := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "*.")
+		if d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
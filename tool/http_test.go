@@ -0,0 +1,254 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPCheck(t *testing.T) {
+	h := NewHTTP(&HTTPConfig{
+		Allow: []string{"Example.com", "*.golang.org"},
+		Deny:  []string{"private.example.com"},
+	})
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{url: "https://example.com/page"},
+		{url: "https://docs.example.com/page"},
+		{url: "http://pkg.golang.org"},
+		{url: "https://golang.org"},
+		{url: "https://private.example.com", wantErr: "domain private.example.com is denied"},
+		{url: "https://api.private.example.com", wantErr: "domain api.private.example.com is denied"},
+		{url: "https://notexample.com", wantErr: "domain notexample.com is not allowed"},
+		{url: "https://example.com.evil.net", wantErr: "is not allowed"},
+		{url: "ftp://example.com/file", wantErr: `unsupported scheme "ftp"`},
+		{url: "file:///etc/passwd", wantErr: `unsupported scheme "file"`},
+		{url: "https:///path", wantErr: "has no host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = h.check(u)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("check() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("check() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+	}))
+	defer srv.Close()
+
+	_, err := NewHTTP(nil).Call(context.Background(), "http_fetch", map[string]any{"url": srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "is not public") {
+		t.Fatalf("fetching a loopback address = %v, want a not public error", err)
+	}
+
+	out, err := NewHTTP(&HTTPConfig{AllowPrivate: true}).Call(context.Background(), "http_fetch", map[string]any{"url": srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["content"] != "hello" {
+		t.Errorf("content = %q, want %q", out["content"], "hello")
+	}
+}
+
+func TestHTTPRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/end", http.StatusFound)
+	})
+	mux.HandleFunc("/end", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "arrived")
+	})
+	mux.HandleFunc("/elsewhere", func(w http.ResponseWriter, r *http.Request) {
+		// Same server, through a host name that isn't allowed.
+		http.Redirect(w, r, "http://localhost:"+u.Port()+"/end", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+
+	h := NewHTTP(&HTTPConfig{Allow: []string{u.Hostname()}, AllowPrivate: true, MaxRedirects: 3})
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "/start", want: "arrived"},
+		{path: "/elsewhere", wantErr: "domain localhost is not allowed"},
+		{path: "/loop", wantErr: "stopped after 3 redirects"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			out, err := h.Call(context.Background(), "http_fetch", map[string]any{"url": srv.URL + tt.path})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fetch = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out["content"] != tt.want {
+				t.Errorf("content = %q, want %q", out["content"], tt.want)
+			}
+			if out["url"] != srv.URL+"/end" {
+				t.Errorf("url = %q, want the URL after redirects %q", out["url"], srv.URL+"/end")
+			}
+		})
+	}
+}
+
+func TestHTTPTruncation(t *testing.T) {
+	body := strings.Repeat("0123456789", 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name          string
+		cfg           HTTPConfig
+		want          string
+		wantTruncated bool
+	}{
+		{name: "complete", cfg: HTTPConfig{}, want: body},
+		{name: "max size", cfg: HTTPConfig{MaxSize: 15}, want: body[:15], wantTruncated: true},
+		{name: "max length", cfg: HTTPConfig{MaxLength: 25}, want: body[:25], wantTruncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.AllowPrivate = true
+			out, err := NewHTTP(&tt.cfg).Call(context.Background(), "http_fetch", map[string]any{"url": srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out["content"] != tt.want {
+				t.Errorf("content = %q, want %q", out["content"], tt.want)
+			}
+			if out["truncated"] != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", out["truncated"], tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestHTTPTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	h := NewHTTP(&HTTPConfig{AllowPrivate: true, Timeout: Duration(50 * time.Millisecond)})
+	start := time.Now()
+	_, err := h.Call(context.Background(), "http_fetch", map[string]any{"url": srv.URL})
+	if err == nil {
+		t.Fatal("fetch succeeded, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("fetch took %v, want it to stop after the timeout", elapsed)
+	}
+}
+
+func TestHTTPContent(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><title>Guide</title></head><body><nav>Menu</nav><h1>Intro</h1><p>See <a href="next">next</a>.</p></body></html>`)
+	})
+	mux.HandleFunc("/latin1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		w.Write([]byte("<p>caf\xe9</p>"))
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"name":"skipery","stars":3}`)
+	})
+	mux.HandleFunc("/api/list", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"name":"skipery"}]`)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte{0x89, 'P', 'N', 'G'})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	h := NewHTTP(&HTTPConfig{AllowPrivate: true})
+	fetch := func(path string) (map[string]any, error) {
+		return h.Call(context.Background(), "http_fetch", map[string]any{"url": srv.URL + path})
+	}
+
+	out, err := fetch("/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# Intro\n\nSee [next](" + srv.URL + "/next)."; out["content"] != want {
+		t.Errorf("html content = %q, want %q", out["content"], want)
+	}
+	if out["title"] != "Guide" || out["content_type"] != "text/html" || out["status"] != http.StatusOK {
+		t.Errorf("html metadata = %q, %q, %v", out["title"], out["content_type"], out["status"])
+	}
+
+	out, err = fetch("/latin1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["content"] != "café" {
+		t.Errorf("decoded content = %q, want %q", out["content"], "café")
+	}
+
+	out, err = fetch("/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, ok := out["data"].(map[string]any)
+	if !ok || data["name"] != "skipery" || data["stars"] != 3.0 {
+		t.Errorf("json data = %v", out["data"])
+	}
+
+	// Arrays match the response schema too.
+	out, err = fetch("/api/list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewValidator(nil, ToolBelt{"http_fetch": h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked, err := v.Validate("http_fetch", out); err != nil || checked["schema_violations"] != nil {
+		t.Errorf("json array violates the response schema: %v, %v", checked["schema_violations"], err)
+	}
+
+	if _, err := fetch("/image"); err == nil || !strings.Contains(err.Error(), "unsupported content type image/png") {
+		t.Errorf("fetching an image = %v, want an unsupported content type error", err)
+	}
+}
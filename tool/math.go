@@ -3,8 +3,11 @@ package tool
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/aliphe/skipery/pkg/calc"
 	"github.com/aliphe/skipery/pkg/jsonschema"
+	"github.com/shopspring/decimal"
 )
 
 var _ Tool = (*Math)(nil)
@@ -18,67 +21,35 @@ func NewMath() *Math {
 func (h *Math) Functions(ctx context.Context) []Function {
 	return []Function{
 		{
-			ID:          "sum",
-			DisplayName: "Sum",
-			Description: "Calculates the sum of two numbers. Use this function when you need to add two numerical values together.",
+			ID:          "evaluate",
+			DisplayName: "Evaluate",
+			Description: "Evaluates a mathematical expression with arbitrary-precision decimals. Use this function for any calculation, such as arithmetic, percentages, powers, roots, logarithms or trigonometry, instead of computing the result yourself.",
 			Parameters: jsonschema.JSONSchema{
 				Type:        "object",
-				Description: "Parameters for the sum operation",
+				Description: "Parameters for the evaluation",
 				Properties: map[string]jsonschema.JSONSchema{
-					"a": {
-						Type:        "number",
-						Description: "The first number to add. Can be any positive or negative number, including decimals.",
-						Examples:    []any{5, 10.5, -3.2, 0},
+					"expression": {
+						Type: "string",
+						Description: "The expression to evaluate. Supports the + - * / ^ operators, parentheses, percentages (15% is 0.15) and modulos (10 % 3 is 1), the pi and e constants, variables, and the functions " +
+							strings.Join(calc.Functions(), ", ") + ". log(x) is in base 10 and log(x, b) in base b, round(x, n) rounds to n decimal places and trigonometric functions use radians.",
+						Examples: []any{"15 + 27", "200 * 15%", "(1 + 0.05)^10 * 1000", "sqrt(2)", "round(price * quantity * (1 + vat), 2)", "sin(pi / 6)"},
 					},
-					"b": {
-						Type:        "number",
-						Description: "The second number to add. Can be any positive or negative number, including decimals.",
-						Examples:    []any{3, 7.8, -1.5, 0},
+					"variables": {
+						Type:        "object",
+						Description: "Values of the variables used in the expression, by name. Values can be numbers or strings holding decimal numbers, strings keep their exact precision.",
+						Examples:    []any{map[string]any{"price": "19.99", "quantity": 3, "vat": 0.2}},
 					},
 				},
-				Required:         []string{"a", "b"},
-				PropertyOrdering: []string{"a", "b"},
+				Required:         []string{"expression"},
+				PropertyOrdering: []string{"expression", "variables"},
 			},
 			Response: jsonschema.JSONSchema{
 				Type:        "object",
-				Description: "The result of the sum operation",
+				Description: "The result of the evaluation",
 				Properties: map[string]jsonschema.JSONSchema{
 					"result": {
-						Type:        "number",
-						Description: "The sum of the two input numbers",
-					},
-				},
-			},
-		},
-		{
-			ID:          "subtract",
-			DisplayName: "Subtract",
-			Description: "Calculates the difference between two numbers (a - b). Use this function when you need to subtract one number from another.",
-			Parameters: jsonschema.JSONSchema{
-				Type:        "object",
-				Description: "Parameters for the subtraction operation",
-				Properties: map[string]jsonschema.JSONSchema{
-					"a": {
-						Type:        "number",
-						Description: "The minuend (number to subtract from). Can be any positive or negative number, including decimals.",
-						Examples:    []any{10, 5.5, -2.3, 0},
-					},
-					"b": {
-						Type:        "number",
-						Description: "The subtrahend (number to subtract). Can be any positive or negative number, including decimals.",
-						Examples:    []any{3, 2.2, -1.8, 0},
-					},
-				},
-				Required:         []string{"a", "b"},
-				PropertyOrdering: []string{"a", "b"},
-			},
-			Response: jsonschema.JSONSchema{
-				Type:        "object",
-				Description: "The result of the subtraction operation",
-				Properties: map[string]jsonschema.JSONSchema{
-					"result": {
-						Type:        "number",
-						Description: "The difference between the two input numbers (a - b)",
+						Type:        "string",
+						Description: "The value of the expression, as a decimal number",
 					},
 				},
 			},
@@ -88,15 +59,47 @@ func (h *Math) Functions(ctx context.Context) []Function {
 
 func (h *Math) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
 	switch fn {
-	case "sum":
-		a, _ := params["a"].(float64)
-		b, _ := params["b"].(float64)
-		return map[string]any{"result": a + b}, nil
-	case "subtract":
-		a, _ := params["a"].(float64)
-		b, _ := params["b"].(float64)
-		return map[string]any{"result": a - b}, nil
+	case "evaluate":
+		expr, ok := params["expression"].(string)
+		if !ok {
+			return nil, fmt.Errorf("expression parameter must be a string")
+		}
+		vars, err := variables(params["variables"])
+		if err != nil {
+			return nil, err
+		}
+		v, err := calc.Evaluate(expr, vars)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"result": v.String()}, nil
 	default:
 		return nil, fmt.Errorf("unknown function: %s", fn)
 	}
 }
+
+func variables(param any) (map[string]decimal.Decimal, error) {
+	if param == nil {
+		return nil, nil
+	}
+	m, ok := param.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("variables parameter must be an object")
+	}
+	vars := make(map[string]decimal.Decimal, len(m))
+	for name, v := range m {
+		switch v := v.(type) {
+		case float64:
+			vars[name] = decimal.NewFromFloat(v)
+		case string:
+			d, err := decimal.NewFromString(v)
+			if err != nil {
+				return nil, fmt.Errorf("variable %s is not a number: %q", name, v)
+			}
+			vars[name] = d
+		default:
+			return nil, fmt.Errorf("variable %s must be a number or a string holding a number", name)
+		}
+	}
+	return vars, nil
+}
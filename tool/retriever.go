@@ -0,0 +1,239 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+	"github.com/aliphe/skipery/pkg/search"
+)
+
+var _ Tool = (*Retriever)(nil)
+
+const (
+	defaultMaxFunctions   = 20
+	defaultFindToolsLimit = 5
+)
+
+// pinnedFunctions are sent with every message without counting in the limit: find_tools,
+// and the functions reading the jobs handed to the model, which it must be able to call
+// whatever the conversation turned to since.
+var pinnedFunctions = []string{"find_tools", "job_status", "job_result"}
+
+// ToolSelectionConfig limits the functions sent to the model with every message.
+type ToolSelectionConfig struct {
+	// MaxFunctions caps the number of functions sent to the model. Every function is sent
+	// when there are no more.
+	MaxFunctions int `json:"maxFunctions"`
+	// Always lists the functions sent whatever the conversation, by ID or pattern such as
+	// "time_*".
+	Always []string `json:"always"`
+}
+
+// Retriever selects the functions relevant to a conversation, ranking them with BM25
+// over their names, descriptions and parameters. Its find_tools function lets the
+// model search the others.
+type Retriever struct {
+	max    int
+	always []string
+
+	mu        sync.Mutex
+	functions []Function
+	index     *search.Index
+	// found holds the functions pulled in by find_tools, by chat, the most recently
+	// found last.
+	found map[string][]string
+}
+
+// NewRetriever creates a retriever of the functions of tb.
+func NewRetriever(cfg *ToolSelectionConfig, tb ToolBelt) *Retriever {
+	var c ToolSelectionConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.MaxFunctions <= 0 {
+		c.MaxFunctions = defaultMaxFunctions
+	}
+	r := &Retriever{max: c.MaxFunctions, always: c.Always, found: map[string][]string{}}
+	r.Reload(tb)
+	return r
+}
+
+// Reload indexes the functions of tb again, such as when the functions of an MCP server
+// change after it reconnects.
+func (r *Retriever) Reload(tb ToolBelt) {
+	var functions []Function
+	seen := map[Tool]bool{}
+	for _, t := range tb {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		for _, fn := range t.Functions(context.Background()) {
+			if tb[fn.ID] == t {
+				functions = append(functions, fn)
+			}
+		}
+	}
+	slices.SortFunc(functions, func(a, b Function) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	docs := make([]string, len(functions))
+	for i, fn := range functions {
+		docs[i] = functionText(fn)
+	}
+	index := search.NewIndex(docs)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.functions = functions
+	r.index = index
+}
+
+// catalog returns the indexed functions and their index.
+func (r *Retriever) catalog() ([]Function, *search.Index) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.functions, r.index
+}
+
+// functionText is the text a function is searched by. Names are repeated to weigh more
+// than descriptions.
+func functionText(fn Function) string {
+	var b strings.Builder
+	for range 3 {
+		b.WriteString(fn.ID + " " + fn.DisplayName + "\n")
+	}
+	b.WriteString(fn.Description + "\n")
+	for name, p := range fn.Parameters.Properties {
+		b.WriteString(name + " " + p.Description + "\n")
+	}
+	return b.String()
+}
+
+// Select returns the functions of tb to send to the model for a conversation. The
+// pinned functions are always sent, with the ones matching always, the ones found with
+// find_tools in the chat and the ones in recent, such as the functions called in the
+// last turns. The best matches of query fill the remaining slots.
+func (r *Retriever) Select(ctx context.Context, tb ToolBelt, query string, recent []string) ToolBelt {
+	functions, index := r.catalog()
+	if len(functions) <= r.max {
+		ids := make([]string, len(functions))
+		for i, fn := range functions {
+			ids[i] = fn.ID
+		}
+		return tb.Subset(ids)
+	}
+
+	ids := slices.Clone(pinnedFunctions)
+	add := func(id string) {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	for _, fn := range functions {
+		if slices.ContainsFunc(r.always, func(pattern string) bool { return MatchWildcard(pattern, fn.ID) }) {
+			add(fn.ID)
+		}
+	}
+	r.mu.Lock()
+	for _, id := range r.found[ChatID(ctx)] {
+		add(id)
+	}
+	r.mu.Unlock()
+	for _, id := range recent {
+		add(id)
+	}
+	for _, res := range index.Search(query, 0) {
+		if len(ids)-len(pinnedFunctions) >= r.max {
+			break
+		}
+		add(functions[res.Doc].ID)
+	}
+	return tb.Subset(ids)
+}
+
+func (r *Retriever) Functions(ctx context.Context) []Function {
+	functions, _ := r.catalog()
+	return []Function{
+		{
+			ID:          "find_tools",
+			DisplayName: "Find Tools",
+			Description: fmt.Sprintf("Searches the %d available functions by keywords. Only the functions most relevant to the conversation are provided to you: use this function when none of them fits the request, before telling the user that something can't be done. The functions found are provided with the next messages.", len(functions)),
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for searching functions",
+				Properties: map[string]jsonschema.JSONSchema{
+					"query": {
+						Type:        "string",
+						Description: "Keywords describing the task, such as the data or service involved and the action to take",
+						Examples:    []any{"create linear issue", "git commit history", "convert timezone"},
+					},
+					"limit": {
+						Type:        "integer",
+						Description: fmt.Sprintf("The maximum number of functions to return, %d by default", defaultFindToolsLimit),
+					},
+				},
+				Required:         []string{"query"},
+				PropertyOrdering: []string{"query", "limit"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The functions found",
+				Properties: map[string]jsonschema.JSONSchema{
+					"functions": {
+						Type:        "array",
+						Description: "The matching functions, best first",
+						Items: &jsonschema.JSONSchema{
+							Type: "object",
+							Properties: map[string]jsonschema.JSONSchema{
+								"id":          {Type: "string", Description: "The function name"},
+								"description": {Type: "string", Description: "What the function does"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (r *Retriever) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	if fn != "find_tools" {
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+	query, ok := params["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("query parameter must be a non-empty string")
+	}
+	limit := intParam(params, "limit", defaultFindToolsLimit)
+	if limit <= 0 {
+		limit = defaultFindToolsLimit
+	}
+
+	functions := []map[string]any{}
+	var ids []string
+	indexed, index := r.catalog()
+	for _, res := range index.Search(query, limit) {
+		f := indexed[res.Doc]
+		ids = append(ids, f.ID)
+		functions = append(functions, map[string]any{"id": f.ID, "description": f.Description})
+	}
+	chatID := ChatID(ctx)
+	r.mu.Lock()
+	found := r.found[chatID]
+	for _, id := range ids {
+		found = append(slices.DeleteFunc(found, func(f string) bool { return f == id }), id)
+	}
+	// Found functions take at most half of the slots, the oldest ones being dropped
+	// first, so that the conversation still selects the others.
+	if over := len(found) - max(r.max/2, 1); over > 0 {
+		found = slices.Delete(found, 0, over)
+	}
+	r.found[chatID] = found
+	r.mu.Unlock()
+	return map[string]any{"functions": functions}, nil
+}
@@ -0,0 +1,58 @@
+package tool
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// retrieverTestTool provides functions about a few unrelated topics.
+type retrieverTestTool struct{}
+
+func (retrieverTestTool) Functions(context.Context) []Function {
+	var functions []Function
+	for _, topic := range []string{"invoice", "weather", "calendar", "ticket", "playlist", "recipe", "flight", "parcel"} {
+		functions = append(functions,
+			Function{ID: topic + "_list", Description: "Lists the " + topic + " entries"},
+			Function{ID: topic + "_create", Description: "Creates a " + topic},
+		)
+	}
+	return functions
+}
+
+func (retrieverTestTool) Call(context.Context, string, map[string]any) (map[string]any, error) {
+	return map[string]any{}, nil
+}
+
+func TestRetrieverFound(t *testing.T) {
+	var tool retrieverTestTool
+	tb := ToolBelt{}
+	for _, fn := range tool.Functions(context.Background()) {
+		tb[fn.ID] = tool
+	}
+	r := NewRetriever(&ToolSelectionConfig{MaxFunctions: 6}, tb)
+	tb["find_tools"] = r
+	ctx := WithChatID(context.Background(), "chat")
+
+	for _, query := range []string{"invoice", "weather", "flight"} {
+		if _, err := r.Call(ctx, "find_tools", map[string]any{"query": query, "limit": 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Found functions keep half of the slots, the last ones found.
+	found := r.found["chat"]
+	if len(found) != 3 || !slices.Contains(found, "flight_list") || !slices.Contains(found, "flight_create") {
+		t.Errorf("found = %v, want 3 functions ending with the flight ones", found)
+	}
+
+	// The other slots go to the query.
+	selected := slices.Sorted(maps.Keys(r.Select(ctx, tb, "recipe", nil)))
+	if !slices.Contains(selected, "recipe_list") || !slices.Contains(selected, "recipe_create") || !slices.Contains(selected, "flight_list") {
+		t.Errorf("selected %v, want the found and the recipe functions", selected)
+	}
+
+	if found := r.found["other"]; len(found) != 0 {
+		t.Errorf("found in another chat = %v, want none", found)
+	}
+}
@@ -0,0 +1,318 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+)
+
+var _ Tool = (*Shell)(nil)
+
+const (
+	defaultShellTimeout   = time.Minute
+	defaultShellMaxOutput = 64 << 10
+)
+
+var defaultShellEnv = []string{"PATH", "HOME", "USER", "LANG", "TMPDIR"}
+
+// ShellConfig restricts the commands the shell tool can run.
+type ShellConfig struct {
+	// Dir is the directory commands run in, the current directory by default. Commands
+	// can only run in Dir or one of its subdirectories.
+	Dir string `json:"dir"`
+	// Allow lists the patterns of the commands that can run, such as "go test *" or
+	// "git status". * matches any sequence of characters.
+	Allow []string `json:"allow"`
+	// Deny lists the patterns of the commands that can't run, even when allowed.
+	Deny []string `json:"deny"`
+	// Env lists the names of the environment variables passed to commands.
+	Env []string `json:"env"`
+	// Timeout bounds the execution time of a command.
+	Timeout Duration `json:"timeout"`
+	// MaxOutput caps, in bytes, the output kept from each of stdout and stderr.
+	MaxOutput int `json:"maxOutput"`
+}
+
+type Shell struct {
+	dir       string
+	allow     []string
+	deny      []string
+	env       []string
+	timeout   time.Duration
+	maxOutput int
+}
+
+// NewShell creates a shell tool running the commands allowed by cfg.
+func NewShell(cfg *ShellConfig) (*Shell, error) {
+	if cfg == nil || len(cfg.Allow) == 0 {
+		return nil, fmt.Errorf("at least one allowed command pattern is required")
+	}
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve directory %s: %w", cfg.Dir, err)
+	}
+	s := &Shell{
+		dir:       dir,
+		allow:     cfg.Allow,
+		deny:      cfg.Deny,
+		env:       cfg.Env,
+		timeout:   time.Duration(cfg.Timeout),
+		maxOutput: cfg.MaxOutput,
+	}
+	if s.env == nil {
+		s.env = defaultShellEnv
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultShellTimeout
+	}
+	if s.maxOutput <= 0 {
+		s.maxOutput = defaultShellMaxOutput
+	}
+	return s, nil
+}
+
+func (s *Shell) Functions(ctx context.Context) []Function {
+	return []Function{
+		{
+			ID:          "shell_run",
+			DisplayName: "Run Command",
+			Async:       true,
+			Description: fmt.Sprintf("Runs a command on the user's machine and returns its output and exit code. Use this function to build, test or inspect local projects. Only commands matching one of these patterns are allowed: %s. Commands run in %s and are stopped after %s.", strings.Join(s.allow, ", "), s.dir, s.timeout),
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for running a command",
+				Properties: map[string]jsonschema.JSONSchema{
+					"command": {
+						Type:        "string",
+						Description: "The command line to run. Arguments are split on spaces, and can be quoted with single or double quotes. The command is not run by a shell: pipes, redirections, variables and command chaining are not supported.",
+						Examples:    []any{"go test ./...", "git status", "make build"},
+					},
+					"dir": {
+						Type:        "string",
+						Description: "The directory to run the command in, relative to " + s.dir + ". Defaults to " + s.dir + ".",
+						Examples:    []any{".", "cmd/term"},
+					},
+				},
+				Required:         []string{"command"},
+				PropertyOrdering: []string{"command", "dir"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The outcome of the command",
+				Properties: map[string]jsonschema.JSONSchema{
+					"exit_code":        {Type: "integer", Description: "The exit code of the command, 0 on success and -1 when it was stopped"},
+					"stdout":           {Type: "string", Description: "The standard output of the command"},
+					"stderr":           {Type: "string", Description: "The standard error of the command"},
+					"stdout_truncated": {Type: "boolean", Description: "True when only the beginning of the standard output is returned"},
+					"stderr_truncated": {Type: "boolean", Description: "True when only the beginning of the standard error is returned"},
+					"timed_out":        {Type: "boolean", Description: "True when the command was stopped because it ran for too long"},
+					"duration_ms":      {Type: "integer", Description: "The execution time of the command in milliseconds"},
+				},
+			},
+		},
+	}
+}
+
+func (s *Shell) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	switch fn {
+	case "shell_run":
+		command, ok := params["command"].(string)
+		if !ok {
+			return nil, fmt.Errorf("command parameter must be a string")
+		}
+		dir, _ := params["dir"].(string)
+		return s.run(ctx, command, dir)
+	default:
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+}
+
+func (s *Shell) run(ctx context.Context, command, dir string) (map[string]any, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	line := strings.Join(args, " ")
+	if !s.allowed(line) {
+		return nil, fmt.Errorf("command %q is not allowed, allowed commands are: %s", line, strings.Join(s.allow, ", "))
+	}
+
+	workDir := s.dir
+	if dir != "" {
+		rel := filepath.Clean(dir)
+		if filepath.IsAbs(rel) {
+			if rel, err = filepath.Rel(s.dir, rel); err != nil {
+				return nil, err
+			}
+		}
+		if !filepath.IsLocal(rel) && rel != "." {
+			return nil, fmt.Errorf("directory %s is outside of %s", dir, s.dir)
+		}
+		workDir = filepath.Join(s.dir, rel)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stdout := &cappedBuffer{max: s.maxOutput}
+	stderr := &cappedBuffer{max: s.maxOutput}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = workDir
+	cmd.Env = s.environ()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Don't wait forever for the output of processes started by a killed command.
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err = cmd.Run()
+	duration := time.Since(start)
+
+	exitCode := 0
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	var exitErr *exec.ExitError
+	switch {
+	case timedOut:
+		exitCode = -1
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		return nil, fmt.Errorf("failed to run command: %w", err)
+	}
+
+	return map[string]any{
+		"exit_code":        exitCode,
+		"stdout":           stdout.String(),
+		"stderr":           stderr.String(),
+		"stdout_truncated": stdout.truncated,
+		"stderr_truncated": stderr.truncated,
+		"timed_out":        timedOut,
+		"duration_ms":      duration.Milliseconds(),
+	}, nil
+}
+
+func (s *Shell) allowed(line string) bool {
+	for _, p := range s.deny {
+		if MatchWildcard(p, line) {
+			return false
+		}
+	}
+	for _, p := range s.allow {
+		if MatchWildcard(p, line) {
+			return true
+		}
+	}
+	return false
+}
+
+// environ returns the allowed variables of the agent environment.
+func (s *Shell) environ() []string {
+	env := make([]string, 0, len(s.env))
+	for _, name := range s.env {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// splitCommand splits a command line into arguments, honoring single and double quotes.
+// Shell operators are rejected since commands don't run in a shell.
+func splitCommand(command string) ([]string, error) {
+	var (
+		args    []string
+		arg     strings.Builder
+		inArg   bool
+		quote   byte
+		escaped bool
+	)
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case escaped:
+			arg.WriteByte(c)
+			escaped = false
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteByte(c)
+			}
+		case c == '\\':
+			escaped, inArg = true, true
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case strings.IndexByte("|&;<>`$(){}", c) >= 0:
+			return nil, fmt.Errorf("shell operator %q is not supported, run a single command without pipes, redirections, variables or chaining", c)
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return args, nil
+}
+
+// MatchWildcard reports whether s matches pattern, where * matches any sequence of
+// characters, including none.
+func MatchWildcard(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the rest.
+type cappedBuffer struct {
+	buf       strings.Builder
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - b.buf.Len(); n > room {
+		b.truncated = true
+		p = p[:max(room, 0)]
+	}
+	b.buf.Write(p)
+	// Report everything as written so the command isn't interrupted.
+	return n, nil
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
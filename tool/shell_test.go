@@ -0,0 +1,151 @@
+package tool
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		wantErr string
+	}{
+		{command: "go test ./...", want: []string{"go", "test", "./..."}},
+		{command: "  git   log\t-n 3\n", want: []string{"git", "log", "-n", "3"}},
+		{command: `grep -r "hello world" .`, want: []string{"grep", "-r", "hello world", "."}},
+		{command: `echo 'a "quoted" word'`, want: []string{"echo", `a "quoted" word`}},
+		{command: `echo "it's"`, want: []string{"echo", "it's"}},
+		{command: `echo a\ b \"c\"`, want: []string{"echo", "a b", `"c"`}},
+		{command: `echo "" x`, want: []string{"echo", "", "x"}},
+		{command: `echo "a|b;c"`, want: []string{"echo", "a|b;c"}},
+		{command: `echo a\|b`, want: []string{"echo", "a|b"}},
+		{command: "ls | wc -l", wantErr: `shell operator '|'`},
+		{command: "make && rm -rf /", wantErr: `shell operator '&'`},
+		{command: "go test; rm -rf /", wantErr: `shell operator ';'`},
+		{command: "cat < secrets", wantErr: `shell operator '<'`},
+		{command: "echo $HOME", wantErr: `shell operator '$'`},
+		{command: "echo `id`", wantErr: "shell operator '`'"},
+		{command: `echo "open`, wantErr: `unterminated " quote`},
+		{command: "   ", wantErr: "empty command"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("splitCommand() = %q, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{pattern: "git status", s: "git status", want: true},
+		{pattern: "git status", s: "git status -s", want: false},
+		{pattern: "go test *", s: "go test ./...", want: true},
+		{pattern: "go test *", s: "go test ", want: true},
+		{pattern: "go test *", s: "go test", want: false},
+		{pattern: "go test *", s: "go testing", want: false},
+		{pattern: "*", s: "", want: true},
+		{pattern: "* --force", s: "git push --force", want: true},
+		{pattern: "* --force", s: "git push --force-with-lease", want: false},
+		{pattern: "*--force*", s: "git push --force-with-lease", want: true},
+		{pattern: "git * main", s: "git push origin main", want: true},
+		{pattern: "a*b*a", s: "aba", want: true},
+		{pattern: "a*b*a", s: "ab", want: false},
+		{pattern: "ab*ba", s: "aba", want: false},
+		{pattern: "fs_*", s: "fs_read", want: true},
+	}
+	for _, tt := range tests {
+		if got := MatchWildcard(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("MatchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestShellAllowed(t *testing.T) {
+	s, err := NewShell(&ShellConfig{
+		Dir:   t.TempDir(),
+		Allow: []string{"git status", "git log *", "go test *", "echo *"},
+		Deny:  []string{"* --exec*", "go test * -run Slow*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		command string
+		wantErr string
+	}{
+		{command: "echo hello"},
+		{command: `echo "quoted   spaces"`},
+		{command: "git   status"},
+		{command: "git status --porcelain", wantErr: `command "git status --porcelain" is not allowed`},
+		{command: "git log --exec=sh", wantErr: "is not allowed"},
+		{command: "go test ./tool -run SlowTests", wantErr: "is not allowed"},
+		{command: "rm -rf /", wantErr: "is not allowed, allowed commands are: git status, git log *, go test *, echo *"},
+		{command: "echo hi; rm -rf /", wantErr: "shell operator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			_, err := s.Call(context.Background(), "shell_run", map[string]any{"command": tt.command})
+			if tt.wantErr == "" {
+				if err != nil && strings.Contains(err.Error(), "not allowed") {
+					t.Errorf("shell_run = %v, want the command allowed", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("shell_run = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShellRun(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewShell(&ShellConfig{Dir: dir, Allow: []string{"echo *", "pwd", "sh -c *"}, MaxOutput: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(command, dir string) (map[string]any, error) {
+		return s.Call(context.Background(), "shell_run", map[string]any{"command": command, "dir": dir})
+	}
+
+	out, err := run(`echo "quoted   spaces" kept`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["stdout"] != "quoted  " || out["stdout_truncated"] != true || out["exit_code"] != 0 {
+		t.Errorf("echo = %v, want its output capped to 8 bytes", out)
+	}
+
+	out, err = run("sh -c 'exit 3'", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["exit_code"] != 3 {
+		t.Errorf("exit code = %v, want 3", out["exit_code"])
+	}
+
+	for _, outside := range []string{"..", "/", "sub/../../x"} {
+		if _, err := run("pwd", outside); err == nil || !strings.Contains(err.Error(), "is outside of") {
+			t.Errorf("running in %s = %v, want an outside directory error", outside, err)
+		}
+	}
+}
@@ -2,7 +2,15 @@ package tool
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/aliphe/skipery/pkg/jsonschema"
 	"github.com/jmoiron/sqlx"
@@ -10,12 +18,110 @@ import (
 
 var _ Tool = (*SQL)(nil)
 
+const (
+	defaultSQLMaxRows = 100
+	defaultSQLTimeout = 10 * time.Second
+)
+
+var (
+	readStatements  = []string{"SELECT", "WITH", "EXPLAIN", "VALUES"}
+	writeStatements = []string{"INSERT", "UPDATE", "DELETE", "REPLACE"}
+)
+
+// SQLConfig bounds what the SQL tool is allowed to run.
+type SQLConfig struct {
+	// SQLPolicy applies to the agent database
+	SQLPolicy
+	// MaxRows caps the number of rows returned by a query.
+	MaxRows int `json:"maxRows"`
+	// Timeout bounds the execution time of a query.
+	Timeout Duration `json:"timeout"`
+	// Databases lists additional SQLite databases the model can query, by name.
+	Databases map[string]*SQLDatabase `json:"databases"`
+}
+
+// SQLPolicy restricts the statements the model can run against a database.
+type SQLPolicy struct {
+	// AllowWrites lets the model modify the database. Queries run with the query_only
+	// pragma otherwise.
+	AllowWrites bool `json:"allowWrites"`
+	// Statements lists the statement keywords the model may run. Defaults to read
+	// statements, plus INSERT, UPDATE, DELETE and REPLACE when writes are allowed.
+	Statements []string `json:"statements"`
+}
+
+// SQLDatabase is a SQLite database file the model can query.
+type SQLDatabase struct {
+	SQLPolicy
+	// Path of the SQLite database file
+	Path string `json:"path"`
+	// Attach makes the database tables available from the agent database as
+	// <name>.<table>, so they can be joined with the agent tables. The database is
+	// opened on its own otherwise.
+	Attach bool `json:"attach"`
+}
+
 type SQL struct {
-	db *sqlx.DB
+	sources map[string]*sqlSource
+	// names lists the source names, the agent database first
+	names   []string
+	maxRows int
+	timeout time.Duration
+	// schema summarizes the database tables as of the tool creation
+	schema string
 }
 
-func NewSQL(db *sqlx.DB) *SQL {
-	return &SQL{db: db}
+// NewSQL creates a SQL tool querying the agent database and the databases listed in
+// cfg, read-only unless their policy allows writes. A nil cfg uses the defaults. The
+// database schemas are read once to describe them to the model.
+func NewSQL(ctx context.Context, db *sqlx.DB, cfg *SQLConfig) (*SQL, error) {
+	var c SQLConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	s := &SQL{
+		sources: map[string]*sqlSource{
+			mainSQLSource: {name: mainSQLSource, policy: c.SQLPolicy.withDefaults(), db: db},
+		},
+		names:   []string{mainSQLSource},
+		maxRows: c.MaxRows,
+		timeout: time.Duration(c.Timeout),
+	}
+	if s.maxRows <= 0 {
+		s.maxRows = defaultSQLMaxRows
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultSQLTimeout
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Databases)) {
+		src, err := openSQLSource(ctx, name, c.Databases[name])
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("open database %s: %w", name, err)
+		}
+		s.sources[name] = src
+		s.names = append(s.names, name)
+	}
+
+	schema, err := s.summarizeSchema(ctx)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("read database schema: %w", err)
+	}
+	s.schema = schema
+	return s, nil
+}
+
+// Close closes the databases opened by the tool. The agent database is left open.
+func (s *SQL) Close() error {
+	var errs []error
+	for _, src := range s.sources {
+		if src.name != mainSQLSource && src.db != nil {
+			errs = append(errs, src.db.Close())
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (s *SQL) Functions(ctx context.Context) []Function {
@@ -23,14 +129,14 @@ func (s *SQL) Functions(ctx context.Context) []Function {
 		{
 			ID:          "sql_query",
 			DisplayName: "SQL Query",
-			Description: "Execute a SQL query against the database and return the results. Use this tool to query the chat database, retrieve conversation history, analyze chat patterns, or perform any database operations. The database contains chat and message data.",
+			Description: s.description(),
 			Parameters: jsonschema.JSONSchema{
 				Type:        "object",
 				Description: "Parameters for executing a SQL query against the database",
 				Properties: map[string]jsonschema.JSONSchema{
 					"query": {
 						Type:        "string",
-						Description: "A valid SQL query to execute against the database. Must be a properly formatted SQL statement using standard SQL syntax. The database schema includes: 'chats' table (id TEXT PRIMARY KEY, title TEXT, created_at TIMESTAMP) and 'messages' table (id TEXT PRIMARY KEY, chat_id TEXT, author TEXT, content TEXT, function_calls BLOB, function_responses BLOB, created_at TIMESTAMP). Use standard SQL functions and avoid database-specific syntax.",
+						Description: "A valid SQLite query to execute against the database. Must be a single, properly formatted SQL statement. The database schemas are: " + s.schema + ". Use sql_describe_table for column details.",
 						Examples: []any{
 							"SELECT * FROM chats ORDER BY created_at DESC LIMIT 10",
 							"SELECT COUNT(*) as total_messages FROM messages",
@@ -41,9 +147,10 @@ func (s *SQL) Functions(ctx context.Context) []Function {
 							"SELECT chats.title, COUNT(messages.id) as msg_count FROM chats LEFT JOIN messages ON chats.id = messages.chat_id GROUP BY chats.id, chats.title HAVING msg_count > 5",
 						},
 					},
+					"database": s.databaseParameter(),
 				},
 				Required:         []string{"query"},
-				PropertyOrdering: []string{"query"},
+				PropertyOrdering: []string{"query", "database"},
 			},
 			Response: jsonschema.JSONSchema{
 				Type:        "object",
@@ -51,48 +158,356 @@ func (s *SQL) Functions(ctx context.Context) []Function {
 				Properties: map[string]jsonschema.JSONSchema{
 					"results": {
 						Type:        "array",
-						Description: "Array of result rows from the SQL query. Each row is an object with column names as keys and their values. Empty array if no results found.",
+						Description: "Array of result rows from the SQL query. Each row is an object with column names as keys and their values. Times are formatted as RFC 3339 and binary values as objects holding their base64 encoding and size. Empty array if no results found.",
 						Items: &jsonschema.JSONSchema{
 							Type:        "object",
 							Description: "A single row result with column names as keys and their corresponding values",
 						},
 					},
+					"truncated": {
+						Type:        "boolean",
+						Description: "True when the query returned more rows than the row cap and only the first rows are included. Refine the query, for example with LIMIT or aggregates, to see the rest.",
+					},
+				},
+			},
+		},
+		{
+			ID:          "sql_list_tables",
+			DisplayName: "SQL List Tables",
+			Description: "List the tables and views of every available database. Use this function to discover what data can be queried before writing a SQL query.",
+			CacheTTL:    time.Minute,
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "No parameters required for this function",
+				Properties:  map[string]jsonschema.JSONSchema{},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The tables of the database",
+				Properties: map[string]jsonschema.JSONSchema{
+					"tables": {
+						Type:        "array",
+						Description: "The tables and views of every database",
+						Items: &jsonschema.JSONSchema{
+							Type:        "object",
+							Description: "A table or view",
+							Properties: map[string]jsonschema.JSONSchema{
+								"database": {Type: "string", Description: "The database holding the table"},
+								"name":     {Type: "string", Description: "The table name"},
+								"type":     {Type: "string", Description: "Either 'table' or 'view'"},
+							},
+						},
+					},
 				},
 			},
 		},
+		{
+			ID:          "sql_describe_table",
+			DisplayName: "SQL Describe Table",
+			Description: "Describe the columns and indexes of a table or view. Use this function to learn column names and types before writing a SQL query.",
+			CacheTTL:    time.Minute,
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for describing a table",
+				Properties: map[string]jsonschema.JSONSchema{
+					"table": {
+						Type:        "string",
+						Description: "The name of the table to describe, optionally prefixed with the database name and a dot.",
+						Examples:    []any{"chats", "messages", "analytics.events"},
+					},
+					"database": s.databaseParameter(),
+				},
+				Required:         []string{"table"},
+				PropertyOrdering: []string{"table", "database"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The structure of the table",
+				Properties: map[string]jsonschema.JSONSchema{
+					"columns": {
+						Type:        "array",
+						Description: "The columns of the table, in order",
+						Items: &jsonschema.JSONSchema{
+							Type:        "object",
+							Description: "A column of the table",
+							Properties: map[string]jsonschema.JSONSchema{
+								"name":        {Type: "string", Description: "The column name"},
+								"type":        {Type: "string", Description: "The declared column type"},
+								"not_null":    {Type: "boolean", Description: "Whether the column rejects NULL values"},
+								"default":     {Type: "string", Description: "The default value expression, if any"},
+								"primary_key": {Type: "boolean", Description: "Whether the column is part of the primary key"},
+							},
+						},
+					},
+					"indexes": {
+						Type:        "array",
+						Description: "The names of the indexes of the table",
+						Items:       &jsonschema.JSONSchema{Type: "string"},
+					},
+					"sql": {
+						Type:        "string",
+						Description: "The statement that created the table",
+					},
+				},
+			},
+		},
+		{
+			ID:          "sql_explain",
+			DisplayName: "SQL Explain",
+			Description: "Show the query plan SQLite would use for a SQL query, without running it. Use this function to check a query is valid or to understand why it is slow.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for explaining a SQL query",
+				Properties: map[string]jsonschema.JSONSchema{
+					"query": {
+						Type:        "string",
+						Description: "The SQL query to explain",
+						Examples:    []any{"SELECT * FROM messages WHERE chat_id = 'abc123'"},
+					},
+					"database": s.databaseParameter(),
+				},
+				Required:         []string{"query"},
+				PropertyOrdering: []string{"query", "database"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The query plan",
+				Properties: map[string]jsonschema.JSONSchema{
+					"plan": {
+						Type:        "array",
+						Description: "The steps of the query plan, each step referencing its parent step",
+						Items: &jsonschema.JSONSchema{
+							Type:        "object",
+							Description: "A step of the query plan",
+							Properties: map[string]jsonschema.JSONSchema{
+								"id":     {Type: "integer", Description: "The step identifier"},
+								"parent": {Type: "integer", Description: "The identifier of the parent step, 0 for top level steps"},
+								"detail": {Type: "string", Description: "What the step does"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *SQL) databaseParameter() jsonschema.JSONSchema {
+	return jsonschema.JSONSchema{
+		Type:        "string",
+		Description: "The name of the database to use, one of: " + strings.Join(s.names, ", ") + ". Defaults to main.",
+		Examples:    []any{mainSQLSource},
 	}
 }
 
 func (s *SQL) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	database, _ := params["database"].(string)
 	switch fn {
 	case "sql_query":
 		query, ok := params["query"].(string)
 		if !ok {
 			return nil, fmt.Errorf("query parameter must be a string")
 		}
+		return s.query(ctx, database, query)
+	case "sql_list_tables":
+		return s.listTables(ctx)
+	case "sql_describe_table":
+		table, ok := params["table"].(string)
+		if !ok {
+			return nil, fmt.Errorf("table parameter must be a string")
+		}
+		return s.describeTable(ctx, database, table)
+	case "sql_explain":
+		query, ok := params["query"].(string)
+		if !ok {
+			return nil, fmt.Errorf("query parameter must be a string")
+		}
+		return s.explain(ctx, database, query)
+	default:
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+}
 
-		rows, err := s.db.QueryxContext(ctx, query)
-		if err != nil {
-			return nil, fmt.Errorf("failed to execute query: %w", err)
+func (s *SQL) description() string {
+	databases := make([]string, len(s.names))
+	for i, name := range s.names {
+		src := s.sources[name]
+		access := "read-only"
+		if src.policy.AllowWrites {
+			access = "read-write"
 		}
-		defer rows.Close()
+		databases[i] = fmt.Sprintf("%s (%s, allowing %s statements)", name, access, strings.Join(src.policy.Statements, ", "))
+		if src.attach {
+			databases[i] += ", also attached to main"
+		}
+	}
+	return fmt.Sprintf("Execute a SQL query against a database and return the results. Use this tool to query the chat database, retrieve conversation history or analyze chat patterns. The main database contains chat and message data. Available databases: %s. Results are capped to %d rows.", strings.Join(databases, "; "), s.maxRows)
+}
 
-		var results []map[string]any
-		for rows.Next() {
-			row := make(map[string]any)
-			err := rows.MapScan(row)
-			if err != nil {
-				return nil, fmt.Errorf("failed to scan row: %w", err)
-			}
-			results = append(results, row)
+func (s *SQL) query(ctx context.Context, database, query string) (map[string]any, error) {
+	src, err := s.source(database)
+	if err != nil {
+		return nil, err
+	}
+	keywords, err := statementKeywords(query)
+	if err != nil {
+		return nil, err
+	}
+	for _, keyword := range keywords {
+		if !slices.Contains(src.policy.Statements, keyword) {
+			return nil, fmt.Errorf("%s statements are not allowed on %s, allowed statements are: %s", keyword, src.name, strings.Join(src.policy.Statements, ", "))
 		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
-		if err := rows.Err(); err != nil {
-			return nil, fmt.Errorf("error iterating rows: %w", err)
+	conn, release, err := s.conn(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rows, err := conn.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		results   []map[string]any
+		truncated bool
+	)
+	for rows.Next() {
+		if len(results) == s.maxRows {
+			truncated = true
+			break
+		}
+		row := make(map[string]any)
+		err := rows.MapScan(row)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		for k, v := range row {
+			row[k] = sqlValue(v)
 		}
+		results = append(results, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return map[string]any{"results": results, "truncated": truncated}, nil
+}
 
-		return map[string]any{"results": results}, nil
+// sqlValue converts a scanned column value to a value that reads well once encoded as
+// JSON: text stored as bytes becomes a string, binary data is base64 encoded and times
+// are formatted as RFC 3339.
+func sqlValue(v any) any {
+	switch v := v.(type) {
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return map[string]any{
+			"base64": base64.StdEncoding.EncodeToString(v),
+			"size":   len(v),
+		}
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
 	default:
-		return nil, fmt.Errorf("unknown function: %s", fn)
+		return v
+	}
+}
+
+// statementKeywords returns the upper-cased keywords deciding what a single SQL
+// statement does: its first keyword and, when it starts with common table expressions,
+// the keyword of the statement following them, such as DELETE in
+// WITH x AS (SELECT 1) DELETE FROM t. Comments are skipped. It fails when the query
+// holds more than one statement.
+func statementKeywords(query string) ([]string, error) {
+	var (
+		// words lists the words outside of parentheses
+		words      []string
+		word       strings.Builder
+		depth      int
+		terminated bool
+	)
+	flush := func() {
+		if word.Len() > 0 && depth == 0 {
+			words = append(words, strings.ToUpper(word.String()))
+		}
+		word.Reset()
+	}
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case strings.HasPrefix(query[i:], "--"):
+			flush()
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			i += end
+			continue
+		case strings.HasPrefix(query[i:], "/*"):
+			flush()
+			end := strings.Index(query[i:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 1
+			continue
+		case c == ';':
+			flush()
+			terminated = true
+			continue
+		case unicode.IsSpace(rune(c)):
+			flush()
+			continue
+		}
+
+		if terminated {
+			return nil, fmt.Errorf("only one statement can be executed at a time")
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			flush()
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := strings.IndexByte(query[i+1:], closing)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted string")
+			}
+			i += end + 1
+		case c == '(':
+			flush()
+			depth++
+		case c == ')':
+			flush()
+			depth--
+		case c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			word.WriteByte(c)
+		default:
+			flush()
+		}
+	}
+	flush()
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	if words[0] != "WITH" {
+		return words[:1], nil
+	}
+	// Common table expressions are parenthesized, so the first statement keyword outside
+	// of parentheses starts the statement using them.
+	for _, w := range words[1:] {
+		if slices.Contains(readStatements, w) || slices.Contains(writeStatements, w) {
+			return []string{"WITH", w}, nil
+		}
 	}
+	return nil, fmt.Errorf("no statement follows the common table expressions")
 }
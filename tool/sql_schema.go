@@ -0,0 +1,238 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type sqlTable struct {
+	Database string `db:"database"`
+	Name     string `db:"name"`
+	Type     string `db:"type"`
+	Columns  []sqlColumn
+}
+
+type sqlColumn struct {
+	CID        int            `db:"cid"`
+	Name       string         `db:"name"`
+	Type       string         `db:"type"`
+	NotNull    bool           `db:"notnull"`
+	Default    sql.NullString `db:"dflt_value"`
+	PrimaryKey int            `db:"pk"`
+}
+
+// listTables returns the tables and views of every source.
+func (s *SQL) listTables(ctx context.Context) (map[string]any, error) {
+	tables, err := s.tables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]map[string]any, len(tables))
+	for i, t := range tables {
+		out[i] = map[string]any{"database": t.Database, "name": t.Name, "type": t.Type}
+	}
+	return map[string]any{"tables": out}, nil
+}
+
+func (s *SQL) tables(ctx context.Context) ([]sqlTable, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var tables []sqlTable
+	for _, name := range s.names {
+		src := s.sources[name]
+		if src.attach {
+			// Attached databases are listed along with the main database.
+			continue
+		}
+		t, err := s.sourceTables(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t...)
+	}
+	return tables, nil
+}
+
+func (s *SQL) sourceTables(ctx context.Context, src *sqlSource) ([]sqlTable, error) {
+	conn, release, err := s.conn(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var schemas []string
+	if err := conn.SelectContext(ctx, &schemas, "SELECT name FROM pragma_database_list WHERE name != 'temp' ORDER BY seq"); err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	var tables []sqlTable
+	for _, schema := range schemas {
+		database := schema
+		if schema == "main" {
+			database = src.name
+		}
+		var t []sqlTable
+		query := fmt.Sprintf("SELECT ? AS database, name, type FROM %s.sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%%' ORDER BY name", quoteIdentifier(schema))
+		if err := conn.SelectContext(ctx, &t, query, database); err != nil {
+			return nil, fmt.Errorf("failed to list tables of %s: %w", database, err)
+		}
+		for i := range t {
+			t[i].Columns, err = columns(ctx, conn, schema, t[i].Name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		tables = append(tables, t...)
+	}
+	return tables, nil
+}
+
+// describeTable returns the columns, indexes and creation statement of a table. The
+// table name may be prefixed with its database name instead of setting database.
+func (s *SQL) describeTable(ctx context.Context, database, table string) (map[string]any, error) {
+	if prefix, name, ok := strings.Cut(table, "."); ok && database == "" {
+		if _, known := s.sources[prefix]; known {
+			database, table = prefix, name
+		}
+	}
+	src, err := s.source(database)
+	if err != nil {
+		return nil, err
+	}
+	schema := "main"
+	if src.db == nil {
+		schema = src.name
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	conn, release, err := s.conn(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	cols, err := columns(ctx, conn, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("table %s not found in %s, use sql_list_tables to find existing tables", table, src.name)
+	}
+
+	var indexes []string
+	if err := conn.SelectContext(ctx, &indexes, "SELECT name FROM pragma_index_list(?, ?)", table, schema); err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	var create sql.NullString
+	query := fmt.Sprintf("SELECT sql FROM %s.sqlite_master WHERE name = ?", quoteIdentifier(schema))
+	if err := conn.GetContext(ctx, &create, query, table); err != nil {
+		return nil, fmt.Errorf("failed to read table definition: %w", err)
+	}
+
+	out := make([]map[string]any, len(cols))
+	for i, c := range cols {
+		out[i] = map[string]any{
+			"name":        c.Name,
+			"type":        c.Type,
+			"not_null":    c.NotNull,
+			"primary_key": c.PrimaryKey > 0,
+		}
+		if c.Default.Valid {
+			out[i]["default"] = c.Default.String
+		}
+	}
+	return map[string]any{
+		"columns": out,
+		"indexes": indexes,
+		"sql":     create.String,
+	}, nil
+}
+
+func columns(ctx context.Context, conn *sqlx.Conn, schema, table string) ([]sqlColumn, error) {
+	var cols []sqlColumn
+	if err := conn.SelectContext(ctx, &cols, "SELECT cid, name, type, \"notnull\", dflt_value, pk FROM pragma_table_info(?, ?) ORDER BY cid", table, schema); err != nil {
+		return nil, fmt.Errorf("failed to describe table: %w", err)
+	}
+	return cols, nil
+}
+
+// explain returns the query plan of a single statement without running it.
+func (s *SQL) explain(ctx context.Context, database, query string) (map[string]any, error) {
+	src, err := s.source(database)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := statementKeywords(query); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	conn, release, err := s.conn(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var steps []struct {
+		ID      int    `db:"id"`
+		Parent  int    `db:"parent"`
+		NotUsed int    `db:"notused"`
+		Detail  string `db:"detail"`
+	}
+	if err := conn.SelectContext(ctx, &steps, "EXPLAIN QUERY PLAN "+query); err != nil {
+		return nil, fmt.Errorf("failed to explain query: %w", err)
+	}
+
+	plan := make([]map[string]any, len(steps))
+	for i, st := range steps {
+		plan[i] = map[string]any{"id": st.ID, "parent": st.Parent, "detail": st.Detail}
+	}
+	return map[string]any{"plan": plan}, nil
+}
+
+// summarizeSchema describes every table and its columns on a single line, grouped by
+// database, for instance "main: table chats (id TEXT, title TEXT); analytics: view
+// events (id INTEGER, name TEXT)".
+func (s *SQL) summarizeSchema(ctx context.Context) (string, error) {
+	tables, err := s.tables(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		databases []string
+		byName    = make(map[string][]string)
+	)
+	for _, t := range tables {
+		cols := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			cols[i] = strings.TrimSpace(c.Name + " " + c.Type)
+		}
+		if _, ok := byName[t.Database]; !ok {
+			databases = append(databases, t.Database)
+		}
+		byName[t.Database] = append(byName[t.Database], fmt.Sprintf("%s %s (%s)", t.Type, t.Name, strings.Join(cols, ", ")))
+	}
+	if len(databases) == 0 {
+		return "no tables", nil
+	}
+
+	summaries := make([]string, len(databases))
+	for i, database := range databases {
+		summaries[i] = database + ": " + strings.Join(byName[database], ", ")
+	}
+	return strings.Join(summaries, "; "), nil
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,157 @@
+package tool
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// mainSQLSource names the agent database.
+const mainSQLSource = "main"
+
+// sqlSource is a database the SQL tool can query.
+type sqlSource struct {
+	name   string
+	policy SQLPolicy
+	// attach is set for databases attached to the agent database
+	attach bool
+	// db is the connection of the source. Read-only attached databases have none, and
+	// are queried through the agent database.
+	db *sqlx.DB
+	// uri locates attached databases
+	uri string
+}
+
+func (p SQLPolicy) withDefaults() SQLPolicy {
+	statements := p.Statements
+	if len(statements) == 0 {
+		statements = slices.Clone(readStatements)
+		if p.AllowWrites {
+			statements = append(statements, writeStatements...)
+		}
+	}
+	upper := make([]string, len(statements))
+	for i, st := range statements {
+		upper[i] = strings.ToUpper(st)
+	}
+	return SQLPolicy{AllowWrites: p.AllowWrites, Statements: upper}
+}
+
+func openSQLSource(ctx context.Context, name string, cfg *SQLDatabase) (*sqlSource, error) {
+	if name == mainSQLSource || name == "temp" {
+		return nil, fmt.Errorf("%s is a reserved database name", name)
+	}
+	if cfg == nil || cfg.Path == "" {
+		return nil, fmt.Errorf("missing database path")
+	}
+
+	// Read-only databases are opened as such, so that they stay protected when attached
+	// to a writable database.
+	mode := "ro"
+	if cfg.AllowWrites {
+		mode = "rw"
+	}
+	src := &sqlSource{
+		name:   name,
+		policy: cfg.SQLPolicy.withDefaults(),
+		uri:    "file:" + url.PathEscape(cfg.Path) + "?mode=" + mode,
+		attach: cfg.Attach,
+	}
+	// Writable attached databases are written through their own connection, since the
+	// query_only pragma of the agent database would otherwise be lifted for every
+	// database attached to it.
+	if cfg.Attach && !cfg.AllowWrites {
+		return src, nil
+	}
+
+	db, err := sqlx.Open("sqlite3", src.uri)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	src.db = db
+	return src, nil
+}
+
+func (s *SQL) source(name string) (*sqlSource, error) {
+	if name == "" {
+		name = mainSQLSource
+	}
+	src, ok := s.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown database %s, available databases are: %s", name, strings.Join(s.names, ", "))
+	}
+	return src, nil
+}
+
+// conn returns a connection to the source with the attached databases and the source
+// policy applied. Attachments and pragmas are connection settings, so release must be
+// called to reset them once the connection is no longer used.
+func (s *SQL) conn(ctx context.Context, src *sqlSource) (*sqlx.Conn, func(), error) {
+	host := src
+	if src.db == nil {
+		host = s.sources[mainSQLSource]
+	}
+	conn, err := host.db.Connx(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	var (
+		attached  []string
+		queryOnly bool
+	)
+	release := func() {
+		bg := context.Background()
+		var errs []error
+		if queryOnly {
+			if _, err := conn.ExecContext(bg, "PRAGMA query_only = OFF"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for _, name := range attached {
+			if _, err := conn.ExecContext(bg, "DETACH DATABASE "+quoteIdentifier(name)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			// A connection left read-only or with attached databases must not be reused:
+			// returning ErrBadConn from Raw makes the pool close it.
+			slog.Warn("reset SQL connection", "database", host.name, "error", err)
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+
+	if host.name == mainSQLSource {
+		for _, name := range s.names {
+			a := s.sources[name]
+			if !a.attach {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS "+quoteIdentifier(a.name), a.uri); err != nil {
+				release()
+				return nil, nil, fmt.Errorf("failed to attach database %s: %w", a.name, err)
+			}
+			attached = append(attached, a.name)
+		}
+	}
+	if !src.policy.AllowWrites {
+		if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+			release()
+			return nil, nil, fmt.Errorf("failed to set read-only mode: %w", err)
+		}
+		queryOnly = true
+	}
+	return conn, release, nil
+}
@@ -0,0 +1,206 @@
+package tool
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newSQLite creates a SQLite database file in a temporary directory, running stmts
+// on it.
+func newSQLite(t *testing.T, name string, stmts ...string) (*sqlx.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name+".db")
+	db, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, path
+}
+
+func TestStatementKeywords(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []string
+		wantErr string
+	}{
+		{query: "SELECT * FROM chats", want: []string{"SELECT"}},
+		{query: "select*from chats;", want: []string{"SELECT"}},
+		{query: "  -- the chats\n/* all of them */ SELECT 1", want: []string{"SELECT"}},
+		{query: "INSERT INTO t VALUES (';')", want: []string{"INSERT"}},
+		{query: "SELECT 'a; DROP TABLE t'", want: []string{"SELECT"}},
+		{query: "WITH x AS (SELECT 1) SELECT * FROM x", want: []string{"WITH", "SELECT"}},
+		{query: "WITH x AS (SELECT 1) DELETE FROM t WHERE id IN x", want: []string{"WITH", "DELETE"}},
+		{query: "with recursive n(i) as (select 1 union all select i + 1 from n) , m as materialized (values (1)) update t set a = 1", want: []string{"WITH", "UPDATE"}},
+		{query: `WITH "delete" AS (SELECT 1) INSERT INTO t SELECT * FROM "delete"`, want: []string{"WITH", "INSERT"}},
+		{query: "WITH x AS (DELETE FROM t)", wantErr: "no statement follows the common table expressions"},
+		{query: "SELECT 1; DELETE FROM t", wantErr: "only one statement can be executed at a time"},
+		{query: "SELECT 1; -- done", want: []string{"SELECT"}},
+		{query: "SELECT 'open", wantErr: "unterminated quoted string"},
+		{query: "SELECT 1 /* open", wantErr: "unterminated comment"},
+		{query: " -- nothing", wantErr: "empty query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := statementKeywords(tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("statementKeywords() = %v, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statementKeywords() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLPolicies(t *testing.T) {
+	ctx := context.Background()
+	db, _ := newSQLite(t, "agent", "CREATE TABLE chats (id INTEGER PRIMARY KEY, name TEXT)", "INSERT INTO chats VALUES (1, 'support')")
+	_, analytics := newSQLite(t, "analytics", "CREATE TABLE events (chat_id INTEGER, kind TEXT)", "INSERT INTO events VALUES (1, 'opened')")
+	_, crm := newSQLite(t, "crm", "CREATE TABLE contacts (name TEXT)")
+	_, ledger := newSQLite(t, "ledger", "CREATE TABLE entries (amount INTEGER)")
+
+	s, err := NewSQL(ctx, db, &SQLConfig{
+		Databases: map[string]*SQLDatabase{
+			"analytics": {Path: analytics, Attach: true},
+			"crm":       {Path: crm, SQLPolicy: SQLPolicy{AllowWrites: true, Statements: []string{"select", "insert"}}},
+			"ledger":    {Path: ledger, Attach: true, SQLPolicy: SQLPolicy{AllowWrites: true}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		database string
+		query    string
+		want     []map[string]any
+		wantErr  string
+	}{
+		{
+			name:  "join an attached database",
+			query: "SELECT c.name, e.kind FROM chats c JOIN analytics.events e ON e.chat_id = c.id",
+			want:  []map[string]any{{"name": "support", "kind": "opened"}},
+		},
+		{name: "write to main", query: "INSERT INTO chats VALUES (2, 'sales')", wantErr: "INSERT statements are not allowed on main"},
+		{name: "write after a cte on main", query: "WITH x AS (SELECT 1) DELETE FROM chats", wantErr: "DELETE statements are not allowed on main"},
+		{name: "select after a cte", query: "WITH x AS (SELECT 1) SELECT * FROM x", want: []map[string]any{{"1": int64(1)}}},
+		{name: "insert into crm", database: "crm", query: "INSERT INTO contacts VALUES ('ada')"},
+		{name: "statement not listed for crm", database: "crm", query: "DELETE FROM contacts", wantErr: "DELETE statements are not allowed on crm"},
+		{name: "statement not listed after a cte", database: "crm", query: "WITH x AS (SELECT 1) SELECT * FROM contacts", wantErr: "WITH statements are not allowed on crm"},
+		{name: "writable attached database", database: "ledger", query: "INSERT INTO entries VALUES (10)"},
+		{name: "read-only attached database", database: "analytics", query: "INSERT INTO events VALUES (2, 'closed')", wantErr: "INSERT statements are not allowed on analytics"},
+		{name: "unknown database", database: "billing", query: "SELECT 1", wantErr: "unknown database billing, available databases are: main, analytics, crm, ledger"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := s.Call(ctx, "sql_query", map[string]any{"database": tt.database, "query": tt.query})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("sql_query = %v, %v, want an error containing %q", out, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out["results"].([]map[string]any); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("results = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Writable attached databases are written through their own connection.
+	out, err := s.Call(ctx, "sql_query", map[string]any{"query": "SELECT count(*) AS n FROM ledger.entries"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out["results"].([]map[string]any)[0]["n"]; got != int64(1) {
+		t.Errorf("ledger entries = %v, want the inserted entry", got)
+	}
+}
+
+func TestSQLAttachReadOnly(t *testing.T) {
+	ctx := context.Background()
+	db, _ := newSQLite(t, "agent", "CREATE TABLE chats (id INTEGER PRIMARY KEY)")
+	_, analytics := newSQLite(t, "analytics", "CREATE TABLE events (kind TEXT)")
+	s, err := NewSQL(ctx, db, &SQLConfig{
+		SQLPolicy: SQLPolicy{AllowWrites: true},
+		Databases: map[string]*SQLDatabase{"analytics": {Path: analytics, Attach: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// The writable main database can't lift the read-only mode of the attached database.
+	if _, err := s.Call(ctx, "sql_query", map[string]any{"query": "INSERT INTO chats VALUES (1)"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Call(ctx, "sql_query", map[string]any{"query": "INSERT INTO analytics.events VALUES ('opened')"})
+	if err == nil || !strings.Contains(err.Error(), "readonly database") {
+		t.Errorf("writing to a read-only attached database = %v, want a readonly error", err)
+	}
+}
+
+func TestSQLConnectionReset(t *testing.T) {
+	ctx := context.Background()
+	db, _ := newSQLite(t, "agent", "CREATE TABLE chats (id INTEGER PRIMARY KEY)")
+	_, analytics := newSQLite(t, "analytics", "CREATE TABLE events (kind TEXT)")
+	db.SetMaxOpenConns(1)
+	s, err := NewSQL(ctx, db, &SQLConfig{
+		SQLPolicy: SQLPolicy{Statements: []string{"SELECT", "DETACH"}},
+		Databases: map[string]*SQLDatabase{"analytics": {Path: analytics, Attach: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Once released, the connection is back in the pool without the settings of the
+	// query.
+	if _, err := s.Call(ctx, "sql_query", map[string]any{"query": "SELECT * FROM analytics.events"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Stats().OpenConnections; n != 1 {
+		t.Fatalf("%d open connections, want the connection kept", n)
+	}
+	var queryOnly int
+	if err := db.Get(&queryOnly, "PRAGMA query_only"); err != nil {
+		t.Fatal(err)
+	}
+	var databases []string
+	if err := db.Select(&databases, "SELECT name FROM pragma_database_list"); err != nil {
+		t.Fatal(err)
+	}
+	if queryOnly != 0 || !reflect.DeepEqual(databases, []string{"main"}) {
+		t.Errorf("connection left with query_only = %d and databases %v", queryOnly, databases)
+	}
+
+	// A connection that fails to reset is discarded.
+	if _, err := s.Call(ctx, "sql_query", map[string]any{"query": "DETACH DATABASE analytics"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Stats().OpenConnections; n != 0 {
+		t.Errorf("%d open connections, want the connection that failed to reset closed", n)
+	}
+}
@@ -0,0 +1,326 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+	"go.starlark.net/lib/json"
+	starlarkmath "go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+var _ Tool = (*Starlark)(nil)
+
+const (
+	defaultStarlarkMaxSteps  = 10_000_000
+	defaultStarlarkTimeout   = 10 * time.Second
+	defaultStarlarkMaxOutput = 10_000
+	maxStarlarkItems         = 100_000
+)
+
+// StarlarkConfig limits the scripts run by the Starlark tool.
+type StarlarkConfig struct {
+	// MaxSteps caps the number of computation steps of a script.
+	MaxSteps uint64 `json:"maxSteps"`
+	// Timeout bounds the execution time of a script.
+	Timeout Duration `json:"timeout"`
+	// MaxOutput caps, in characters, the printed output returned to the model.
+	MaxOutput int `json:"maxOutput"`
+}
+
+// Starlark runs Starlark scripts, a Python dialect, in a hermetic interpreter: scripts
+// have no access to files, the network, the clock or the environment.
+type Starlark struct {
+	maxSteps  uint64
+	timeout   time.Duration
+	maxOutput int
+}
+
+// NewStarlark creates a Starlark tool limited by cfg. A nil cfg uses the defaults.
+func NewStarlark(cfg *StarlarkConfig) *Starlark {
+	var c StarlarkConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	s := &Starlark{maxSteps: c.MaxSteps, timeout: time.Duration(c.Timeout), maxOutput: c.MaxOutput}
+	if s.maxSteps == 0 {
+		s.maxSteps = defaultStarlarkMaxSteps
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultStarlarkTimeout
+	}
+	if s.maxOutput <= 0 {
+		s.maxOutput = defaultStarlarkMaxOutput
+	}
+	return s
+}
+
+// starlarkOptions enables the language features scripts written by a model expect from
+// Python.
+var starlarkOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+	Recursion:       true,
+}
+
+func (s *Starlark) Functions(ctx context.Context) []Function {
+	return []Function{
+		{
+			ID:          "starlark_run",
+			DisplayName: "Run Script",
+			Description: "Runs a Starlark script, a dialect of Python, and returns the value the script assigns to the result variable. Use this function to transform data, such as filtering, grouping or sorting a list, or to compute anything the evaluate function can't, such as statistics over the rows of a query. Scripts can't read files, access the network or import modules. The json and math modules and a sum function are available, and the output of print is returned.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for running a script",
+				Properties: map[string]jsonschema.JSONSchema{
+					"script": {
+						Type:        "string",
+						Description: "The Starlark script. It must assign its outcome to the result variable. Starlark has no classes, exceptions, imports or ** operator: use math.pow instead. Strings can't be iterated directly: use .elems() instead.",
+						Examples: []any{
+							"result = sorted(rows, key=lambda r: r['total'], reverse=True)[:5]",
+							"totals = {}\nfor r in rows:\n    totals[r['region']] = totals.get(r['region'], 0) + r['amount']\nresult = totals",
+							"mean = sum(values) / len(values)\nresult = {'mean': mean, 'stddev': math.sqrt(sum([math.pow(v - mean, 2) for v in values]) / len(values))}",
+						},
+					},
+					"inputs": {
+						Type:        "object",
+						Description: "Values made available to the script as global variables, by name, such as the rows returned by another function. Whole numbers are integers.",
+						Examples:    []any{map[string]any{"values": []any{3, 1, 4, 1, 5}}, map[string]any{"rows": []any{map[string]any{"region": "EU", "amount": 120}}}},
+					},
+				},
+				Required:         []string{"script"},
+				PropertyOrdering: []string{"script", "inputs"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The outcome of the script",
+				Properties: map[string]jsonschema.JSONSchema{
+					"result": {
+						Description: "The value of the result variable, converted to JSON. Tuples and sets become arrays",
+					},
+					"output": {
+						Type:        "string",
+						Description: "The text printed by the script, if any",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *Starlark) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	if fn != "starlark_run" {
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+	script, ok := params["script"].(string)
+	if !ok || strings.TrimSpace(script) == "" {
+		return nil, fmt.Errorf("script parameter must be a non-empty string")
+	}
+	predeclared := starlark.StringDict{
+		"json": json.Module,
+		"math": starlarkmath.Module,
+		"sum":  starlark.NewBuiltin("sum", starlarkSum),
+	}
+	if inputs, ok := params["inputs"].(map[string]any); ok {
+		for name, v := range inputs {
+			if _, ok := predeclared[name]; ok {
+				return nil, fmt.Errorf("input %s shadows a builtin of the same name", name)
+			}
+			sv, err := toStarlark(v)
+			if err != nil {
+				return nil, fmt.Errorf("input %s: %w", name, err)
+			}
+			predeclared[name] = sv
+		}
+	}
+
+	var output strings.Builder
+	thread := &starlark.Thread{
+		Name: "script",
+		Print: func(_ *starlark.Thread, msg string) {
+			if output.Len() <= s.maxOutput {
+				output.WriteString(msg)
+				output.WriteByte('\n')
+			}
+		},
+	}
+	thread.SetMaxExecutionSteps(s.maxSteps)
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(fmt.Sprintf("timed out after %s", s.timeout))
+		case <-done:
+		}
+	}()
+
+	globals, err := starlark.ExecFileOptions(starlarkOptions, thread, "script.star", script, predeclared)
+	if err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			return nil, fmt.Errorf("script failed: %s", evalErr.Backtrace())
+		}
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+
+	res := map[string]any{}
+	if v, ok := globals["result"]; ok {
+		if res["result"], err = fromStarlark(v); err != nil {
+			return nil, fmt.Errorf("result: %w", err)
+		}
+	}
+	if output.Len() > 0 {
+		text := strings.TrimSuffix(output.String(), "\n")
+		if len(text) > s.maxOutput {
+			text = strings.ToValidUTF8(text[:s.maxOutput], "") + "..."
+		}
+		res["output"] = text
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("the script neither assigned result nor printed anything")
+	}
+	return res, nil
+}
+
+// starlarkSum implements the sum function of Python, which Starlark lacks.
+func starlarkSum(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		iterable starlark.Iterable
+		total    starlark.Value = starlark.MakeInt(0)
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "iterable", &iterable, "start?", &total); err != nil {
+		return nil, err
+	}
+	iter := iterable.Iterate()
+	defer iter.Done()
+	var v starlark.Value
+	for iter.Next(&v) {
+		var err error
+		if total, err = starlark.Binary(syntax.PLUS, total, v); err != nil {
+			return nil, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+	}
+	return total, nil
+}
+
+// toStarlark converts a decoded JSON value to a Starlark value. Whole numbers become
+// integers.
+func toStarlark(v any) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return starlark.MakeInt64(int64(v)), nil
+		}
+		return starlark.Float(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case string:
+		return starlark.String(v), nil
+	case []any:
+		elems := make([]starlark.Value, len(v))
+		for i, e := range v {
+			var err error
+			if elems[i], err = toStarlark(e); err != nil {
+				return nil, err
+			}
+		}
+		return starlark.NewList(elems), nil
+	case map[string]any:
+		dict := starlark.NewDict(len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			e, err := toStarlark(v[k])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(k), e); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// fromStarlark converts a Starlark value to a value encodable as JSON.
+func fromStarlark(v starlark.Value) (any, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		if n, ok := v.Int64(); ok {
+			return n, nil
+		}
+		// Integers beyond 64 bits keep their exact value as text.
+		return v.String(), nil
+	case starlark.Float:
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return v.String(), nil
+		}
+		return f, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bytes:
+		return string(v), nil
+	case *starlark.Dict:
+		m := make(map[string]any, v.Len())
+		for _, item := range v.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				key = item[0].String()
+			}
+			e, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = e
+		}
+		return m, nil
+	case starlark.Iterable:
+		// Lists, tuples, sets and ranges. Ranges are lazy and can be huge.
+		if seq, ok := v.(starlark.Sequence); ok && seq.Len() > maxStarlarkItems {
+			return nil, fmt.Errorf("%s of %d items is too large", v.Type(), seq.Len())
+		}
+		arr := []any{}
+		iter := v.Iterate()
+		defer iter.Done()
+		var e starlark.Value
+		for iter.Next(&e) {
+			x, err := fromStarlark(e)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, x)
+		}
+		return arr, nil
+	default:
+		return nil, fmt.Errorf("%s values can't be converted to JSON", v.Type())
+	}
+}
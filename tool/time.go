@@ -0,0 +1,429 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	// Embed the timezone database for systems that don't provide one.
+	_ "time/tzdata"
+
+	"github.com/aliphe/skipery/pkg/dates"
+	"github.com/aliphe/skipery/pkg/jsonschema"
+)
+
+var _ Tool = (*Time)(nil)
+
+// maxBusinessDays caps the business days added to a date, about 4000 years.
+const maxBusinessDays = 1_000_000
+
+type Time struct {
+	now func() time.Time
+}
+
+func NewTime() *Time {
+	return &Time{now: time.Now}
+}
+
+func (t *Time) Functions(ctx context.Context) []Function {
+	local := dates.LocalZone()
+	timezone := jsonschema.JSONSchema{
+		Type:        "string",
+		Description: "An IANA timezone name, or UTC. Defaults to the user's timezone, " + local + ".",
+		Examples:    []any{"Europe/Paris", "America/New_York", "Asia/Tokyo", "UTC"},
+	}
+	datetime := func(description string) jsonschema.JSONSchema {
+		return jsonschema.JSONSchema{
+			Type:        "string",
+			Description: description + ", as an RFC 3339 date and time, a YYYY-MM-DD date or a natural language expression such as \"next tuesday at 3pm\". Defaults to now.",
+			Examples:    []any{"2024-03-05T14:30:00+01:00", "2024-03-05", "tomorrow at 9am", "in 3 days"},
+		}
+	}
+	moment := jsonschema.JSONSchema{
+		Type:        "object",
+		Description: "A date and time",
+		Properties: map[string]jsonschema.JSONSchema{
+			"datetime":   {Type: "string", Description: "The date and time in RFC 3339 format"},
+			"date":       {Type: "string", Description: "The date in YYYY-MM-DD format"},
+			"time":       {Type: "string", Description: "The time of day in HH:MM:SS format"},
+			"weekday":    {Type: "string", Description: "The day of the week"},
+			"timezone":   {Type: "string", Description: "The timezone name"},
+			"utc_offset": {Type: "string", Description: "The offset from UTC, such as +02:00"},
+			"unix":       {Type: "integer", Description: "The number of seconds since January 1, 1970 UTC"},
+		},
+	}
+
+	return []Function{
+		{
+			ID:          "time_now",
+			DisplayName: "Current Time",
+			Description: "Returns the current date and time in a timezone. Use this function whenever the answer depends on the current date or time.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for getting the current time",
+				Properties: map[string]jsonschema.JSONSchema{
+					"timezone": timezone,
+				},
+				PropertyOrdering: []string{"timezone"},
+			},
+			Response: moment,
+		},
+		{
+			ID:          "time_convert",
+			DisplayName: "Convert Timezone",
+			Description: "Converts a date and time to another timezone. Use this function to tell what time it is, or will be, somewhere else.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for converting a date and time",
+				Properties: map[string]jsonschema.JSONSchema{
+					"datetime":      datetime("The date and time to convert"),
+					"from_timezone": withDescription(timezone, "The timezone of datetime when it has no UTC offset. Defaults to the user's timezone, "+local+"."),
+					"to_timezone":   withDescription(timezone, "The timezone to convert to."),
+				},
+				Required:         []string{"to_timezone"},
+				PropertyOrdering: []string{"datetime", "from_timezone", "to_timezone"},
+			},
+			Response: moment,
+		},
+		{
+			ID:          "time_add",
+			DisplayName: "Add Duration",
+			Description: "Adds a duration to a date and time, or subtracts it with negative values. Calendar units are added before the duration, and adding months to the end of a month stays in the target month, so January 31 plus one month is the last day of February.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for adding a duration",
+				Properties: map[string]jsonschema.JSONSchema{
+					"datetime": datetime("The date and time to start from"),
+					"timezone": timezone,
+					"years":    {Type: "integer", Description: "The number of years to add", Examples: []any{1, -2}},
+					"months":   {Type: "integer", Description: "The number of months to add", Examples: []any{3, -1}},
+					"days":     {Type: "integer", Description: "The number of days to add", Examples: []any{10, -7}},
+					"duration": {
+						Type:        "string",
+						Description: "A duration to add, made of hours (h), minutes (m) and seconds (s)",
+						Examples:    []any{"1h30m", "-45m", "90s"},
+					},
+				},
+				PropertyOrdering: []string{"datetime", "timezone", "years", "months", "days", "duration"},
+			},
+			Response: moment,
+		},
+		{
+			ID:          "time_diff",
+			DisplayName: "Time Difference",
+			Description: "Computes the time elapsed between two dates and times. The result is negative when end is before start.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for computing a time difference",
+				Properties: map[string]jsonschema.JSONSchema{
+					"start":    datetime("The start date and time"),
+					"end":      datetime("The end date and time"),
+					"timezone": timezone,
+				},
+				PropertyOrdering: []string{"start", "end", "timezone"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The time elapsed",
+				Properties: map[string]jsonschema.JSONSchema{
+					"duration":      {Type: "string", Description: "The elapsed time, such as 50h30m0s"},
+					"seconds":       {Type: "integer", Description: "The elapsed time in seconds"},
+					"hours":         {Type: "number", Description: "The elapsed time in hours"},
+					"days":          {Type: "number", Description: "The elapsed time in days"},
+					"calendar_days": {Type: "integer", Description: "The number of calendar days between the two dates, ignoring the time of day"},
+				},
+			},
+		},
+		{
+			ID:          "time_business_days",
+			DisplayName: "Business Days",
+			Description: "Counts the business days, Monday to Friday, between two dates, or finds the date a number of business days after a date. Provide end to count, or days to add.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for business day calculations",
+				Properties: map[string]jsonschema.JSONSchema{
+					"start": datetime("The date to start from"),
+					"end": {
+						Type:        "string",
+						Description: "The date to count to, included, as a YYYY-MM-DD date or a natural language expression",
+						Examples:    []any{"2024-03-29", "end of month"},
+					},
+					"days": {
+						Type:        "integer",
+						Description: "The number of business days to add to start, negative to go back, up to 1000000",
+						Examples:    []any{10, -3},
+					},
+					"holidays": {
+						Type:        "array",
+						Description: "Dates, in YYYY-MM-DD format, that are not business days",
+						Items:       &jsonschema.JSONSchema{Type: "string"},
+						Examples:    []any{[]any{"2024-12-25", "2025-01-01"}},
+					},
+					"timezone": timezone,
+				},
+				PropertyOrdering: []string{"start", "end", "days", "holidays", "timezone"},
+			},
+			Response: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "The business days",
+				Properties: map[string]jsonschema.JSONSchema{
+					"business_days": {Type: "integer", Description: "The number of business days from start to end, both included"},
+					"calendar_days": {Type: "integer", Description: "The number of days from start to end, both included"},
+					"date":          {Type: "string", Description: "The date days business days after start, in YYYY-MM-DD format"},
+					"weekday":       {Type: "string", Description: "The day of the week of date"},
+				},
+			},
+		},
+		{
+			ID:          "time_parse",
+			DisplayName: "Parse Date",
+			Description: "Turns a natural language date into a calendar date. Use this function to resolve expressions such as \"next tuesday\", \"in 2 weeks\", \"end of month\" or \"march 5 at 3pm\" before using them.",
+			Parameters: jsonschema.JSONSchema{
+				Type:        "object",
+				Description: "Parameters for parsing a date",
+				Properties: map[string]jsonschema.JSONSchema{
+					"text": {
+						Type:        "string",
+						Description: "The date to parse",
+						Examples:    []any{"next tuesday", "tomorrow at 9am", "3 days ago", "start of next month", "december 25"},
+					},
+					"timezone": timezone,
+				},
+				Required:         []string{"text"},
+				PropertyOrdering: []string{"text", "timezone"},
+			},
+			Response: moment,
+		},
+	}
+}
+
+func withDescription(s jsonschema.JSONSchema, description string) jsonschema.JSONSchema {
+	s.Description = description
+	return s
+}
+
+func (t *Time) Call(ctx context.Context, fn string, params map[string]any) (map[string]any, error) {
+	name, _ := params["timezone"].(string)
+	loc, err := location(name)
+	if err != nil {
+		return nil, err
+	}
+	now := t.now().In(loc)
+
+	switch fn {
+	case "time_now":
+		return describeTime(now), nil
+	case "time_convert":
+		to, ok := params["to_timezone"].(string)
+		if !ok || to == "" {
+			return nil, fmt.Errorf("to_timezone parameter must be a timezone name")
+		}
+		toLoc, err := location(to)
+		if err != nil {
+			return nil, err
+		}
+		from, _ := params["from_timezone"].(string)
+		fromLoc, err := location(from)
+		if err != nil {
+			return nil, err
+		}
+		d, err := parseTime(params, "datetime", t.now().In(fromLoc))
+		if err != nil {
+			return nil, err
+		}
+		return describeTime(d.In(toLoc)), nil
+	case "time_add":
+		d, err := parseTime(params, "datetime", now)
+		if err != nil {
+			return nil, err
+		}
+		d = addMonths(d, 12*intParam(params, "years", 0)+intParam(params, "months", 0)).AddDate(0, 0, intParam(params, "days", 0))
+		if s, _ := params["duration"].(string); s != "" {
+			duration, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration: %w", err)
+			}
+			d = d.Add(duration)
+		}
+		return describeTime(d), nil
+	case "time_diff":
+		start, err := parseTime(params, "start", now)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTime(params, "end", now)
+		if err != nil {
+			return nil, err
+		}
+		elapsed := end.Sub(start)
+		return map[string]any{
+			"duration":      elapsed.String(),
+			"seconds":       int64(elapsed.Seconds()),
+			"hours":         math.Round(elapsed.Hours()*100) / 100,
+			"days":          math.Round(elapsed.Hours()/24*100) / 100,
+			"calendar_days": calendarDays(start, end.In(start.Location())),
+		}, nil
+	case "time_business_days":
+		return t.businessDays(params, now)
+	case "time_parse":
+		text, ok := params["text"].(string)
+		if !ok {
+			return nil, fmt.Errorf("text parameter must be a string")
+		}
+		d, err := dates.Parse(text, now)
+		if err != nil {
+			return nil, err
+		}
+		return describeTime(d), nil
+	default:
+		return nil, fmt.Errorf("unknown function: %s", fn)
+	}
+}
+
+func (t *Time) businessDays(params map[string]any, now time.Time) (map[string]any, error) {
+	start, err := parseTime(params, "start", now)
+	if err != nil {
+		return nil, err
+	}
+	holidays := map[string]bool{}
+	if list, ok := params["holidays"].([]any); ok {
+		for _, h := range list {
+			if s, ok := h.(string); ok {
+				holidays[s] = true
+			}
+		}
+	}
+
+	if _, ok := params["end"]; !ok {
+		if _, ok := params["days"]; !ok {
+			return nil, fmt.Errorf("either end or days parameter is required")
+		}
+		n := intParam(params, "days", 0)
+		if n < -maxBusinessDays || n > maxBusinessDays {
+			return nil, fmt.Errorf("days must be between %d and %d", -maxBusinessDays, maxBusinessDays)
+		}
+		step := 1
+		if n < 0 {
+			n, step = -n, -1
+		}
+		d := start
+		// Whole weeks are skipped at once, as they have 5 business days but for holidays,
+		// leaving the last business day to find one day at a time.
+		for n > 5 {
+			next := d.AddDate(0, 0, step*(n-1)/5*7)
+			first, last := d.AddDate(0, 0, step), next
+			if step < 0 {
+				first, last = last, first
+			}
+			n -= countBusinessDays(first, last, holidays)
+			d = next
+		}
+		for n > 0 {
+			d = d.AddDate(0, 0, step)
+			if isBusinessDay(d, holidays) {
+				n--
+			}
+		}
+		return map[string]any{"date": d.Format(time.DateOnly), "weekday": d.Weekday().String()}, nil
+	}
+
+	end, err := parseTime(params, "end", now)
+	if err != nil {
+		return nil, err
+	}
+	end = end.In(start.Location())
+	sign := 1
+	if end.Before(start) {
+		start, end, sign = end, start, -1
+	}
+	business, calendar := countBusinessDays(start, end, holidays), calendarDays(start, end)+1
+	return map[string]any{"business_days": sign * business, "calendar_days": sign * calendar}, nil
+}
+
+// countBusinessDays counts the business days from the date of first to the date of last,
+// both included.
+func countBusinessDays(first, last time.Time, holidays map[string]bool) int {
+	days := calendarDays(first, last) + 1
+	if days <= 0 {
+		return 0
+	}
+	count := days / 7 * 5
+	for d := first.AddDate(0, 0, days/7*7); calendarDays(d, last) >= 0; d = d.AddDate(0, 0, 1) {
+		if isWeekday(d) {
+			count++
+		}
+	}
+	for h := range holidays {
+		d, err := time.ParseInLocation(time.DateOnly, h, first.Location())
+		if err == nil && isWeekday(d) && calendarDays(first, d) >= 0 && calendarDays(d, last) >= 0 {
+			count--
+		}
+	}
+	return count
+}
+
+func isBusinessDay(d time.Time, holidays map[string]bool) bool {
+	return isWeekday(d) && !holidays[d.Format(time.DateOnly)]
+}
+
+func isWeekday(d time.Time) bool {
+	return d.Weekday() != time.Saturday && d.Weekday() != time.Sunday
+}
+
+// location loads the named timezone, the local one when name is empty.
+func location(name string) (*time.Location, error) {
+	if name == "" || strings.EqualFold(name, "local") || name == dates.LocalZone() {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q, use an IANA name such as Europe/Paris", name)
+	}
+	return loc, nil
+}
+
+// parseTime parses the date parameter key, relative to now. A missing parameter is now.
+func parseTime(params map[string]any, key string, now time.Time) (time.Time, error) {
+	s, _ := params[key].(string)
+	if s == "" {
+		return now, nil
+	}
+	t, err := dates.Parse(s, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return t, nil
+}
+
+func describeTime(t time.Time) map[string]any {
+	zone := t.Location().String()
+	if t.Location() == time.Local {
+		zone = dates.LocalZone()
+	}
+	return map[string]any{
+		"datetime":   t.Format(time.RFC3339),
+		"date":       t.Format(time.DateOnly),
+		"time":       t.Format(time.TimeOnly),
+		"weekday":    t.Weekday().String(),
+		"timezone":   zone,
+		"utc_offset": t.Format("-07:00"),
+		"unix":       t.Unix(),
+	}
+}
+
+// calendarDays returns the number of days from the date of start to the date of end.
+func calendarDays(start, end time.Time) int {
+	s := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	e := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	// Durations overflow after 292 years.
+	return int((e.Unix() - s.Unix()) / (24 * 60 * 60))
+}
+
+// addMonths adds months to t, moving to the last day of the target month when it is
+// shorter than the day of t.
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), last)-1)
+}
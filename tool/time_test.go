@@ -0,0 +1,115 @@
+package tool
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeBusinessDays(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2025, time.March, 12, 15, 4, 5, 0, time.UTC)
+	tm := &Time{now: func() time.Time { return now }}
+	tests := []struct {
+		name   string
+		params map[string]any
+		want   map[string]any
+	}{
+		{name: "next business day", params: map[string]any{"days": 1}, want: map[string]any{"date": "2025-03-13", "weekday": "Thursday"}},
+		{name: "over a weekend", params: map[string]any{"start": "friday", "days": 1}, want: map[string]any{"date": "2025-03-17", "weekday": "Monday"}},
+		{name: "from a saturday", params: map[string]any{"start": "2025-03-15", "days": 1}, want: map[string]any{"date": "2025-03-17", "weekday": "Monday"}},
+		{name: "a week", params: map[string]any{"start": "today", "days": 5}, want: map[string]any{"date": "2025-03-19", "weekday": "Wednesday"}},
+		{name: "zero days", params: map[string]any{"start": "2025-03-15", "days": 0}, want: map[string]any{"date": "2025-03-15", "weekday": "Saturday"}},
+		{name: "backwards", params: map[string]any{"start": "2025-03-17", "days": -1}, want: map[string]any{"date": "2025-03-14", "weekday": "Friday"}},
+		{name: "backwards from a sunday", params: map[string]any{"start": "2025-03-16", "days": -6}, want: map[string]any{"date": "2025-03-07", "weekday": "Friday"}},
+		{name: "relative start", params: map[string]any{"start": "next monday", "days": -10}, want: map[string]any{"date": "2025-03-03", "weekday": "Monday"}},
+		{
+			name:   "holidays",
+			params: map[string]any{"start": "2025-03-14", "days": 2, "holidays": []any{"2025-03-17", "2025-03-22"}},
+			want:   map[string]any{"date": "2025-03-19", "weekday": "Wednesday"},
+		},
+		{name: "a year", params: map[string]any{"start": "2025-01-01", "days": 260}, want: map[string]any{"date": "2025-12-31", "weekday": "Wednesday"}},
+
+		{name: "count", params: map[string]any{"start": "2025-03-10", "end": "2025-03-21"}, want: map[string]any{"business_days": 10, "calendar_days": 12}},
+		{name: "count backwards", params: map[string]any{"start": "2025-03-21", "end": "2025-03-10"}, want: map[string]any{"business_days": -10, "calendar_days": -12}},
+		{name: "count a weekend", params: map[string]any{"start": "2025-03-15", "end": "2025-03-16"}, want: map[string]any{"business_days": 0, "calendar_days": 2}},
+		{name: "count a single day", params: map[string]any{"start": "2025-03-12", "end": "today"}, want: map[string]any{"business_days": 1, "calendar_days": 1}},
+		{
+			name:   "count with holidays",
+			params: map[string]any{"start": "2025-12-22", "end": "2026-01-02", "holidays": []any{"2025-12-25", "2026-01-01", "2025-12-27"}},
+			want:   map[string]any{"business_days": 8, "calendar_days": 12},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tm.Call(context.Background(), "time_business_days", tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %v, want %v", k, got[k], v)
+				}
+			}
+		})
+	}
+
+	for _, params := range []map[string]any{
+		{"days": maxBusinessDays + 1},
+		{"start": "someday", "days": 1},
+		{"start": "today"},
+	} {
+		if _, err := tm.Call(context.Background(), "time_business_days", params); err == nil {
+			t.Errorf("time_business_days(%v) succeeded, want an error", params)
+		}
+	}
+}
+
+// TestTimeAddBusinessDaysByWeeks checks adding business days a week at a time against
+// adding them one day at a time.
+func TestTimeAddBusinessDaysByWeeks(t *testing.T) {
+	tm := &Time{now: time.Now}
+	holidays := map[string]bool{"2025-03-17": true, "2025-03-20": true, "2025-04-05": true, "2025-05-01": true}
+	holidayList := []any{"2025-03-17", "2025-03-20", "2025-04-05", "2025-05-01"}
+	for start := 0; start < 14; start++ {
+		first := time.Date(2025, time.March, 10+start, 0, 0, 0, 0, time.UTC)
+		for n := -60; n <= 60; n++ {
+			left, step := n, 1
+			if n < 0 {
+				left, step = -n, -1
+			}
+			want := first
+			for left > 0 {
+				want = want.AddDate(0, 0, step)
+				if isBusinessDay(want, holidays) {
+					left--
+				}
+			}
+			got, err := tm.Call(context.Background(), "time_business_days", map[string]any{
+				"start": first.Format(time.DateOnly), "days": n, "holidays": holidayList,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got["date"] != want.Format(time.DateOnly) {
+				t.Fatalf("%d business days from %s = %v, want %s", n, first.Format(time.DateOnly), got["date"], want.Format(time.DateOnly))
+			}
+		}
+	}
+}
+
+func TestTimeParse(t *testing.T) {
+	now := time.Date(2025, time.March, 12, 15, 4, 5, 0, time.UTC)
+	tm := &Time{now: func() time.Time { return now }}
+	got, err := tm.Call(context.Background(), "time_parse", map[string]any{"text": "next friday at 9am", "timezone": "Europe/Paris"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["datetime"] != "2025-03-14T09:00:00+01:00" || got["weekday"] != "Friday" || got["timezone"] != "Europe/Paris" {
+		t.Errorf("time_parse = %v, want friday 9am in Paris", got)
+	}
+	if _, err := tm.Call(context.Background(), "time_parse", map[string]any{"text": "the 5th"}); err == nil || !strings.Contains(err.Error(), "no month") {
+		t.Errorf("time_parse of a date without month = %v, want an error", err)
+	}
+}
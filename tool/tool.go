@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/aliphe/skipery/pkg/jsonschema"
 )
@@ -29,6 +31,44 @@ type Function struct {
 
 	// A JSON schema describing the tool's response
 	Response jsonschema.JSONSchema
+
+	// CacheTTL, when positive, lets the result of a call be reused for that long when the
+	// function is called again with the same arguments in the same chat. Only functions
+	// without side effects should set it.
+	CacheTTL time.Duration
+
+	// Async functions can take minutes, and run as background jobs when they don't
+	// finish quickly: the model gets a job handle instead of their result.
+	Async bool
+}
+
+// Duration is a time.Duration read from configuration files as a string such as "30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+type chatIDKey struct{}
+
+// WithChatID returns a copy of ctx telling tools which chat they are called for.
+func WithChatID(ctx context.Context, chatID string) context.Context {
+	return context.WithValue(ctx, chatIDKey{}, chatID)
+}
+
+// ChatID returns the ID of the chat a tool is called for, empty when unknown.
+func ChatID(ctx context.Context) string {
+	id, _ := ctx.Value(chatIDKey{}).(string)
+	return id
 }
 
 type Parameter struct {
@@ -46,6 +86,31 @@ func (tb *ToolBelt) Call(ctx context.Context, name string, args map[string]any)
 	return (*tb)[name].Call(ctx, name, args)
 }
 
+// Source names the tool implementing a function: its Name when it has one, its type
+// otherwise.
+func (tb ToolBelt) Source(function string) string {
+	t, ok := tb[function]
+	if !ok {
+		return ""
+	}
+	if n, ok := t.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	typ := fmt.Sprintf("%T", t)
+	return strings.ToLower(typ[strings.LastIndex(typ, ".")+1:])
+}
+
+// Subset returns a tool belt restricted to the functions ids, ignoring unknown ones.
+func (tb ToolBelt) Subset(ids []string) ToolBelt {
+	sub := make(ToolBelt, len(ids))
+	for _, id := range ids {
+		if t, ok := tb[id]; ok {
+			sub[id] = t
+		}
+	}
+	return sub
+}
+
 func NewToolBelt(tools ...Tool) ToolBelt {
 	belt := make(ToolBelt)
 
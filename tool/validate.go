@@ -0,0 +1,139 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aliphe/skipery/pkg/jsonschema"
+)
+
+// Validation modes of function results.
+const (
+	// ValidationOff doesn't check results.
+	ValidationOff = "off"
+	// ValidationWarn logs violations and reports them to the model alongside the result.
+	ValidationWarn = "warn"
+	// ValidationStrict fails the calls returning results that violate their schema.
+	ValidationStrict = "strict"
+)
+
+// maxViolations caps the number of violations reported for a result.
+const maxViolations = 10
+
+// ValidationConfig sets how function results are checked against the response schemas
+// of the functions.
+type ValidationConfig struct {
+	// Mode is off, warn, the default, or strict.
+	Mode string `json:"mode"`
+	// Functions overrides the mode by function ID or pattern such as "linear_*".
+	Functions map[string]string `json:"functions"`
+}
+
+// Validator checks function results against the response schemas of the functions.
+type Validator struct {
+	cfg ValidationConfig
+
+	mu      sync.Mutex
+	schemas map[string]jsonschema.JSONSchema
+	modes   map[string]string
+}
+
+// NewValidator creates a validator of the functions of tb. Functions without a typed
+// response schema aren't checked.
+func NewValidator(cfg *ValidationConfig, tb ToolBelt) (*Validator, error) {
+	var c ValidationConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.Mode == "" {
+		c.Mode = ValidationWarn
+	}
+	for _, mode := range append([]string{c.Mode}, slices.Collect(maps.Values(c.Functions))...) {
+		if mode != ValidationOff && mode != ValidationWarn && mode != ValidationStrict {
+			return nil, fmt.Errorf("unknown validation mode %q, expected off, warn or strict", mode)
+		}
+	}
+
+	v := &Validator{cfg: c}
+	v.Reload(tb)
+	return v, nil
+}
+
+// Reload reads the response schemas of the functions of tb again, such as when the
+// functions of an MCP server change after it reconnects.
+func (v *Validator) Reload(tb ToolBelt) {
+	schemas := map[string]jsonschema.JSONSchema{}
+	modes := map[string]string{}
+	seen := map[Tool]bool{}
+	for _, t := range tb {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		for _, fn := range t.Functions(context.Background()) {
+			if fn.Response.Type != "" {
+				schemas[fn.ID] = fn.Response
+			}
+		}
+	}
+	for id := range schemas {
+		modes[id] = v.cfg.Mode
+		// The longest matching pattern wins, an exact ID being the longest.
+		best := -1
+		for pattern, mode := range v.cfg.Functions {
+			if len(pattern) > best && MatchWildcard(pattern, id) {
+				best = len(pattern)
+				modes[id] = mode
+			}
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.schemas = schemas
+	v.modes = modes
+}
+
+// Validate checks the result of function against its response schema. In warn mode, the
+// violations are logged and added to a copy of the result under schema_violations. In
+// strict mode, they are returned as an error.
+func (v *Validator) Validate(function string, result map[string]any) (map[string]any, error) {
+	v.mu.Lock()
+	schema, ok := v.schemas[function]
+	mode := v.modes[function]
+	v.mu.Unlock()
+	if !ok || mode == ValidationOff {
+		return result, nil
+	}
+
+	// Tools return Go values, which are checked as the JSON the model receives.
+	b, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("encode result of %s: %w", function, err)
+	}
+	var decoded any
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil, fmt.Errorf("decode result of %s: %w", function, err)
+	}
+	violations := schema.Validate(decoded)
+	if len(violations) == 0 {
+		return result, nil
+	}
+	if len(violations) > maxViolations {
+		violations = append(violations[:maxViolations], fmt.Sprintf("and %d more", len(violations)-maxViolations))
+	}
+
+	slog.Warn("tool result violates its response schema", "function", function, "violations", violations)
+	if mode == ValidationStrict {
+		return nil, fmt.Errorf("the result of %s doesn't match its response schema: %s", function, strings.Join(violations, "; "))
+	}
+	result = maps.Clone(result)
+	result["schema_violations"] = violations
+	return result, nil
+}